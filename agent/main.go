@@ -1,58 +1,273 @@
 package main
 
 import (
+	"context"
 	"flag"
-	"log"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strconv"
 	"syscall"
+	"time"
 
-	"github.com/cosysn/devpod-provider-wsl/pkg/tunnel"
 	"github.com/cosysn/devpod-provider-wsl/pkg/grpc"
 	pb "github.com/cosysn/devpod-provider-wsl/pkg/grpc/proto"
+	"github.com/cosysn/devpod-provider-wsl/pkg/logging"
+	"github.com/cosysn/devpod-provider-wsl/pkg/options"
+	"github.com/cosysn/devpod-provider-wsl/pkg/tunnel"
 	grpcLib "google.golang.org/grpc"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+const (
+	// defaultPidFile 与日志文件放在同一个目录下
+	defaultPidFile = "/var/tmp/devpod/agent.pid"
+	// listenFDEnv 把监听 socket 的文件描述符传给升级后的 agent
+	listenFDEnv = "DEVPOD_AGENT_LISTEN_FD"
+	// systemdFD 是 systemd socket 激活时传入的第一个文件描述符（SD_LISTEN_FDS_START）
+	systemdFD = 3
 )
 
+// version 由构建时的 -ldflags "-X main.version=..." 设置
+var version = "dev"
+
 func main() {
 	// 命令行参数
+	showVersion := flag.Bool("version", false, "Print the agent version and exit")
+	showHealth := flag.Bool("health", false, "Print the health of the running agent as JSON and exit")
 	socketPath := flag.String("socket", tunnel.DefaultSocketPath, "Unix socket path")
+	workspaceRoot := flag.String("workspace-root", options.DefaultWorkspaceRoot, "Workspace root checked by the health RPC")
+	fileRoot := flag.String("file-root", "", "Directory the file RPCs are confined to, empty uses -workspace-root")
+	logLevel := flag.String("log-level", "info", "Log level: debug, info, warn or error")
+	logFile := flag.String("log-file", logging.DefaultAgentLogFile, "Log file, empty disables file logging")
+	debug := flag.Bool("debug", false, "Enable debug logging, same as -log-level debug")
+	pidFile := flag.String("pid-file", defaultPidFile, "Pid file, removed on shutdown, empty disables it")
+	drainTimeout := flag.Duration("drain-timeout", 30*time.Second, "How long to wait for commands to exit on shutdown before killing them")
+	metricsAddr := flag.String("metrics-addr", "", "Serve Prometheus metrics on this address, e.g. 127.0.0.1:9464, empty disables it")
 	flag.Parse()
 
-	log.SetOutput(os.Stdout)
-	log.SetFlags(log.LstdFlags | log.Lshortfile)
+	if *showVersion {
+		fmt.Println(version)
+		return
+	}
+	if *showHealth {
+		os.Exit(printHealth(*socketPath))
+	}
 
-	log.Printf("Agent starting...")
-	log.Printf("Socket path: %s", *socketPath)
+	// 日志写到 stderr 和轮转的日志文件，stdout 只留给命令输出
+	level, levelErr := logging.ParseLevel(*logLevel)
+	if *debug {
+		level = slog.LevelDebug
+	}
+	var file io.WriteCloser
+	if *logFile != "" {
+		var err error
+		if file, err = logging.NewFile(*logFile); err != nil {
+			slog.Warn("Cannot open log file", "path", *logFile, "error", err)
+		} else {
+			defer file.Close()
+		}
+	}
+	logger := logging.New(os.Stderr, file, level)
+	slog.SetDefault(logger)
+	if levelErr != nil {
+		logger.Warn("Invalid log level, using info", "error", levelErr)
+	}
+
+	logger.Info("Agent starting", "version", version, "socket", *socketPath, "pid", os.Getpid())
 
-	// 创建 Unix socket server
+	// 创建 Unix socket server，升级后重启或由 systemd 激活时沿用已有的 socket
 	server := tunnel.NewUnixServer(*socketPath)
-	if err := server.Listen(); err != nil {
-		log.Fatalf("Failed to listen: %v", err)
+	activated, err := listen(server)
+	if err != nil {
+		logger.Error("Failed to listen", "socket", *socketPath, "error", err)
+		os.Exit(1)
+	}
+	logger.Info("Listening", "socket", *socketPath, "socket_activated", activated)
+
+	if *pidFile != "" {
+		if err := writePidFile(*pidFile); err != nil {
+			logger.Warn("Cannot write pid file", "path", *pidFile, "error", err)
+		}
 	}
-	log.Printf("Listening on %s", *socketPath)
 
 	// 创建 gRPC server
-	grpcServer := grpcLib.NewServer()
-	pb.RegisterDevPodWSLServiceServer(grpcServer, grpc.NewWSLServer())
+	wslServer := grpc.NewWSLServer()
+	wslServer.Version = version
+	wslServer.SocketPath = *socketPath
+	wslServer.WorkspaceRoot = *workspaceRoot
+	upgraded := make(chan string, 1)
+	if exe, err := os.Executable(); err == nil {
+		wslServer.Executable = exe
+		wslServer.OnUpgrade = func(path string) { upgraded <- path }
+	} else {
+		logger.Warn("Self-update disabled, cannot find the agent executable", "error", err)
+	}
+	grpcServer := grpcLib.NewServer(wslServer.ServerOptions()...)
+	pb.RegisterDevPodWSLServiceServer(grpcServer, wslServer)
+	if *fileRoot == "" {
+		*fileRoot = *workspaceRoot
+	}
+	fileServer := grpc.NewFileServer(*fileRoot)
+	pb.RegisterFileServiceServer(grpcServer, fileServer)
 
 	// 在 goroutine 中启动 gRPC server
 	go func() {
 		// 创建 tunnel listener (包装 Unix socket)
 		listener := tunnel.NewUnixListener(server)
 		if err := grpcServer.Serve(listener); err != nil {
-			log.Printf("gRPC server error: %v", err)
+			logger.Error("gRPC server error", "error", err)
 		}
 	}()
 
-	log.Printf("Agent started")
+	// 可选的 HTTP 指标端点，同样的内容也可以通过 Metrics RPC 获取
+	var metricsServer *http.Server
+	if *metricsAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", wslServer.MetricsHandler())
+		metricsServer = &http.Server{Addr: *metricsAddr, Handler: mux}
+		go func() {
+			if err := metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				logger.Error("Metrics server error", "addr", *metricsAddr, "error", err)
+			}
+		}()
+		logger.Info("Serving metrics", "addr", *metricsAddr)
+	}
+
+	logger.Info("Agent started")
 
 	// 设置信号处理
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-	<-sigChan
+	var upgradePath string
+	var handover *os.File
+	select {
+	case sig := <-sigChan:
+		logger.Info("Agent stopping", "signal", sig.String(), "drain_timeout", *drainTimeout)
+	case upgradePath = <-upgraded:
+		// socket 必须在 gRPC server 关闭 listener 之前交出去
+		var err error
+		if handover, err = server.Handover(); err != nil {
+			logger.Error("Cannot hand over the socket, stopping instead", "error", err)
+			upgradePath = ""
+		} else {
+			logger.Info("Agent restarting after upgrade", "path", upgradePath, "drain_timeout", *drainTimeout)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), *drainTimeout)
+	defer cancel()
+	// Watch 流不会自己结束，先关掉它们，GracefulStop 才不用等到超时
+	fileServer.Shutdown()
+	drainErr := wslServer.Shutdown(ctx)
+
+	// 命令退出后 Exec 流随之结束；超时后仍有流未结束时强制停止
+	stopped := make(chan struct{})
+	go func() {
+		grpcServer.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		grpcServer.Stop()
+	}
 
-	log.Printf("Agent stopping...")
-	grpcServer.GracefulStop()
+	if metricsServer != nil {
+		metricsServer.Close()
+	}
 	server.Close()
-	log.Printf("Agent stopped")
+
+	if upgradePath != "" {
+		// 成功时不会返回，pid 不变，pid 文件保留
+		err := reexec(upgradePath, handover, activated)
+		logger.Error("Restart after upgrade failed", "error", err)
+		removeSocket(logger, *socketPath, activated)
+		removeFile(logger, *pidFile)
+		os.Exit(1)
+	}
+	removeSocket(logger, *socketPath, activated)
+	removeFile(logger, *pidFile)
+
+	if drainErr != nil {
+		logger.Error("Agent stopped without draining", "error", drainErr)
+		os.Exit(1)
+	}
+	logger.Info("Agent stopped")
+}
+
+// listen 在 socket 上监听，返回 socket 是否由 systemd 持有。
+// 由 systemd 激活时使用它传入的 socket；升级重启时新进程从 listenFDEnv
+// 继承监听 socket。这两种情况都不删除也不重新创建 socket 文件，等待中的连接不会丢失
+func listen(server *tunnel.UnixServer) (bool, error) {
+	if os.Getenv("LISTEN_PID") == strconv.Itoa(os.Getpid()) {
+		// 不传给 agent 启动的命令
+		os.Unsetenv("LISTEN_PID")
+		os.Unsetenv("LISTEN_FDS")
+		os.Unsetenv("LISTEN_FDNAMES")
+		return true, server.Inherit(os.NewFile(systemdFD, "systemd"))
+	}
+
+	fdEnv := os.Getenv(listenFDEnv)
+	if fdEnv == "" {
+		return false, server.Listen()
+	}
+	os.Unsetenv(listenFDEnv)
+	fd, err := strconv.Atoi(fdEnv)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s %q", listenFDEnv, fdEnv)
+	}
+	return false, server.Inherit(os.NewFile(uintptr(fd), "listener"))
+}
+
+// removeSocket 删除 socket 文件，由 systemd 持有的 socket 留给 systemd 管理
+func removeSocket(logger *slog.Logger, path string, activated bool) {
+	if !activated {
+		removeFile(logger, path)
+	}
+}
+
+// writePidFile 记录 agent 的 pid，便于在发行版内找到并停止它
+func writePidFile(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(strconv.Itoa(os.Getpid())+"\n"), 0o644)
+}
+
+// removeFile 删除关闭时留下的文件，文件已经不存在时忽略
+func removeFile(logger *slog.Logger, path string) {
+	if path == "" {
+		return
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		logger.Warn("Cannot remove file", "path", path, "error", err)
+	}
+}
+
+// printHealth 调用运行中 agent 的 Health RPC 并输出 JSON，供 Windows 上的
+// provider 通过 wsl.exe 读取。agent 不可达或有检查报 error 时返回非零退出码
+func printHealth(socketPath string) int {
+	client, err := grpc.NewClient(socketPath, 5*time.Second)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	health, err := client.Health(ctx)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	fmt.Println(protojson.Format(health))
+	if health.Status == grpc.HealthError {
+		return 1
+	}
+	return 0
 }
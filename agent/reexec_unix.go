@@ -0,0 +1,36 @@
+//go:build !windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// reexec 用新的 agent 替换当前进程，pid 不变。监听 socket 去掉 close-on-exec
+// 标志后通过 listenFDEnv 传给新进程；由 systemd 激活的 socket 仍按 socket
+// 激活的方式传递，新进程同样不会删除它。成功时不会返回
+func reexec(path string, listener *os.File, activated bool) error {
+	fd := int(listener.Fd())
+	if activated && fd != systemdFD {
+		if err := unix.Dup2(fd, systemdFD); err != nil {
+			return fmt.Errorf("move socket to fd %d: %w", systemdFD, err)
+		}
+		fd = systemdFD
+	}
+	if _, err := unix.FcntlInt(uintptr(fd), unix.F_SETFD, 0); err != nil {
+		return fmt.Errorf("clear close-on-exec: %w", err)
+	}
+
+	env := os.Environ()
+	if activated {
+		env = append(env, "LISTEN_PID="+strconv.Itoa(os.Getpid()), "LISTEN_FDS=1")
+	} else {
+		env = append(env, fmt.Sprintf("%s=%d", listenFDEnv, fd))
+	}
+	return syscall.Exec(path, append([]string{path}, os.Args[1:]...), env)
+}
@@ -0,0 +1,13 @@
+//go:build windows
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// reexec agent 只运行在 WSL 内，Windows 上不支持原地重启
+func reexec(path string, listener *os.File, activated bool) error {
+	return errors.New("restarting in place is not supported on windows")
+}
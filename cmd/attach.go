@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	grpcClient "github.com/cosysn/devpod-provider-wsl/pkg/grpc"
+	"github.com/cosysn/devpod-provider-wsl/pkg/wsl"
+	"github.com/loft-sh/devpod/pkg/log"
+	"github.com/spf13/cobra"
+)
+
+// AttachCmd holds the cmd flags
+type AttachCmd struct{}
+
+// NewAttachCmd defines an attach command
+func NewAttachCmd() *cobra.Command {
+	cmd := &AttachCmd{}
+	attachCmd := &cobra.Command{
+		Use:   "attach <session-id>",
+		Short: "Reattach to a running command session",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			wslProvider, err := wsl.NewProvider(context.Background(), log.Default)
+			if err != nil {
+				return err
+			}
+
+			return cmd.Run(
+				context.Background(),
+				wslProvider,
+				args[0],
+				log.Default,
+			)
+		},
+	}
+
+	return attachCmd
+}
+
+// Run 连接 agent 并重新 attach 到会话，输出 scrollback 后继续转发输入输出
+func (cmd *AttachCmd) Run(
+	ctx context.Context,
+	providerWsl *wsl.WslProvider,
+	sessionID string,
+	logs log.Logger,
+) error {
+	// Windows 上命令直接通过 wsl.exe 运行，不经过 agent 会话
+	if isWindows() {
+		return fmt.Errorf("attach is only supported for commands run through the agent")
+	}
+
+	socketPath := providerWsl.Config.SocketPath
+	client, err := grpcClient.NewClient(socketPath, 10*time.Second)
+	if err != nil {
+		return fmt.Errorf("connect to agent: %w", err)
+	}
+	defer client.Close()
+
+	ctx, requestID := grpcClient.WithRequestID(ctx, "")
+	logs.Debugf("Attaching to session %s (request %s)", sessionID, requestID)
+	stream, err := client.Attach(ctx, sessionID)
+	if err != nil {
+		return fmt.Errorf("attach failed: %w", err)
+	}
+	return streamSession(stream, logs)
+}
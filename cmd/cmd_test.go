@@ -9,6 +9,14 @@ import (
 	"github.com/spf13/cobra"
 )
 
+var (
+	initCmd    = NewInitCmd()
+	commandCmd = NewCommandCmd()
+	startCmd   = NewStartCmd()
+	stopCmd    = NewStopCmd()
+	statusCmd  = NewStatusCmd()
+)
+
 func TestRootCmd_HasSubcommands(t *testing.T) {
 	tests := []struct {
 		name string
@@ -23,11 +31,11 @@ func TestRootCmd_HasSubcommands(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			cmds := []string{
-				InitCmd.Use,
-				CommandCmd.Use,
-				StartCmd.Use,
-				StopCmd.Use,
-				StatusCmd.Use,
+				initCmd.Use,
+				commandCmd.Use,
+				startCmd.Use,
+				stopCmd.Use,
+				statusCmd.Use,
 			}
 			for i, want := range tt.want {
 				if cmds[i] != want {
@@ -44,11 +52,11 @@ func TestRootCmd_HelpOutput(t *testing.T) {
 	}
 
 	rootCmd.AddCommand(
-		InitCmd,
-		CommandCmd,
-		StartCmd,
-		StopCmd,
-		StatusCmd,
+		initCmd,
+		commandCmd,
+		startCmd,
+		stopCmd,
+		statusCmd,
 	)
 
 	tests := []struct {
@@ -63,27 +71,27 @@ func TestRootCmd_HelpOutput(t *testing.T) {
 		},
 		{
 			name:    "init help",
-			command: InitCmd,
+			command: initCmd,
 			want:    "init",
 		},
 		{
 			name:    "command help",
-			command: CommandCmd,
+			command: commandCmd,
 			want:    "command",
 		},
 		{
 			name:    "start help",
-			command: StartCmd,
+			command: startCmd,
 			want:    "start",
 		},
 		{
 			name:    "stop help",
-			command: StopCmd,
+			command: stopCmd,
 			want:    "stop",
 		},
 		{
 			name:    "status help",
-			command: StatusCmd,
+			command: statusCmd,
 			want:    "status",
 		},
 	}
@@ -106,9 +114,9 @@ func TestRootCmd_HelpOutput(t *testing.T) {
 
 func TestInitCmd_Help(t *testing.T) {
 	buf := new(bytes.Buffer)
-	InitCmd.SetOut(buf)
-	InitCmd.SetErr(buf)
-	InitCmd.Help()
+	initCmd.SetOut(buf)
+	initCmd.SetErr(buf)
+	initCmd.Help()
 
 	output := buf.String()
 	tests := []struct {
@@ -140,9 +148,9 @@ func TestInitCmd_Help(t *testing.T) {
 
 func TestCommandCmd_Help(t *testing.T) {
 	buf := new(bytes.Buffer)
-	CommandCmd.SetOut(buf)
-	CommandCmd.SetErr(buf)
-	CommandCmd.Help()
+	commandCmd.SetOut(buf)
+	commandCmd.SetErr(buf)
+	commandCmd.Help()
 
 	output := buf.String()
 	tests := []struct {
@@ -174,9 +182,9 @@ func TestCommandCmd_Help(t *testing.T) {
 
 func TestStartCmd_Help(t *testing.T) {
 	buf := new(bytes.Buffer)
-	StartCmd.SetOut(buf)
-	StartCmd.SetErr(buf)
-	StartCmd.Help()
+	startCmd.SetOut(buf)
+	startCmd.SetErr(buf)
+	startCmd.Help()
 
 	output := buf.String()
 	tests := []struct {
@@ -208,9 +216,9 @@ func TestStartCmd_Help(t *testing.T) {
 
 func TestStopCmd_Help(t *testing.T) {
 	buf := new(bytes.Buffer)
-	StopCmd.SetOut(buf)
-	StopCmd.SetErr(buf)
-	StopCmd.Help()
+	stopCmd.SetOut(buf)
+	stopCmd.SetErr(buf)
+	stopCmd.Help()
 
 	output := buf.String()
 	tests := []struct {
@@ -242,9 +250,9 @@ func TestStopCmd_Help(t *testing.T) {
 
 func TestStatusCmd_Help(t *testing.T) {
 	buf := new(bytes.Buffer)
-	StatusCmd.SetOut(buf)
-	StatusCmd.SetErr(buf)
-	StatusCmd.Help()
+	statusCmd.SetOut(buf)
+	statusCmd.SetErr(buf)
+	statusCmd.Help()
 
 	output := buf.String()
 	tests := []struct {
@@ -2,20 +2,22 @@ package cmd
 
 import (
 	"context"
-	"encoding/base64"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"os/signal"
 	"runtime"
-	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/cosysn/devpod-provider-wsl/pkg/agent"
-	"github.com/cosysn/devpod-provider-wsl/pkg/tunnel"
+	"github.com/cosysn/devpod-provider-wsl/pkg/env"
 	grpcClient "github.com/cosysn/devpod-provider-wsl/pkg/grpc"
 	pb "github.com/cosysn/devpod-provider-wsl/pkg/grpc/proto"
+	"github.com/cosysn/devpod-provider-wsl/pkg/options"
 	"github.com/cosysn/devpod-provider-wsl/pkg/wsl"
 	"github.com/loft-sh/devpod/pkg/log"
 	"github.com/loft-sh/devpod/pkg/provider"
@@ -30,7 +32,7 @@ func NewCommandCmd() *cobra.Command {
 	cmd := &CommandCmd{}
 	commandCmd := &cobra.Command{
 		Use:   "command",
-		Short: "Command an instance",
+		Short: "Establish persistent pipe to WSL",
 		RunE: func(_ *cobra.Command, args []string) error {
 			wslProvider, err := wsl.NewProvider(context.Background(), log.Default)
 			if err != nil {
@@ -49,6 +51,9 @@ func NewCommandCmd() *cobra.Command {
 	return commandCmd
 }
 
+// forwardedSignals 是需要转发给远端命令的信号
+var forwardedSignals = []os.Signal{os.Interrupt, syscall.SIGTERM, syscall.SIGHUP}
+
 // isWindows 检测当前是否运行在 Windows 上
 func isWindows() bool {
 	return runtime.GOOS == "windows"
@@ -61,8 +66,6 @@ func (cmd *CommandCmd) Run(
 	machine *provider.Machine,
 	logs log.Logger,
 ) error {
-	distro := providerWsl.Config.WSLDistro
-
 	// 获取原始指令
 	targetCommand := os.Getenv("COMMAND")
 	if targetCommand == "" {
@@ -70,27 +73,33 @@ func (cmd *CommandCmd) Run(
 		os.Exit(1)
 	}
 
+	// 获取 agent：本地文件 > 嵌入 > 下载，全部失败时报告尝试过的来源
+	agentData, err := agent.Load(ctx, providerWsl.Config)
+	if err != nil {
+		return fmt.Errorf("get agent: %w", err)
+	}
+
 	if isWindows() {
-		return cmd.runOnWindows(ctx, distro, targetCommand, logs)
+		return cmd.runOnWindows(ctx, providerWsl.Config, targetCommand, agentData, logs)
 	}
-	return cmd.runOnLinux(ctx, distro, targetCommand, logs)
+	return cmd.runOnLinux(ctx, providerWsl.Config, targetCommand, agentData, logs)
 }
 
 // runOnWindows Windows 环境下执行命令
 func (cmd *CommandCmd) runOnWindows(
 	ctx context.Context,
-	distro, targetCommand string,
+	config *options.Options,
+	targetCommand string,
+	agentData []byte,
 	logs log.Logger,
 ) error {
 	// 注入 agent 到 WSL
-	agentData, err := agent.GetAgent()
-	if err != nil {
-		return fmt.Errorf("get embedded agent: %w", err)
+	if err := agent.InstallAgent(agentData, config.WSLDistro); err != nil {
+		return fmt.Errorf("install agent: %w", err)
 	}
-	if len(agentData) > 0 {
-		if err := agent.InstallAgent(agentData, distro); err != nil {
-			return fmt.Errorf("install agent: %w", err)
-		}
+	// 命令不经过 agent 的 socket，AGENT_SYSTEMD 只在发行版内运行时生效
+	if config.AgentSystemd {
+		logs.Debugf("%s only applies when the provider runs inside the distribution, ignoring it", options.AGENT_SYSTEMD)
 	}
 
 	// 净化环境
@@ -98,48 +107,80 @@ func (cmd *CommandCmd) runOnWindows(
 	os.Setenv("WSL_PROXY", "0")
 	os.Setenv("DONT_SET_WSL_PROXY", "1")
 
-	// 检测命令是否需要 base64 编码（inject script 有 ping-pong）
-	needsDecode := isInjectScript(targetCommand)
-
-	var wslArgs []string
-
-	if needsDecode {
-		// Inject script：先 decode 再 source（保持函数定义）
-		encodedCmd := base64.StdEncoding.EncodeToString([]byte(targetCommand))
-		scriptFile := "/tmp/devpod-inject.sh"
-		wslArgs = []string{"-d", distro, "bash", "-c",
-			fmt.Sprintf("echo '%s' | base64 -d > %s && source %s", encodedCmd, scriptFile, scriptFile)}
-	} else {
-		// SSH 或直接命令：通过 stdin 传递命令
-		// 直接执行，不经过 base64
-		wslArgs = []string{"-d", distro, "-e", "bash", "--login", "-c", targetCommand}
+	// 命令统一写入 WSL 内的唯一临时文件再 source 执行：
+	// 内容走 stdin，不受引号和命令行长度影响，并发调用也互不覆盖
+	w := &wsl.WSL{Distro: config.WSLDistro, User: config.WSLUser}
+
+	// 环境变量通过 WSLENV 传入，不写入脚本文件
+	fileEnv, err := w.ReadEnvFile(config.EnvFile())
+	if err != nil {
+		return err
 	}
+	vars := env.Merge(config.WorkspaceEnv, fileEnv)
 
-	wslcmd := exec.CommandContext(ctx, "wsl.exe", wslArgs...)
+	scriptPath, err := w.WriteScript(ctx, targetCommand)
+	if err != nil {
+		return err
+	}
+
+	wslcmd := w.ScriptCommand(ctx, scriptPath)
+	wsl.SetEnv(wslcmd, vars)
 
 	// 直接连接 stdin/stdout/stderr
 	wslcmd.Stdin = os.Stdin
 	wslcmd.Stdout = os.Stdout
 	wslcmd.Stderr = os.Stderr
 
+	if err := wslcmd.Start(); err != nil {
+		w.RemoveScript(scriptPath)
+		return fmt.Errorf("failed to start wsl: %w", err)
+	}
+
+	// Ctrl-C 由控制台同时送达 wsl.exe，它会转发给 Linux 进程。SIGTERM 和
+	// SIGHUP 不会送达 Linux 进程组：这里不知道它的 pid，只能等待宽限期，
+	// 命令仍未退出时强制结束 wsl.exe
+	done := make(chan struct{})
+	var received syscall.Signal
+	var killed bool
+	var receivedLock sync.Mutex
 	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	signal.Notify(sigChan, forwardedSignals...)
+	defer signal.Stop(sigChan)
 	go func() {
+		var escalate <-chan time.Time
 		for {
 			select {
-			case <-sigChan:
+			case sig := <-sigChan:
+				receivedLock.Lock()
+				if received == 0 {
+					received = sig.(syscall.Signal)
+					escalate = time.After(grpcClient.KillGracePeriod)
+				}
+				receivedLock.Unlock()
+			case <-escalate:
+				receivedLock.Lock()
+				killed = true
+				receivedLock.Unlock()
 				wslcmd.Process.Kill()
-			case <-ctx.Done():
+			case <-done:
 				return
 			}
 		}
 	}()
 
-	if err := wslcmd.Start(); err != nil {
-		return fmt.Errorf("failed to start wsl: %w", err)
-	}
-
 	err = wslcmd.Wait()
+	close(done)
+	// 脚本退出时会自行删除，这里兜底处理 exec 或被 kill 的情况
+	w.RemoveScript(scriptPath)
+
+	// wsl.exe 返回 Linux 命令的退出码，即使收到过信号也以它为准；只有
+	// wsl.exe 被强制结束时才按信号生成 128+signal
+	receivedLock.Lock()
+	sig, wasKilled := received, killed
+	receivedLock.Unlock()
+	if wasKilled {
+		os.Exit(grpcClient.ExitCodeForSignal(sig))
+	}
 	if err != nil {
 		if exitError, ok := err.(*exec.ExitError); ok {
 			os.Exit(exitError.ExitCode())
@@ -150,81 +191,132 @@ func (cmd *CommandCmd) runOnWindows(
 	return nil
 }
 
-// isInjectScript 检测命令是否是 inject script（需要 base64 decode）
-func isInjectScript(cmd string) bool {
-	// Inject script 通常包含特定的 ping-pong 模式
-	if strings.Contains(cmd, "DEVPOD_PING") && strings.Contains(cmd, "read") {
-		return true
-	}
-	// 如果命令看起来像 base64 编码的（长度较长，只含特定字符）
-	if len(cmd) > 200 {
-		// 尝试验证是否是有效的 base64
-		if _, err := base64.StdEncoding.DecodeString(cmd); err == nil {
-			// 解码后检查是否包含 inject script 特征
-			decoded, _ := base64.StdEncoding.DecodeString(cmd)
-			if strings.Contains(string(decoded), "DEVPOD_PING") {
-				return true
-			}
-		}
-	}
-	// 简单命令不需要 decode
-	return false
-}
-
 // runOnLinux Linux 环境下使用 tunnel (Unix socket + gRPC)
 func (cmd *CommandCmd) runOnLinux(
 	ctx context.Context,
-	distro, targetCommand string,
+	config *options.Options,
+	targetCommand string,
+	agentData []byte,
 	logs log.Logger,
 ) error {
-	socketPath := tunnel.DefaultSocketPath
-
 	// 1. 注入 agent 到本地
-	agentData, err := agent.GetAgent()
+	installed, err := agent.InstallAgentLocal(agentData)
 	if err != nil {
-		return fmt.Errorf("get embedded agent: %w", err)
+		return fmt.Errorf("install agent: %w", err)
 	}
-	if len(agentData) > 0 {
-		if err := agent.InstallAgentLocal(agentData); err != nil {
-			return fmt.Errorf("install agent: %w", err)
-		}
+	if installed {
 		logs.Infof("Agent installed to %s", agent.AgentPath)
 	}
 
-	// 2. 启动 agent
-	logs.Infof("Starting agent...")
-	agentCmd := exec.CommandContext(ctx, agent.AgentPath)
-	agentCmd.Stdout = os.Stdout
-	agentCmd.Stderr = os.Stderr
-	if err := agentCmd.Start(); err != nil {
-		return fmt.Errorf("start agent: %w", err)
+	// 2. 启动 agent：可以时由 systemd 用户服务按需启动，否则作为子进程启动
+	socketPath := config.SocketPath
+	agentArgs := []string{"-socket", socketPath, "-workspace-root", config.WorkspaceRoot, "-log-level", config.LogLevel}
+	service := agentService(config, agentArgs, installed, logs)
+	if service == nil {
+		logs.Infof("Starting agent...")
+		if debug {
+			agentArgs = append(agentArgs, "-debug")
+		}
+		agentCmd := exec.CommandContext(ctx, agent.AgentPath, agentArgs...)
+		// agent 的输出不能混入命令的 stdout
+		agentCmd.Stdout = os.Stderr
+		agentCmd.Stderr = os.Stderr
+		if err := agentCmd.Start(); err != nil {
+			return fmt.Errorf("start agent: %w", err)
+		}
 	}
 
 	// 3. 连接 gRPC
+	// NewClient 会等待 agent 创建 socket 并就绪
 	logs.Infof("Connecting to %s...", socketPath)
-	time.Sleep(1 * time.Second) // 等待 agent 启动
-
 	client, err := grpcClient.NewClient(socketPath, 10*time.Second)
+	if err != nil && service != nil {
+		// 服务卡住或 socket 单元没有运行时重启一次
+		logs.Warnf("Agent is not responding, restarting %s: %v", agent.ServiceUnit, err)
+		if restartErr := service.Restart(); restartErr != nil {
+			logs.Warnf("Restart agent service: %v", restartErr)
+		} else {
+			client, err = grpcClient.NewClient(socketPath, 10*time.Second)
+		}
+	}
 	if err != nil {
 		return fmt.Errorf("connect to agent: %w", err)
 	}
 	defer client.Close()
 
 	// 4. 使用 Exec RPC 进行交互式命令执行
-	logs.Infof("Executing: %s", targetCommand)
+	// 请求 ID 同时出现在 provider 和 agent 的日志里
+	ctx, requestID := grpcClient.WithRequestID(ctx, "")
+	logs.Infof("Executing (request %s): %s", requestID, config.WorkspaceEnv.Redact(targetCommand))
 	execClient, err := client.Exec(ctx)
 	if err != nil {
 		return fmt.Errorf("exec failed: %w", err)
 	}
 
-	// 发送命令
+	// 发送命令，user 为空时以 agent 的用户运行；.env 文件由 agent 在 WSL 内读取
 	if err := execClient.Send(&pb.ExecRequest{
-		Data: &pb.ExecRequest_Input{Input: targetCommand + "\n"},
+		Data:        &pb.ExecRequest_Input{Input: targetCommand + "\n"},
+		User:        config.WSLUser,
+		ProviderEnv: config.WorkspaceEnv.Map(),
+		SecretNames: config.WorkspaceEnv.SecretNames(),
+		EnvFile:     config.EnvFile(),
 	}); err != nil {
 		return fmt.Errorf("send command failed: %w", err)
 	}
 
-	// 5. 并行处理：转发 stdin 和接收 stdout
+	return streamSession(execClient, logs)
+}
+
+// agentService 在设置了 AGENT_SYSTEMD 且发行版运行 systemd 时，把 agent 注册为
+// socket 激活的用户服务并返回它，restart 为 true 时重启正在运行的旧 agent。
+// 返回 nil 时由调用方直接启动 agent
+func agentService(config *options.Options, args []string, restart bool, logs log.Logger) *agent.Service {
+	if !config.AgentSystemd {
+		return nil
+	}
+	if !agent.SystemdAvailable() {
+		logs.Debugf("systemd is not running, starting the agent directly")
+		return nil
+	}
+	service, err := agent.NewService(config.SocketPath, args)
+	if err == nil {
+		err = service.Ensure(restart)
+	}
+	if err != nil {
+		logs.Warnf("Cannot run the agent as a systemd service, starting it directly: %v", err)
+		return nil
+	}
+	logs.Debugf("Agent runs as systemd user service %s", agent.ServiceUnit)
+	return service
+}
+
+// streamSession 在 Exec 或 Attach 流上转发 stdin 和信号并输出命令结果，
+// 命令以非零状态退出时按相同退出码退出
+func streamSession(execClient pb.DevPodWSLService_ExecClient, logs log.Logger) error {
+	// gRPC 流不允许多个 goroutine 同时 Send，信号和 stdin 的发送需要串行
+	var sendLock sync.Mutex
+	send := func(req *pb.ExecRequest) error {
+		sendLock.Lock()
+		defer sendLock.Unlock()
+		return execClient.Send(req)
+	}
+
+	// 把本地收到的信号转发给远端进程组，由 agent 负责超时后升级为 SIGKILL
+	var received atomic.Int32
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, forwardedSignals...)
+	defer signal.Stop(sigChan)
+	go func() {
+		for sig := range sigChan {
+			number := int32(sig.(syscall.Signal))
+			received.CompareAndSwap(0, number)
+			send(&pb.ExecRequest{
+				Data: &pb.ExecRequest_Signal{Signal: &pb.Signal{Number: number}},
+			})
+		}
+	}()
+
+	// 并行处理：转发 stdin 和接收 stdout
 	var wg sync.WaitGroup
 	stdinDone := make(chan struct{})
 
@@ -236,7 +328,7 @@ func (cmd *CommandCmd) runOnLinux(
 		for {
 			n, err := os.Stdin.Read(buf)
 			if n > 0 {
-				execClient.Send(&pb.ExecRequest{
+				send(&pb.ExecRequest{
 					Data: &pb.ExecRequest_Input{Input: string(buf[:n])},
 				})
 			}
@@ -245,7 +337,7 @@ func (cmd *CommandCmd) runOnLinux(
 				select {
 				case <-stdinDone:
 					// 接收已经结束，发送 EOF 关闭 stdin
-					execClient.Send(&pb.ExecRequest{
+					send(&pb.ExecRequest{
 						Data: &pb.ExecRequest_Eof{},
 					})
 				default:
@@ -261,18 +353,32 @@ func (cmd *CommandCmd) runOnLinux(
 
 	// Stdout 接收循环
 	stdinClosed := false
+	exitCode := 0
 	for {
 		resp, err := execClient.Recv()
 		if err == io.EOF {
 			// 标记接收已结束
 			close(stdinDone)
 			stdinClosed = true
+			// 没有收到退出码就结束的流按收到的信号生成退出码
+			if sig := received.Load(); sig != 0 {
+				exitCode = grpcClient.ExitCodeForSignal(syscall.Signal(sig))
+			}
 			break
 		}
 		if err != nil {
+			if sig := received.Load(); sig != 0 {
+				os.Exit(grpcClient.ExitCodeForSignal(syscall.Signal(sig)))
+			}
 			return fmt.Errorf("recv failed: %w", err)
 		}
 
+		if resp.SessionId != "" {
+			logs.Infof("Session %s, reattach with: devpod-provider-wsl attach %s", resp.SessionId, resp.SessionId)
+		}
+		if resp.Notice != "" {
+			logs.Warnf("Agent: %s", resp.Notice)
+		}
 		if len(resp.Stdout) > 0 {
 			os.Stdout.Write(resp.Stdout)
 		}
@@ -281,6 +387,7 @@ func (cmd *CommandCmd) runOnLinux(
 		}
 		if resp.Done {
 			// 命令执行完成
+			exitCode = int(resp.ExitCode)
 			close(stdinDone)
 			stdinClosed = true
 			break
@@ -292,6 +399,12 @@ func (cmd *CommandCmd) runOnLinux(
 		close(stdinDone)
 	}
 
+	// 使用 agent 报告的退出码：被信号终止时它已经是 128+signal，捕获信号后
+	// 正常退出的命令保留自己的退出码。只有流中断时才按收到的信号生成退出码
+	if exitCode != 0 {
+		os.Exit(exitCode)
+	}
+
 	// 等待 stdin goroutine 结束
 	wg.Wait()
 
@@ -7,15 +7,15 @@ import (
 )
 
 func TestCommandCmd_Use(t *testing.T) {
-	if CommandCmd.Use != "command" {
-		t.Errorf("CommandCmd.Use = %q, want %q", CommandCmd.Use, "command")
+	if commandCmd.Use != "command" {
+		t.Errorf("commandCmd.Use = %q, want %q", commandCmd.Use, "command")
 	}
 }
 
 func TestCommandCmd_Short(t *testing.T) {
 	want := "Establish persistent pipe to WSL"
-	if CommandCmd.Short != want {
-		t.Errorf("CommandCmd.Short = %q, want %q", CommandCmd.Short, want)
+	if commandCmd.Short != want {
+		t.Errorf("commandCmd.Short = %q, want %q", commandCmd.Short, want)
 	}
 }
 
@@ -2,7 +2,9 @@ package cmd
 
 import (
 	"context"
+	"fmt"
 
+	"github.com/cosysn/devpod-provider-wsl/pkg/options"
 	"github.com/cosysn/devpod-provider-wsl/pkg/wsl"
 	"github.com/loft-sh/devpod/pkg/log"
 	"github.com/loft-sh/devpod/pkg/provider"
@@ -43,6 +45,46 @@ func (cmd *CreateCmd) Run(
 	machine *provider.Machine,
 	logs log.Logger,
 ) error {
-	logs.Infof("Deleting workspace in WSL distribution '%s'...", providerWsl.Config.WSLDistro)
+	config := providerWsl.Config
+	logs.Infof("Creating workspace in WSL distribution '%s'...", config.WSLDistro)
+	if config.GitRepository != "" {
+		if err := cmd.clone(ctx, config, logs); err != nil {
+			return err
+		}
+	}
+	if err := runLifecycleHooks(ctx, config, true, logs); err != nil {
+		return err
+	}
+	if config.DotfilesRepository != "" {
+		w := &wsl.WSL{Distro: config.WSLDistro, User: config.WSLUser}
+		logs.Infof("Installing dotfiles from %s...", options.RedactURL(config.DotfilesRepository))
+		err := w.InstallDotfiles(ctx, config.DotfilesRepository, config.DotfilesScript, func(line string) { logs.Infof("%s", line) })
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// clone clones GIT_REPOSITORY into the workspace directory
+func (cmd *CreateCmd) clone(ctx context.Context, config *options.Options, logs log.Logger) error {
+	dir := config.WorkspaceDir()
+	if dir == "" {
+		return fmt.Errorf("%s is required to clone %s", options.MACHINE_ID, options.GIT_REPOSITORY)
+	}
+	w := &wsl.WSL{Distro: config.WSLDistro, User: config.WSLUser}
+	logs.Infof("Cloning %s into %s...", options.RedactURL(config.GitRepository), dir)
+	err := w.Clone(ctx, wsl.CloneOptions{
+		URL:              config.GitRepository,
+		Dir:              dir,
+		Branch:           config.GitBranch,
+		Commit:           config.GitCommit,
+		Shallow:          config.GitShallow,
+		CredentialHelper: config.GitCredentialHelper,
+	}, func(line string) { logs.Infof("%s", line) })
+	if err != nil {
+		return err
+	}
+	logs.Infof("Cloned %s", options.RedactURL(config.GitRepository))
 	return nil
 }
@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/cosysn/devpod-provider-wsl/pkg/agent"
+	"github.com/cosysn/devpod-provider-wsl/pkg/diagnostics"
+	grpcClient "github.com/cosysn/devpod-provider-wsl/pkg/grpc"
+	pb "github.com/cosysn/devpod-provider-wsl/pkg/grpc/proto"
+	"github.com/cosysn/devpod-provider-wsl/pkg/options"
+	"github.com/cosysn/devpod-provider-wsl/pkg/preflight"
+	"github.com/cosysn/devpod-provider-wsl/pkg/wsl"
+	"github.com/loft-sh/devpod/pkg/log"
+	"github.com/spf13/cobra"
+)
+
+// DiagnoseCmd holds the cmd flags
+type DiagnoseCmd struct {
+	Output string
+}
+
+// NewDiagnoseCmd defines a diagnose command
+func NewDiagnoseCmd() *cobra.Command {
+	cmd := &DiagnoseCmd{}
+	diagnoseCmd := &cobra.Command{
+		Use:   "diagnose",
+		Short: "Collect a support bundle of the WSL environment",
+		RunE: func(_ *cobra.Command, args []string) error {
+			return cmd.Run(context.Background(), log.Default)
+		},
+	}
+
+	diagnoseCmd.Flags().StringVarP(&cmd.Output, "output", "o", "", "Bundle path, defaults to devpod-provider-wsl-diagnostics-<time>.zip")
+	return diagnoseCmd
+}
+
+// Run 收集诊断信息，打印摘要并写出 zip 包。单项收集失败只记录在包里，不会中断
+func (cmd *DiagnoseCmd) Run(ctx context.Context, logs log.Logger) error {
+	// MACHINE_FOLDER 只在机器命令中设置，诊断时不要求
+	config, err := options.FromEnv(false, false)
+	if err != nil {
+		return err
+	}
+
+	w := &wsl.WSL{Distro: config.WSLDistro, User: config.WSLUser}
+	sources := diagnostics.Sources{
+		Preflight: func(ctx context.Context) *preflight.Report {
+			return preflight.Run(ctx, config.WSLDistro, preflight.ChecksFromOptions(w, config), false)
+		},
+	}
+	// 和 command 一样按 本地文件 > 嵌入 > 下载 的顺序确定要安装的 agent
+	if checksum, err := agent.Checksum(ctx, agent.SourcesFromOptions(config, "")); err == nil {
+		sources.AgentChecksum = checksum
+	} else {
+		logs.Debugf("Resolve agent checksum: %v", err)
+	}
+	if path, err := providerLogFile(); err == nil {
+		sources.ProviderLog = path
+	}
+	// Windows 上 socket 在发行版内部，和 status 一样通过 agent -health 获取
+	sources.AgentStatus = func(ctx context.Context) (*pb.AgentStatus, error) {
+		if isWindows() {
+			health, err := agentHealth(ctx, config.SocketPath, w)
+			if err != nil {
+				return nil, err
+			}
+			return &pb.AgentStatus{Running: true, Pid: health.Pid, Version: health.Version, Sessions: health.Sessions}, nil
+		}
+		client, err := grpcClient.NewClient(config.SocketPath, 5*time.Second)
+		if err != nil {
+			return nil, err
+		}
+		defer client.Close()
+		return client.Status(ctx)
+	}
+
+	logs.Infof("Collecting diagnostics for %s", config.WSLDistro)
+	bundle := diagnostics.Collect(ctx, diagnostics.StepsFromOptions(w, config, sources))
+
+	output := cmd.Output
+	if output == "" {
+		output = fmt.Sprintf("devpod-provider-wsl-diagnostics-%s.zip", bundle.Created.Format("20060102-150405"))
+	}
+	f, err := os.OpenFile(output, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return fmt.Errorf("create bundle: %w", err)
+	}
+	if err := bundle.WriteZip(f); err != nil {
+		f.Close()
+		return fmt.Errorf("write bundle: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("write bundle: %w", err)
+	}
+
+	if err := bundle.WriteSummary(os.Stdout); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(os.Stdout, "\nWrote %s\n", output)
+	return err
+}
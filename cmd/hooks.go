@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"context"
+	"strings"
+
+	"github.com/cosysn/devpod-provider-wsl/pkg/devcontainer"
+	"github.com/cosysn/devpod-provider-wsl/pkg/env"
+	"github.com/cosysn/devpod-provider-wsl/pkg/options"
+	"github.com/cosysn/devpod-provider-wsl/pkg/wsl"
+	"github.com/loft-sh/devpod/pkg/log"
+)
+
+// runLifecycleHooks runs the workspace's devcontainer.json lifecycle
+// commands: the create commands followed by postStartCommand after create,
+// only postStartCommand on start. Workspaces without a machine or without
+// devcontainer.json have nothing to run.
+func runLifecycleHooks(ctx context.Context, config *options.Options, created bool, logs log.Logger) error {
+	dir := config.WorkspaceDir()
+	if dir == "" {
+		return nil
+	}
+	w := &wsl.WSL{Distro: config.WSLDistro, User: config.WSLUser}
+	dc, err := w.ReadDevcontainer(dir)
+	if err != nil {
+		return err
+	}
+	if dc == nil {
+		logs.Debugf("No devcontainer.json in %s", dir)
+		return nil
+	}
+
+	var hooks []devcontainer.Hook
+	if created {
+		if ids := dc.FeatureIDs(); len(ids) > 0 {
+			logs.Warnf("Features need a container and are not installed in WSL workspaces, ignoring %s", strings.Join(ids, ", "))
+		}
+		hooks = dc.CreateHooks()
+	}
+	hooks = append(hooks, dc.StartHooks()...)
+	if len(hooks) == 0 {
+		return nil
+	}
+
+	fileEnv, err := w.ReadEnvFile(config.EnvFile())
+	if err != nil {
+		return err
+	}
+	vars := env.Merge(config.WorkspaceEnv, fileEnv)
+	for _, hook := range hooks {
+		logs.Infof("Running %s...", hook.Name)
+		if err := w.RunHook(ctx, dir, dc, hook, vars, func(line string) { logs.Infof("%s", line) }); err != nil {
+			return err
+		}
+	}
+	return nil
+}
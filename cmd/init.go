@@ -6,6 +6,7 @@ import (
 	"os"
 
 	"github.com/cosysn/devpod-provider-wsl/pkg/options"
+	"github.com/cosysn/devpod-provider-wsl/pkg/preflight"
 	"github.com/cosysn/devpod-provider-wsl/pkg/wsl"
 	"github.com/loft-sh/devpod/pkg/log"
 	"github.com/loft-sh/devpod/pkg/provider"
@@ -13,14 +14,17 @@ import (
 )
 
 // InitCmd holds the cmd flags
-type InitCmd struct{}
+type InitCmd struct {
+	Fix  bool
+	JSON bool
+}
 
 // NewInitCmd defines a init
 func NewInitCmd() *cobra.Command {
 	cmd := &InitCmd{}
 	initCmd := &cobra.Command{
 		Use:   "init",
-		Short: "Init account",
+		Short: "Check the WSL environment",
 		RunE: func(_ *cobra.Command, args []string) error {
 			return cmd.Run(
 				context.Background(),
@@ -30,6 +34,8 @@ func NewInitCmd() *cobra.Command {
 		},
 	}
 
+	initCmd.Flags().BoolVar(&cmd.Fix, "fix", false, "Try to fix failed checks, e.g. install missing tools")
+	initCmd.Flags().BoolVar(&cmd.JSON, "json", false, "Print the preflight report as JSON")
 	return initCmd
 }
 
@@ -45,45 +51,32 @@ func (cmd *InitCmd) Run(
 	}
 
 	distro := config.WSLDistro
-	if distro == "" {
-		return fmt.Errorf("WSL_DISTRO environment variable is required")
-	}
-
-	w := wsl.WSL{Distro: distro}
+	w := &wsl.WSL{Distro: distro, User: config.WSLUser}
 
-	// 1. Check WSL version
-	fmt.Fprintln(os.Stdout, "Checking WSL version...")
-	version, err := w.Version()
-	if err != nil {
-		return fmt.Errorf("wsl not available: %w", err)
-	}
-	if version < 2 {
-		return fmt.Errorf("wsl 2 is required, got version %d", version)
-	}
-	fmt.Fprintf(os.Stdout, "  WSL version: %d\n", version)
-
-	// 2. Check distribution exists
-	fmt.Fprintln(os.Stdout, "Checking distribution...")
+	// The distribution has to exist before anything else can be checked
 	if !w.Exists() {
 		return fmt.Errorf("distribution '%s' not found", distro)
 	}
-	fmt.Fprintf(os.Stdout, "  Distribution '%s' found\n", distro)
 
-	// 3. Check disk space
-	fmt.Fprintln(os.Stdout, "Checking disk space...")
-	if err := w.CheckDiskSpace(5); err != nil {
-		return fmt.Errorf("disk space check failed: %w", err)
+	// Remove command scripts left behind by killed or crashed commands
+	if removed, err := w.CleanStaleScripts(wsl.StaleScriptAge); err != nil {
+		logs.Warnf("Clean stale command scripts: %v", err)
+	} else if removed > 0 {
+		logs.Debugf("Removed %d stale command scripts", removed)
 	}
-	fmt.Fprintln(os.Stdout, "  Disk space: OK (>= 5GB)")
 
-	// 4. Check required tools
-	fmt.Fprintln(os.Stdout, "Checking required tools...")
-	requiredTools := []string{"git", "curl"}
-	if err := w.CheckTools(requiredTools); err != nil {
-		return fmt.Errorf("tool check failed: %w", err)
+	report := preflight.Run(ctx, distro, preflight.ChecksFromOptions(w, config), cmd.Fix)
+	if cmd.JSON {
+		err = report.WriteJSON(os.Stdout)
+	} else {
+		err = report.WriteTable(os.Stdout)
+	}
+	if err != nil {
+		return err
 	}
-	fmt.Fprintf(os.Stdout, "  Tools: OK (%v)\n", requiredTools)
 
-	fmt.Fprintln(os.Stdout, "\nWSL environment check passed!")
+	if !report.Passed {
+		return fmt.Errorf("WSL environment check failed")
+	}
 	return nil
 }
@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cosysn/devpod-provider-wsl/pkg/logging"
+	"github.com/cosysn/devpod-provider-wsl/pkg/options"
+	"github.com/loft-sh/devpod/pkg/log"
+	"github.com/sirupsen/logrus"
+)
+
+// logLevels maps LOG_LEVEL values to logrus levels
+var logLevels = map[string]logrus.Level{
+	"debug": logrus.DebugLevel,
+	"info":  logrus.InfoLevel,
+	"warn":  logrus.WarnLevel,
+	"error": logrus.ErrorLevel,
+}
+
+// logLevel returns the level from LOG_LEVEL, --debug wins. Invalid values
+// fall back to info here and are reported when the options are parsed.
+func logLevel(debug bool) logrus.Level {
+	if debug {
+		return logrus.DebugLevel
+	}
+	if level, ok := logLevels[strings.ToLower(strings.TrimSpace(os.Getenv(options.LOG_LEVEL)))]; ok {
+		return level
+	}
+	return logrus.InfoLevel
+}
+
+// setupLogging replaces log.Default so stdout only carries protocol output:
+// messages go to stderr and, as JSON lines, to a rotating log file below
+// the provider data dir. A log file that can't be opened is skipped.
+func setupLogging(debug bool) {
+	level := logLevel(debug)
+	logger := log.NewStdoutLogger(os.Stdin, os.Stderr, os.Stderr, level)
+	logger.MakeRaw()
+
+	if path, err := providerLogFile(); err == nil {
+		file, err := logging.NewFile(path)
+		if err == nil {
+			logger.AddSink(log.NewStreamLoggerWithFormat(file, file, level, log.JSONFormat))
+		}
+	}
+
+	log.Default = logger
+}
+
+// providerLogFile returns the provider's log file below the data dir
+func providerLogFile() (string, error) {
+	dataDir, err := options.DataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dataDir, "logs", "provider.log"), nil
+}
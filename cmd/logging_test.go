@@ -0,0 +1,29 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/cosysn/devpod-provider-wsl/pkg/options"
+	"github.com/sirupsen/logrus"
+)
+
+func TestLogLevel(t *testing.T) {
+	tests := []struct {
+		env   string
+		debug bool
+		want  logrus.Level
+	}{
+		{env: "", want: logrus.InfoLevel},
+		{env: "WARN", want: logrus.WarnLevel},
+		{env: "error", want: logrus.ErrorLevel},
+		{env: "verbose", want: logrus.InfoLevel},
+		{env: "error", debug: true, want: logrus.DebugLevel},
+	}
+
+	for _, tt := range tests {
+		t.Setenv(options.LOG_LEVEL, tt.env)
+		if got := logLevel(tt.debug); got != tt.want {
+			t.Errorf("logLevel(%v) with LOG_LEVEL=%q = %v, want %v", tt.debug, tt.env, got, tt.want)
+		}
+	}
+}
@@ -9,6 +9,9 @@ import (
 	"golang.org/x/crypto/ssh"
 )
 
+// debug is set by the --debug flag
+var debug bool
+
 // NewRootCmd returns a new root command
 func NewRootCmd() *cobra.Command {
 	wslCmd := &cobra.Command{
@@ -18,12 +21,14 @@ func NewRootCmd() *cobra.Command {
 		SilenceUsage:  true,
 
 		PersistentPreRunE: func(cobraCmd *cobra.Command, args []string) error {
-			log.Default.MakeRaw()
+			setupLogging(debug)
 
 			return nil
 		},
 	}
 
+	wslCmd.PersistentFlags().BoolVar(&debug, "debug", false, "Enable debug logging, overrides LOG_LEVEL")
+
 	return wslCmd
 }
 
@@ -63,6 +68,8 @@ func BuildRoot() *cobra.Command {
 	rootCmd.AddCommand(NewStartCmd())
 	rootCmd.AddCommand(NewStopCmd())
 	rootCmd.AddCommand(NewStatusCmd())
+	rootCmd.AddCommand(NewAttachCmd())
+	rootCmd.AddCommand(NewDiagnoseCmd())
 
 	return rootCmd
 }
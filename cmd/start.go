@@ -59,16 +59,16 @@ func (cmd *StartCmd) Run(
 	// Check if already running
 	status := w.Status()
 	if status == "Running" {
-		fmt.Printf("Distribution '%s' is already running\n", distro)
-		return nil
+		logs.Infof("Distribution '%s' is already running", distro)
+	} else {
+		// Start the distribution
+		logs.Infof("Starting distribution '%s'...", distro)
+		if err := w.Start(); err != nil {
+			return fmt.Errorf("start failed: %w", err)
+		}
+		logs.Infof("Distribution '%s' started successfully", distro)
 	}
 
-	// Start the distribution
-	fmt.Printf("Starting distribution '%s'...\n", distro)
-	if err := w.Start(); err != nil {
-		return fmt.Errorf("start failed: %w", err)
-	}
-
-	fmt.Printf("Distribution '%s' started successfully\n", distro)
-	return nil
+	// postStartCommand runs on every start of the workspace
+	return runLifecycleHooks(ctx, providerWsl.Config, false, logs)
 }
@@ -1,18 +1,38 @@
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
+	"os"
+	"strings"
+	"time"
 
 	"context"
 
+	"github.com/cosysn/devpod-provider-wsl/pkg/agent"
+	grpcClient "github.com/cosysn/devpod-provider-wsl/pkg/grpc"
+	pb "github.com/cosysn/devpod-provider-wsl/pkg/grpc/proto"
 	"github.com/cosysn/devpod-provider-wsl/pkg/wsl"
 	"github.com/loft-sh/devpod/pkg/log"
 	"github.com/loft-sh/devpod/pkg/provider"
 	"github.com/spf13/cobra"
+	"google.golang.org/protobuf/encoding/protojson"
 )
 
 // StatusCmd holds the cmd flags
-type StatusCmd struct{}
+type StatusCmd struct {
+	JSON bool
+}
+
+// statusReport is the --json output of the status command
+type statusReport struct {
+	State string `json:"state"`
+	// Agent is the agent's Health RPC response
+	Agent      json.RawMessage `json:"agent,omitempty"`
+	AgentError string          `json:"agentError,omitempty"`
+	// AgentService is the systemd state of the agent service when AGENT_SYSTEMD is used
+	AgentService string `json:"agentService,omitempty"`
+}
 
 // NewStatusCmd defines a status command
 func NewStatusCmd() *cobra.Command {
@@ -35,6 +55,7 @@ func NewStatusCmd() *cobra.Command {
 		},
 	}
 
+	statusCmd.Flags().BoolVar(&cmd.JSON, "json", false, "Print the status and the agent health as JSON")
 	return statusCmd
 }
 
@@ -52,7 +73,79 @@ func (cmd *StatusCmd) Run(
 
 	w := wsl.WSL{Distro: distro}
 
+	// DevPod reads the status from stdout, logs go to stderr
 	status := w.Status()
-	logs.Infof(status)
-	return nil
+	if !cmd.JSON {
+		_, err := fmt.Fprintln(os.Stdout, status)
+		return err
+	}
+
+	report := statusReport{State: status}
+	// 发行版停止时不查询 agent，否则 wsl.exe 会把它重新启动
+	if status == "Running" {
+		health, err := agentHealth(ctx, providerWsl.Config.SocketPath, &w)
+		if err == nil {
+			report.Agent, err = protojson.Marshal(health)
+		}
+		if err != nil {
+			report.AgentError = err.Error()
+		}
+		report.AgentService = agentServiceState(providerWsl.Config.SocketPath, providerWsl.Config.AgentSystemd)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
+
+// agentHealth 获取 agent 的 Health 结果。Linux 上直接连接 socket，Windows 上
+// socket 在发行版内部，通过 wsl.exe 运行 agent -health
+func agentHealth(ctx context.Context, socketPath string, w *wsl.WSL) (*pb.HealthResponse, error) {
+	if isWindows() {
+		// 只解析 stdout，agent 的日志和 wsl.exe 的警告在 stderr 上
+		output, stderr, err := w.Output(fmt.Sprintf("%s -health -socket %s", wsl.ShellQuote(agent.AgentPath), wsl.ShellQuote(socketPath)))
+		health := &pb.HealthResponse{}
+		// 有检查报 error 时 agent 以 1 退出，但输出仍然是完整的结果
+		if jsonErr := protojson.Unmarshal(output, health); jsonErr != nil {
+			if err == nil {
+				err = jsonErr
+			}
+			if message := strings.TrimSpace(string(stderr)); message != "" {
+				return nil, fmt.Errorf("agent health: %w: %s", err, message)
+			}
+			return nil, fmt.Errorf("agent health: %w", err)
+		}
+		return health, nil
+	}
+
+	client, err := grpcClient.NewClient(socketPath, 5*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("connect to agent: %w", err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	health, err := client.Health(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("agent health: %w", err)
+	}
+	return health, nil
+}
+
+// agentServiceState 返回 agent 的 systemd 服务状态，agent 不是作为服务运行时为空。
+// Windows 上的 provider 不管理服务
+func agentServiceState(socketPath string, enabled bool) string {
+	if !enabled || isWindows() {
+		return ""
+	}
+	service, err := agent.NewService(socketPath, nil)
+	if err != nil || !service.Installed() {
+		return ""
+	}
+	state, err := service.State()
+	if err != nil {
+		return "unknown"
+	}
+	return state
 }
@@ -55,16 +55,16 @@ func (cmd *StopCmd) Run(
 	// Check if running
 	status := w.Status()
 	if status != "Running" {
-		fmt.Printf("Distribution '%s' is not running\n", distro)
+		logs.Infof("Distribution '%s' is not running", distro)
 		return nil
 	}
 
 	// Stop the distribution
-	fmt.Printf("Stopping distribution '%s'...\n", distro)
+	logs.Infof("Stopping distribution '%s'...", distro)
 	if err := w.Stop(); err != nil {
 		return fmt.Errorf("stop failed: %w", err)
 	}
 
-	fmt.Printf("Distribution '%s' stopped successfully\n", distro)
+	logs.Infof("Distribution '%s' stopped successfully", distro)
 	return nil
 }
@@ -46,7 +46,8 @@ if errorlevel 1 (
     exit /b 1
 )
 
-REM Cleanup
+REM Keep the agent as download source (AGENT_URL), then cleanup
+copy /y pkg\agent\agent-linux "release\devpod-agent-linux-amd64" >nul
 del pkg\agent\agent-linux
 
 REM Step 3: Generate provider.yaml
@@ -20,7 +20,8 @@ cp agent-linux pkg/agent/agent-linux
 mkdir -p release
 GOOS=windows GOARCH=amd64 go build -ldflags="${LDFLAGS}" -tags=embed -o release/devpod-provider-wsl-amd64.exe .
 
-# 清理临时文件
+# 保留 agent 作为下载源（AGENT_URL），清理临时文件
+cp agent-linux release/devpod-agent-linux-amd64
 rm -f agent-linux pkg/agent/agent-linux
 
 # Step 3: 生成 provider.yaml
@@ -33,4 +34,5 @@ echo "Build complete!"
 echo "========================================"
 echo ""
 echo "Binary: release/devpod-provider-wsl-amd64.exe"
+echo "Agent: release/devpod-agent-linux-amd64"
 echo "Provider: provider.yaml"
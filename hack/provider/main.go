@@ -11,6 +11,7 @@ import (
 
 var checksumMap = map[string]string{
 	"./release/devpod-provider-wsl-amd64.exe": "##CHECKSUM_WINDOWS_AMD64##",
+	"./release/devpod-agent-linux-amd64":      "##CHECKSUM_AGENT_LINUX_AMD64##",
 }
 
 func main() {
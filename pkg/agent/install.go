@@ -63,23 +63,26 @@ func chmodAgent(distro string) error {
 
 // Linux 版本函数
 
-// InstallAgentLocal 在本地 Linux 安装 agent
-func InstallAgentLocal(data []byte) error {
-	if needsUpgradeLocal() {
-		if err := removeAgentLocal(); err != nil {
-			return fmt.Errorf("remove old agent: %w", err)
-		}
+// InstallAgentLocal 在本地 Linux 安装 agent，返回是否写入了新的 agent。
+// 版本一致时不覆盖，作为 systemd 服务运行的 agent 可能正在使用这个文件
+func InstallAgentLocal(data []byte) (bool, error) {
+	if !needsUpgradeLocal() {
+		return false, nil
+	}
+	// 先删除再写入，正在运行的旧 agent 继续使用原来的文件
+	if err := removeAgentLocal(); err != nil {
+		return false, fmt.Errorf("remove old agent: %w", err)
 	}
 
 	if err := writeAgentLocal(data); err != nil {
-		return fmt.Errorf("write agent: %w", err)
+		return false, fmt.Errorf("write agent: %w", err)
 	}
 
 	if err := chmodAgentLocal(); err != nil {
-		return fmt.Errorf("chmod agent: %w", err)
+		return false, fmt.Errorf("chmod agent: %w", err)
 	}
 
-	return nil
+	return true, nil
 }
 
 func needsUpgradeLocal() bool {
@@ -0,0 +1,241 @@
+package agent
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cosysn/devpod-provider-wsl/pkg/options"
+)
+
+// ErrSourceUnavailable 表示该来源未配置，Resolve 会继续尝试下一个来源
+var ErrSourceUnavailable = errors.New("not configured")
+
+// Source 提供 Linux agent 二进制
+type Source interface {
+	// Name 用于错误信息中描述该来源
+	Name() string
+	// Load 返回 agent 二进制内容
+	Load(ctx context.Context) ([]byte, error)
+}
+
+// EmbeddedSource 使用编译时嵌入的 agent（-tags=embed）
+type EmbeddedSource struct{}
+
+func (EmbeddedSource) Name() string {
+	return "embedded"
+}
+
+func (EmbeddedSource) Load(ctx context.Context) ([]byte, error) {
+	data, err := GetAgent()
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("binary built without -tags=embed: %w", ErrSourceUnavailable)
+	}
+	return data, nil
+}
+
+// FileSource 从本地文件读取 agent
+type FileSource struct {
+	Path string
+}
+
+func (s FileSource) Name() string {
+	return "file " + s.Path
+}
+
+func (s FileSource) Load(ctx context.Context) ([]byte, error) {
+	if s.Path == "" {
+		return nil, ErrSourceUnavailable
+	}
+	data, err := os.ReadFile(s.Path)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("file is empty")
+	}
+	return data, nil
+}
+
+// DownloadSource 从 URL 下载 agent，校验 sha256 后缓存到 CacheDir
+type DownloadSource struct {
+	URL      string
+	Checksum string
+	CacheDir string
+	Client   *http.Client
+}
+
+func (s DownloadSource) Name() string {
+	return "download " + s.URL
+}
+
+func (s DownloadSource) Load(ctx context.Context) ([]byte, error) {
+	if s.URL == "" {
+		return nil, ErrSourceUnavailable
+	}
+	checksum := strings.ToLower(strings.TrimSpace(s.Checksum))
+	if checksum == "" {
+		return nil, fmt.Errorf("no checksum pinned for download")
+	}
+
+	// 优先使用缓存，缓存文件名包含 checksum，校验失败则重新下载
+	cachePath := ""
+	if s.CacheDir != "" {
+		cachePath = filepath.Join(s.CacheDir, "agent-"+checksum)
+		if data, err := os.ReadFile(cachePath); err == nil && sha256Hex(data) == checksum {
+			return data, nil
+		}
+	}
+
+	data, err := s.download(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if got := sha256Hex(data); got != checksum {
+		return nil, fmt.Errorf("checksum mismatch: got %s, want %s", got, checksum)
+	}
+
+	if cachePath != "" {
+		if err := writeCache(cachePath, data); err != nil {
+			return nil, fmt.Errorf("cache agent: %w", err)
+		}
+	}
+	return data, nil
+}
+
+func (s DownloadSource) download(ctx context.Context) ([]byte, error) {
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// writeCache 先写临时文件再 rename，避免并发下载时读到半个文件
+func writeCache(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// SourceError 列出所有尝试过的来源及其失败原因
+type SourceError struct {
+	Tried []string
+	Errs  []error
+}
+
+func (e *SourceError) Error() string {
+	if len(e.Tried) == 0 {
+		return "no agent source configured"
+	}
+	parts := make([]string, len(e.Tried))
+	for i := range e.Tried {
+		parts[i] = e.Tried[i] + ": " + e.Errs[i].Error()
+	}
+	return "no agent binary available (tried " + strings.Join(parts, "; ") + ")"
+}
+
+// Resolve 依次尝试各来源，返回第一个成功的 agent
+func Resolve(ctx context.Context, sources []Source) ([]byte, error) {
+	sourceErr := &SourceError{}
+	for _, source := range sources {
+		data, err := source.Load(ctx)
+		if err == nil {
+			return data, nil
+		}
+		sourceErr.Tried = append(sourceErr.Tried, source.Name())
+		sourceErr.Errs = append(sourceErr.Errs, err)
+	}
+	return nil, sourceErr
+}
+
+// Checksum 返回 Resolve 会选中的 agent 的 sha256。下载来源直接使用固定的
+// checksum，不会真正下载
+func Checksum(ctx context.Context, sources []Source) (string, error) {
+	sourceErr := &SourceError{}
+	for _, source := range sources {
+		if download, ok := source.(DownloadSource); ok {
+			if checksum := strings.ToLower(strings.TrimSpace(download.Checksum)); checksum != "" {
+				return checksum, nil
+			}
+		}
+		data, err := source.Load(ctx)
+		if err == nil {
+			return sha256Hex(data), nil
+		}
+		sourceErr.Tried = append(sourceErr.Tried, source.Name())
+		sourceErr.Errs = append(sourceErr.Errs, err)
+	}
+	return "", sourceErr
+}
+
+// SourcesFromOptions 按优先级构造来源：本地文件 > 嵌入 > 下载
+func SourcesFromOptions(opts *options.Options, cacheDir string) []Source {
+	var sources []Source
+	if opts.AgentPath != "" {
+		sources = append(sources, FileSource{Path: opts.AgentPath})
+	}
+	sources = append(sources, EmbeddedSource{})
+	if opts.AgentURL != "" {
+		sources = append(sources, DownloadSource{
+			URL:      opts.AgentURL,
+			Checksum: opts.AgentChecksum,
+			CacheDir: cacheDir,
+		})
+	}
+	return sources
+}
+
+// Load 根据 provider 选项解析 agent 二进制，下载缓存放在 provider 数据目录
+func Load(ctx context.Context, opts *options.Options) ([]byte, error) {
+	cacheDir, err := options.DataDir()
+	if err != nil {
+		cacheDir = ""
+	} else {
+		cacheDir = filepath.Join(cacheDir, "agent")
+	}
+	return Resolve(ctx, SourcesFromOptions(opts, cacheDir))
+}
@@ -0,0 +1,156 @@
+package agent
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileSource(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "agent")
+	if err := os.WriteFile(path, []byte("agent-binary"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := FileSource{Path: path}.Load(context.Background())
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if string(data) != "agent-binary" {
+		t.Errorf("Load() = %q, want %q", data, "agent-binary")
+	}
+
+	if _, err := (FileSource{Path: filepath.Join(dir, "missing")}).Load(context.Background()); err == nil {
+		t.Error("Load() expected error for missing file")
+	}
+}
+
+func TestDownloadSource(t *testing.T) {
+	payload := []byte("downloaded-agent")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(payload)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		checksum string
+		wantErr  string
+	}{
+		{
+			name:     "valid checksum",
+			checksum: sha256Hex(payload),
+		},
+		{
+			name:     "checksum mismatch",
+			checksum: sha256Hex([]byte("other")),
+			wantErr:  "checksum mismatch",
+		},
+		{
+			name:     "no checksum",
+			checksum: "",
+			wantErr:  "no checksum",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := DownloadSource{URL: server.URL, Checksum: tt.checksum, CacheDir: t.TempDir()}
+			data, err := source.Load(context.Background())
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Load() error = %v, want contains %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load failed: %v", err)
+			}
+			if string(data) != string(payload) {
+				t.Errorf("Load() = %q, want %q", data, payload)
+			}
+		})
+	}
+}
+
+func TestDownloadSource_Cache(t *testing.T) {
+	payload := []byte("cached-agent")
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write(payload)
+	}))
+	defer server.Close()
+
+	source := DownloadSource{URL: server.URL, Checksum: sha256Hex(payload), CacheDir: t.TempDir()}
+	for i := 0; i < 2; i++ {
+		if _, err := source.Load(context.Background()); err != nil {
+			t.Fatalf("Load failed: %v", err)
+		}
+	}
+	if requests != 1 {
+		t.Errorf("server got %d requests, want 1", requests)
+	}
+}
+
+func TestResolve_ReportsTriedSources(t *testing.T) {
+	sources := []Source{
+		FileSource{Path: "/nonexistent/devpod-agent"},
+		DownloadSource{URL: "http://127.0.0.1:1/agent"},
+	}
+
+	_, err := Resolve(context.Background(), sources)
+	if err == nil {
+		t.Fatal("Resolve() expected error")
+	}
+	for _, want := range []string{"file /nonexistent/devpod-agent", "download http://127.0.0.1:1/agent"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Resolve() error = %q, want contains %q", err, want)
+		}
+	}
+}
+
+func TestResolve_FirstSuccess(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agent")
+	if err := os.WriteFile(path, []byte("local"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := Resolve(context.Background(), []Source{
+		DownloadSource{},
+		FileSource{Path: path},
+	})
+	if err != nil {
+		t.Fatalf("Resolve failed: %v", err)
+	}
+	if string(data) != "local" {
+		t.Errorf("Resolve() = %q, want %q", data, "local")
+	}
+}
+
+func TestChecksum(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agent")
+	if err := os.WriteFile(path, []byte("agent-binary"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	pinned := strings.Repeat("ab", 32)
+	// The URL is never fetched, the pinned checksum is reported instead
+	download := DownloadSource{URL: "http://127.0.0.1:1/agent", Checksum: strings.ToUpper(pinned)}
+
+	got, err := Checksum(context.Background(), []Source{FileSource{Path: path}, download})
+	if err != nil || got != sha256Hex([]byte("agent-binary")) {
+		t.Errorf("Checksum() with a file = %q, %v", got, err)
+	}
+	got, err = Checksum(context.Background(), []Source{FileSource{Path: filepath.Join(t.TempDir(), "missing")}, download})
+	if err != nil || got != pinned {
+		t.Errorf("Checksum() with a download = %q, %v, want %q", got, err, pinned)
+	}
+	if _, err := Checksum(context.Background(), []Source{FileSource{}}); err == nil {
+		t.Error("Checksum() without a source should fail")
+	}
+}
@@ -0,0 +1,167 @@
+package agent
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// ServiceUnit 和 SocketUnit 是 agent 的 systemd 用户单元
+	ServiceUnit = "devpod-agent.service"
+	SocketUnit  = "devpod-agent.socket"
+)
+
+var (
+	// systemdRunDir 存在表示 systemd 作为 PID 1 运行
+	systemdRunDir = "/run/systemd/system"
+	// systemctl 可以在测试中替换
+	systemctl = "systemctl"
+)
+
+// SystemdAvailable 判断当前发行版是否启用了 systemd
+func SystemdAvailable() bool {
+	info, err := os.Stat(systemdRunDir)
+	return err == nil && info.IsDir()
+}
+
+// Service 以 socket 激活的 systemd 用户服务运行 agent：systemd 持有 socket，
+// 第一个连接到来时启动 agent，agent 退出或崩溃后下一个连接会再次启动它
+type Service struct {
+	// UnitDir 是用户单元目录，通常为 ~/.config/systemd/user
+	UnitDir string
+	// SocketPath 是 agent 监听的 socket
+	SocketPath string
+	// Args 是 agent 的命令行参数
+	Args []string
+}
+
+// NewService 返回使用当前用户单元目录的 Service
+func NewService(socketPath string, args []string) (*Service, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return nil, err
+	}
+	return &Service{
+		UnitDir:    filepath.Join(configDir, "systemd", "user"),
+		SocketPath: socketPath,
+		Args:       args,
+	}, nil
+}
+
+// Units 返回 socket 单元和 service 单元的内容
+func (s *Service) Units() (socket, service string) {
+	socket = fmt.Sprintf(`[Unit]
+Description=DevPod WSL agent socket
+
+[Socket]
+ListenStream=%s
+SocketMode=0600
+RemoveOnStop=true
+
+[Install]
+WantedBy=sockets.target
+`, s.SocketPath)
+
+	command := make([]string, 0, len(s.Args)+1)
+	for _, arg := range append([]string{AgentPath}, s.Args...) {
+		command = append(command, systemdQuote(arg))
+	}
+	// agent 自己在收到 SIGTERM 后排空会话，只给主进程发信号，
+	// 超过 drain 超时后由 systemd 结束剩下的进程
+	service = fmt.Sprintf(`[Unit]
+Description=DevPod WSL agent
+Requires=%s
+After=%s
+
+[Service]
+ExecStart=%s
+KillMode=mixed
+TimeoutStopSec=40
+Restart=on-failure
+`, SocketUnit, SocketUnit, strings.Join(command, " "))
+	return socket, service
+}
+
+// Ensure 写入单元文件并启用 socket。单元文件变化或 restart 为 true 时
+// 重启正在运行的 agent，让它使用新的参数或二进制
+func (s *Service) Ensure(restart bool) error {
+	if err := os.MkdirAll(s.UnitDir, 0o755); err != nil {
+		return err
+	}
+	socket, service := s.Units()
+	changed := false
+	for name, content := range map[string]string{SocketUnit: socket, ServiceUnit: service} {
+		path := filepath.Join(s.UnitDir, name)
+		if old, err := os.ReadFile(path); err == nil && string(old) == content {
+			continue
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			return err
+		}
+		changed = true
+	}
+
+	if changed {
+		if _, err := runSystemctl("daemon-reload"); err != nil {
+			return err
+		}
+	}
+	if _, err := runSystemctl("enable", "--now", SocketUnit); err != nil {
+		return err
+	}
+	if changed || restart {
+		// 只重启正在运行的服务，没有运行时由下一个连接启动
+		if _, err := runSystemctl("try-restart", ServiceUnit); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Installed 判断 socket 单元是否已经写入
+func (s *Service) Installed() bool {
+	_, err := os.Stat(filepath.Join(s.UnitDir, SocketUnit))
+	return err == nil
+}
+
+// State 返回 agent 服务的状态，如 active、inactive 或 failed
+func (s *Service) State() (string, error) {
+	output, err := runSystemctl("is-active", ServiceUnit)
+	state := strings.TrimSpace(string(output))
+	// 服务没有运行时 is-active 以非零状态退出，输出仍然是状态
+	if state != "" {
+		return state, nil
+	}
+	return "", err
+}
+
+// Restart 重启 agent 服务
+func (s *Service) Restart() error {
+	_, err := runSystemctl("restart", ServiceUnit)
+	return err
+}
+
+func runSystemctl(args ...string) ([]byte, error) {
+	cmd := exec.Command(systemctl, append([]string{"--user"}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return output, fmt.Errorf("systemctl %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return output, nil
+}
+
+// systemdQuote 按 systemd 的规则转义说明符和变量，并给含空白或引号的参数加引号
+func systemdQuote(arg string) string {
+	arg = strings.NewReplacer("%", "%%", "$", "$$").Replace(arg)
+	if arg != "" && !strings.ContainsAny(arg, " \t\"'\\") {
+		return arg
+	}
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+	return `"` + replacer.Replace(arg) + `"`
+}
@@ -0,0 +1,110 @@
+package agent
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeSystemctl replaces systemctl with a script that records its arguments
+// and prints state for is-active
+func fakeSystemctl(t *testing.T, state string) string {
+	t.Helper()
+	dir := t.TempDir()
+	calls := filepath.Join(dir, "calls")
+	script := filepath.Join(dir, "systemctl")
+	content := "#!/bin/sh\necho \"$*\" >> " + calls + "\n" +
+		"[ \"$2\" = is-active ] && echo " + state + " && [ " + state + " = active ]\nexit 0\n"
+	if err := os.WriteFile(script, []byte(content), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	old := systemctl
+	systemctl = script
+	t.Cleanup(func() { systemctl = old })
+	return calls
+}
+
+func readCalls(t *testing.T, path string) []string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSpace(string(data)), "\n")
+}
+
+func TestService_Units(t *testing.T) {
+	s := &Service{SocketPath: "/var/tmp/devpod.sock", Args: []string{"-socket", "/var/tmp/devpod.sock", "-workspace-root", "/home/dev/my workspaces", "-log-level", "50%"}}
+	socket, service := s.Units()
+
+	if !strings.Contains(socket, "ListenStream=/var/tmp/devpod.sock\n") {
+		t.Errorf("socket unit does not listen on the socket:\n%s", socket)
+	}
+	want := `ExecStart=/var/tmp/devpod-agent -socket /var/tmp/devpod.sock -workspace-root "/home/dev/my workspaces" -log-level 50%%`
+	if !strings.Contains(service, want+"\n") {
+		t.Errorf("service unit = \n%s\nwant line %s", service, want)
+	}
+	if !strings.Contains(service, "Requires="+SocketUnit) {
+		t.Errorf("service unit does not require the socket:\n%s", service)
+	}
+}
+
+func TestService_Ensure(t *testing.T) {
+	calls := fakeSystemctl(t, "active")
+	s := &Service{UnitDir: filepath.Join(t.TempDir(), "systemd", "user"), SocketPath: "/var/tmp/devpod.sock"}
+
+	if err := s.Ensure(false); err != nil {
+		t.Fatalf("Ensure failed: %v", err)
+	}
+	if !s.Installed() {
+		t.Error("Installed() = false after Ensure")
+	}
+	want := []string{"--user daemon-reload", "--user enable --now " + SocketUnit, "--user try-restart " + ServiceUnit}
+	if got := readCalls(t, calls); strings.Join(got, ";") != strings.Join(want, ";") {
+		t.Errorf("first Ensure ran %q, want %q", got, want)
+	}
+
+	// Unchanged units only make sure the socket is enabled
+	os.Remove(calls)
+	if err := s.Ensure(false); err != nil {
+		t.Fatal(err)
+	}
+	if got := readCalls(t, calls); len(got) != 1 || got[0] != "--user enable --now "+SocketUnit {
+		t.Errorf("second Ensure ran %q", got)
+	}
+
+	// A new agent binary restarts the running service
+	os.Remove(calls)
+	if err := s.Ensure(true); err != nil {
+		t.Fatal(err)
+	}
+	if got := readCalls(t, calls); len(got) != 2 || got[1] != "--user try-restart "+ServiceUnit {
+		t.Errorf("Ensure(restart) ran %q", got)
+	}
+}
+
+func TestService_State(t *testing.T) {
+	fakeSystemctl(t, "failed")
+	s := &Service{UnitDir: t.TempDir()}
+	if state, err := s.State(); err != nil || state != "failed" {
+		t.Errorf("State() = %q, %v, want failed", state, err)
+	}
+}
+
+func TestSystemdAvailable(t *testing.T) {
+	old := systemdRunDir
+	t.Cleanup(func() { systemdRunDir = old })
+
+	systemdRunDir = t.TempDir()
+	if !SystemdAvailable() {
+		t.Error("SystemdAvailable() = false with the run directory present")
+	}
+	systemdRunDir = filepath.Join(systemdRunDir, "missing")
+	if SystemdAvailable() {
+		t.Error("SystemdAvailable() = true without the run directory")
+	}
+}
@@ -0,0 +1,343 @@
+// Package devcontainer reads the parts of devcontainer.json that apply to a
+// workspace running directly in a WSL distribution: the lifecycle commands
+// and the environment they run with.
+package devcontainer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/cosysn/devpod-provider-wsl/pkg/env"
+)
+
+// Paths are the locations of devcontainer.json relative to the workspace,
+// in the order they are tried
+var Paths = []string{".devcontainer/devcontainer.json", ".devcontainer.json"}
+
+// Config is the subset of devcontainer.json the provider understands
+type Config struct {
+	Name                 string             `json:"name"`
+	OnCreateCommand      Command            `json:"onCreateCommand"`
+	UpdateContentCommand Command            `json:"updateContentCommand"`
+	PostCreateCommand    Command            `json:"postCreateCommand"`
+	PostStartCommand     Command            `json:"postStartCommand"`
+	Features             map[string]any     `json:"features"`
+	ContainerEnv         map[string]string  `json:"containerEnv"`
+	RemoteEnv            map[string]*string `json:"remoteEnv"`
+}
+
+// Hook is a lifecycle command together with the property it came from
+type Hook struct {
+	Name    string
+	Command Command
+}
+
+// Command is a lifecycle command. The string form is a single step run by
+// /bin/sh, the array form a single step run without a shell and the object
+// form one named step per entry, run in parallel.
+type Command []Step
+
+// Step is one command of a lifecycle command, either Shell or Args is set
+type Step struct {
+	// Name is the key of the step in the object form
+	Name  string
+	Shell string
+	Args  []string
+}
+
+// Parallel reports whether the steps come from the object form
+func (c Command) Parallel() bool {
+	return len(c) > 0 && c[0].Name != ""
+}
+
+func (c *Command) UnmarshalJSON(data []byte) error {
+	*c = nil
+	var value any
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	if named, ok := value.(map[string]any); ok {
+		names := make([]string, 0, len(named))
+		for name := range named {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			step, err := parseStep(named[name])
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			if step != nil {
+				step.Name = name
+				*c = append(*c, *step)
+			}
+		}
+		return nil
+	}
+	step, err := parseStep(value)
+	if err != nil {
+		return err
+	}
+	if step != nil {
+		*c = Command{*step}
+	}
+	return nil
+}
+
+// parseStep parses a string or array command, empty commands return nil
+func parseStep(value any) (*Step, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		if strings.TrimSpace(v) == "" {
+			return nil, nil
+		}
+		return &Step{Shell: v}, nil
+	case []any:
+		if len(v) == 0 {
+			return nil, nil
+		}
+		args := make([]string, len(v))
+		for i, arg := range v {
+			s, ok := arg.(string)
+			if !ok {
+				return nil, fmt.Errorf("command arguments must be strings, got %v", arg)
+			}
+			args[i] = s
+		}
+		return &Step{Args: args}, nil
+	}
+	return nil, fmt.Errorf("command must be a string, an array or an object, got %v", value)
+}
+
+// Parse parses devcontainer.json, which allows comments and trailing commas
+func Parse(data []byte) (*Config, error) {
+	config := &Config{}
+	if err := json.Unmarshal(standardize(data), config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// standardize turns JSON with comments into plain JSON. Comments become
+// spaces, so offsets in errors still point into the original file.
+func standardize(data []byte) []byte {
+	out := bytes.Clone(data)
+	inString := false
+	lastValue := -1 // index of a pending comma that may be trailing
+	for i := 0; i < len(out); i++ {
+		c := out[i]
+		switch {
+		case inString:
+			if c == '\\' {
+				i++
+			} else if c == '"' {
+				inString = false
+			}
+		case c == '"':
+			inString = true
+			lastValue = -1
+		case c == '/' && i+1 < len(out) && out[i+1] == '/':
+			for ; i < len(out) && out[i] != '\n'; i++ {
+				out[i] = ' '
+			}
+		case c == '/' && i+1 < len(out) && out[i+1] == '*':
+			end := bytes.Index(out[i+2:], []byte("*/"))
+			if end < 0 {
+				end = len(out) - i - 2
+			} else {
+				end += 2
+			}
+			for j := i; j < i+2+end; j++ {
+				if out[j] != '\n' {
+					out[j] = ' '
+				}
+			}
+			i += 1 + end
+		case c == ',':
+			lastValue = i
+		case c == '}' || c == ']':
+			if lastValue >= 0 {
+				out[lastValue] = ' '
+			}
+			lastValue = -1
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+		default:
+			lastValue = -1
+		}
+	}
+	return out
+}
+
+// CreateHooks returns the non-empty commands run after the workspace is
+// created, in the order the spec runs them
+func (c *Config) CreateHooks() []Hook {
+	return hooks(
+		Hook{"onCreateCommand", c.OnCreateCommand},
+		Hook{"updateContentCommand", c.UpdateContentCommand},
+		Hook{"postCreateCommand", c.PostCreateCommand},
+	)
+}
+
+// StartHooks returns the non-empty commands run every time the workspace starts
+func (c *Config) StartHooks() []Hook {
+	return hooks(Hook{"postStartCommand", c.PostStartCommand})
+}
+
+func hooks(all ...Hook) []Hook {
+	var result []Hook
+	for _, hook := range all {
+		if len(hook.Command) > 0 {
+			result = append(result, hook)
+		}
+	}
+	return result
+}
+
+// FeatureIDs returns the configured features, which can't be installed
+// without a container
+func (c *Config) FeatureIDs() []string {
+	ids := make([]string, 0, len(c.Features))
+	for id := range c.Features {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+var variableRegexp = regexp.MustCompile(`\$\{([A-Za-z]+)(?::([^}:]*)(?::([^}]*))?)?\}`)
+
+// Expand replaces the workspace folder and localEnv variables in the
+// commands with their values. The workspace is both the local and the
+// container folder.
+func (c *Config) Expand(workspaceDir string) {
+	expand := func(s string) string {
+		return variableRegexp.ReplaceAllStringFunc(s, func(match string) string {
+			m := variableRegexp.FindStringSubmatch(match)
+			switch m[1] {
+			case "localWorkspaceFolder", "containerWorkspaceFolder":
+				return workspaceDir
+			case "localWorkspaceFolderBasename", "containerWorkspaceFolderBasename":
+				return path.Base(workspaceDir)
+			case "localEnv":
+				if value, ok := os.LookupEnv(m[2]); ok {
+					return value
+				}
+				return m[3]
+			}
+			return match
+		})
+	}
+	for _, command := range []Command{c.OnCreateCommand, c.UpdateContentCommand, c.PostCreateCommand, c.PostStartCommand} {
+		for i := range command {
+			command[i].Shell = expand(command[i].Shell)
+			for j := range command[i].Args {
+				command[i].Args[j] = expand(command[i].Args[j])
+			}
+		}
+	}
+	for name, value := range c.ContainerEnv {
+		c.ContainerEnv[name] = expand(value)
+	}
+	for name, value := range c.RemoteEnv {
+		if value != nil {
+			expanded := expand(*value)
+			c.RemoteEnv[name] = &expanded
+		}
+	}
+}
+
+// ExportScript returns shell commands exporting containerEnv and then
+// remoteEnv, a null remoteEnv value unsets the variable. ${containerEnv:NAME}
+// refers to the variable as it is set in the distribution at that point.
+func (c *Config) ExportScript() string {
+	var b strings.Builder
+	export := func(vars map[string]string) {
+		names := make([]string, 0, len(vars))
+		for name := range vars {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(&b, "export %s=%s\n", name, shellValue(vars[name]))
+		}
+	}
+	export(c.ContainerEnv)
+
+	remote := map[string]string{}
+	var unset []string
+	for name, value := range c.RemoteEnv {
+		if value == nil {
+			unset = append(unset, name)
+		} else {
+			remote[name] = *value
+		}
+	}
+	export(remote)
+	sort.Strings(unset)
+	for _, name := range unset {
+		fmt.Fprintf(&b, "unset %s\n", name)
+	}
+	return b.String()
+}
+
+// Validate checks that the environment variable names can be exported
+func (c *Config) Validate() error {
+	for name := range c.ContainerEnv {
+		if !env.ValidName(name) {
+			return fmt.Errorf("containerEnv: invalid variable name %q", name)
+		}
+	}
+	for name := range c.RemoteEnv {
+		if !env.ValidName(name) {
+			return fmt.Errorf("remoteEnv: invalid variable name %q", name)
+		}
+	}
+	return nil
+}
+
+// shellValue double quotes value for the shell, turning ${containerEnv:NAME}
+// into a reference to $NAME and keeping everything else literal
+func shellValue(value string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	rest := value
+	for {
+		loc := variableRegexp.FindStringSubmatchIndex(rest)
+		if loc == nil {
+			break
+		}
+		b.WriteString(escapeDouble(rest[:loc[0]]))
+		name, def := "", ""
+		if loc[4] >= 0 {
+			name = rest[loc[4]:loc[5]]
+		}
+		if loc[6] >= 0 {
+			def = rest[loc[6]:loc[7]]
+		}
+		if rest[loc[2]:loc[3]] == "containerEnv" && env.ValidName(name) {
+			if def != "" {
+				fmt.Fprintf(&b, "${%s:-%s}", name, escapeDouble(def))
+			} else {
+				fmt.Fprintf(&b, "${%s}", name)
+			}
+		} else {
+			b.WriteString(escapeDouble(rest[loc[0]:loc[1]]))
+		}
+		rest = rest[loc[1]:]
+	}
+	b.WriteString(escapeDouble(rest))
+	b.WriteByte('"')
+	return b.String()
+}
+
+func escapeDouble(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "`", "\\`", "$", `\$`).Replace(s)
+}
@@ -0,0 +1,120 @@
+package devcontainer
+
+import (
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const sample = `{
+	// The name shown by editors
+	"name": "app", /* block
+	comment */
+	"onCreateCommand": "npm ci // not a comment",
+	"updateContentCommand": ["make", "deps"],
+	"postCreateCommand": {
+		"server": "npm run build",
+		"db": ["./db.sh", "init"],
+		"empty": "",
+	},
+	"postStartCommand": "echo ${containerWorkspaceFolderBasename} in ${localWorkspaceFolder} ${localEnv:DEVCONTAINER_TEST_UNSET:fallback}",
+	"features": {
+		"ghcr.io/devcontainers/features/node:1": {},
+		"ghcr.io/devcontainers/features/go:1": {"version": "1.24"},
+	},
+	"containerEnv": {"GREETING": "hello \"world\" $HOME"},
+	"remoteEnv": {
+		"PATH": "${containerEnv:PATH}:/opt/tools",
+		"EDITOR_HOME": "${containerEnv:EDITOR_DIR:/opt/editor}",
+		"OLD": null,
+	},
+}`
+
+func TestParse(t *testing.T) {
+	config, err := Parse([]byte(sample))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Name != "app" {
+		t.Errorf("Name = %q", config.Name)
+	}
+
+	create := config.CreateHooks()
+	var names []string
+	for _, hook := range create {
+		names = append(names, hook.Name)
+	}
+	if got := strings.Join(names, ","); got != "onCreateCommand,updateContentCommand,postCreateCommand" {
+		t.Errorf("CreateHooks() = %s", got)
+	}
+	if want := (Command{{Shell: "npm ci // not a comment"}}); !reflect.DeepEqual(create[0].Command, want) {
+		t.Errorf("onCreateCommand = %+v, want %+v", create[0].Command, want)
+	}
+	if want := (Command{{Args: []string{"make", "deps"}}}); !reflect.DeepEqual(create[1].Command, want) || create[1].Command.Parallel() {
+		t.Errorf("updateContentCommand = %+v, want %+v", create[1].Command, want)
+	}
+	// Named steps are sorted and empty ones dropped
+	want := Command{{Name: "db", Args: []string{"./db.sh", "init"}}, {Name: "server", Shell: "npm run build"}}
+	if !reflect.DeepEqual(create[2].Command, want) || !create[2].Command.Parallel() {
+		t.Errorf("postCreateCommand = %+v, want %+v", create[2].Command, want)
+	}
+
+	if got := strings.Join(config.FeatureIDs(), ","); got != "ghcr.io/devcontainers/features/go:1,ghcr.io/devcontainers/features/node:1" {
+		t.Errorf("FeatureIDs() = %s", got)
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	tests := map[string]string{
+		"syntax":        `{"name": }`,
+		"number":        `{"postCreateCommand": 1}`,
+		"array element": `{"postCreateCommand": ["ls", 1]}`,
+		"named step":    `{"postCreateCommand": {"a": true}}`,
+	}
+	for name, content := range tests {
+		if _, err := Parse([]byte(content)); err == nil {
+			t.Errorf("%s: Parse(%s) succeeded", name, content)
+		}
+	}
+
+	config, err := Parse([]byte(`{"remoteEnv": {"NOT-VALID": "x"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := config.Validate(); err == nil {
+		t.Error("Validate() accepted an invalid variable name")
+	}
+}
+
+func TestExpand(t *testing.T) {
+	config, err := Parse([]byte(sample))
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.Expand("/var/tmp/devpod/workspaces/app")
+	got := config.StartHooks()[0].Command[0].Shell
+	if want := "echo app in /var/tmp/devpod/workspaces/app fallback"; got != want {
+		t.Errorf("postStartCommand = %q, want %q", got, want)
+	}
+}
+
+func TestExportScript(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+	config, err := Parse([]byte(sample))
+	if err != nil {
+		t.Fatal(err)
+	}
+	script := config.ExportScript() + `printf '%s|%s|%s|%s' "$GREETING" "$PATH" "$EDITOR_HOME" "${OLD-unset}"`
+	cmd := exec.Command("sh", "-c", script)
+	cmd.Env = []string{"PATH=/usr/bin:/bin", "HOME=/home/dev", "OLD=1"}
+	output, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("%v\n%s", err, script)
+	}
+	if want := `hello "world" $HOME|/usr/bin:/bin:/opt/tools|/opt/editor|unset`; string(output) != want {
+		t.Errorf("exported %q, want %q", output, want)
+	}
+}
@@ -0,0 +1,118 @@
+package diagnostics
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Status is the outcome of a single collection step
+type Status string
+
+const (
+	StatusOK    Status = "ok"
+	StatusWarn  Status = "warn"
+	StatusError Status = "error"
+)
+
+// Step collects one file of the bundle. Run returns the file content and a
+// one line summary, content is kept even when Run fails.
+type Step struct {
+	Name string
+	File string
+	Run  func(ctx context.Context) (content []byte, summary string, err error)
+}
+
+// Item is the summary of a step
+type Item struct {
+	Name    string
+	File    string
+	Status  Status
+	Summary string
+}
+
+// Bundle holds the collected files and their summary
+type Bundle struct {
+	Created time.Time
+	Items   []Item
+	files   []file
+}
+
+type file struct {
+	name    string
+	content []byte
+}
+
+// Warning marks a step result that is worth a look but not a collection failure
+type Warning struct {
+	Message string
+}
+
+func (w *Warning) Error() string {
+	return w.Message
+}
+
+// Collect runs all steps, a failing step never stops the collection
+func Collect(ctx context.Context, steps []Step) *Bundle {
+	bundle := &Bundle{Created: time.Now()}
+	for _, step := range steps {
+		content, summary, err := step.Run(ctx)
+		item := Item{Name: step.Name, File: step.File, Status: StatusOK, Summary: summary}
+		if err != nil {
+			item.Status = StatusError
+			if _, ok := err.(*Warning); ok {
+				item.Status = StatusWarn
+			}
+			item.Summary = err.Error()
+			if len(content) > 0 {
+				content = append(content, '\n')
+			}
+			content = append(content, "error: "+err.Error()+"\n"...)
+		}
+		bundle.Items = append(bundle.Items, item)
+		bundle.files = append(bundle.files, file{name: step.File, content: content})
+	}
+	return bundle
+}
+
+// WriteSummary writes a human readable summary table
+func (b *Bundle) WriteSummary(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ITEM\tSTATUS\tSUMMARY")
+	for _, item := range b.Items {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", item.Name, strings.ToUpper(string(item.Status)), firstLine(item.Summary))
+	}
+	return tw.Flush()
+}
+
+// WriteZip writes every collected file plus summary.txt as a zip archive
+func (b *Bundle) WriteZip(w io.Writer) error {
+	zw := zip.NewWriter(w)
+
+	summary := &strings.Builder{}
+	fmt.Fprintf(summary, "devpod-provider-wsl diagnostics, collected %s\n\n", b.Created.Format(time.RFC3339))
+	if err := b.WriteSummary(summary); err != nil {
+		return err
+	}
+
+	files := append([]file{{name: "summary.txt", content: []byte(summary.String())}}, b.files...)
+	for _, f := range files {
+		fw, err := zw.CreateHeader(&zip.FileHeader{Name: f.name, Method: zip.Deflate, Modified: b.Created})
+		if err != nil {
+			return err
+		}
+		if _, err := fw.Write(f.content); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(s), "\n")
+	return line
+}
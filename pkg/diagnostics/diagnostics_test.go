@@ -0,0 +1,227 @@
+package diagnostics
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cosysn/devpod-provider-wsl/pkg/agent"
+	"github.com/cosysn/devpod-provider-wsl/pkg/env"
+	pb "github.com/cosysn/devpod-provider-wsl/pkg/grpc/proto"
+	"github.com/cosysn/devpod-provider-wsl/pkg/options"
+	"github.com/cosysn/devpod-provider-wsl/pkg/preflight"
+)
+
+const checksum = "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+// fakeDistro answers scripts by their first word
+type fakeDistro struct {
+	outputs map[string]string
+	errs    map[string]error
+	scripts []string
+}
+
+func (f *fakeDistro) VersionInfo() (string, error) {
+	return "WSL version: 2.3.26.0\nKernel version: 5.15.167.4-1\n", nil
+}
+
+func (f *fakeDistro) ListVerbose() (string, error) {
+	return "  NAME      STATE           VERSION\n* Ubuntu    Running         2\n  Debian    Stopped         2\n", nil
+}
+
+func (f *fakeDistro) Run(script string) ([]byte, error) {
+	f.scripts = append(f.scripts, script)
+	word, _, _ := strings.Cut(script, " ")
+	return []byte(f.outputs[word]), f.errs[word]
+}
+
+func testOptions() *options.Options {
+	return &options.Options{
+		WSLDistro:  "Ubuntu",
+		SocketPath: "/tmp/devpod-wsl.sock",
+		WorkspaceEnv: env.Merge(
+			env.FromMap(map[string]string{"EDITOR": "vim"}, false),
+			env.FromMap(map[string]string{"TOKEN": "s3cr3t"}, true),
+		),
+	}
+}
+
+func readZip(t *testing.T, data []byte) map[string]string {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("open zip: %v", err)
+	}
+	files := map[string]string{}
+	for _, f := range zr.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatalf("open %s: %v", f.Name, err)
+		}
+		content, _ := io.ReadAll(r)
+		r.Close()
+		files[f.Name] = string(content)
+	}
+	return files
+}
+
+func TestCollect_KeepsGoingAfterFailures(t *testing.T) {
+	steps := []Step{
+		{Name: "ok", File: "ok.txt", Run: func(ctx context.Context) ([]byte, string, error) {
+			return []byte("fine"), "all good", nil
+		}},
+		{Name: "warn", File: "warn.txt", Run: func(ctx context.Context) ([]byte, string, error) {
+			return []byte("partial"), "", &Warning{Message: "look at this"}
+		}},
+		{Name: "broken", File: "broken.txt", Run: func(ctx context.Context) ([]byte, string, error) {
+			return nil, "", errors.New("exit status 1")
+		}},
+	}
+
+	bundle := Collect(context.Background(), steps)
+	want := []Status{StatusOK, StatusWarn, StatusError}
+	for i, item := range bundle.Items {
+		if item.Status != want[i] {
+			t.Errorf("%s: status = %s, want %s", item.Name, item.Status, want[i])
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	if err := bundle.WriteZip(buf); err != nil {
+		t.Fatalf("WriteZip: %v", err)
+	}
+	files := readZip(t, buf.Bytes())
+	if files["warn.txt"] != "partial\nerror: look at this\n" {
+		t.Errorf("warn.txt = %q", files["warn.txt"])
+	}
+	if files["broken.txt"] != "error: exit status 1\n" {
+		t.Errorf("broken.txt = %q", files["broken.txt"])
+	}
+	for _, line := range []string{"ok      OK      all good", "warn    WARN    look at this", "broken  ERROR   exit status 1"} {
+		if !strings.Contains(files["summary.txt"], line) {
+			t.Errorf("summary.txt is missing %q:\n%s", line, files["summary.txt"])
+		}
+	}
+}
+
+func TestStepsFromOptions(t *testing.T) {
+	logFile := filepath.Join(t.TempDir(), "provider.log")
+	if err := os.WriteFile(logFile, []byte(strings.Repeat("x", LogTail)+"last line\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	d := &fakeDistro{
+		outputs: map[string]string{
+			"uname": "Linux ubuntu 5.15.167.4-microsoft-standard-WSL2",
+			"df":    "Filesystem Size Used Avail Use% Mounted on",
+			"ls":    "-rwxr-xr-x 1 root root 123 " + agent.AgentPath + "\n" + checksum + "  " + agent.AgentPath + "\nv1.2.3\n",
+			"tail":  "agent log",
+		},
+		errs: map[string]error{},
+	}
+	sources := Sources{
+		AgentStatus: func(ctx context.Context) (*pb.AgentStatus, error) {
+			return &pb.AgentStatus{Running: true, Pid: 42, Version: "v1.2.3", Sessions: 2}, nil
+		},
+		AgentChecksum: checksum,
+		ProviderLog:   logFile,
+		Preflight: func(ctx context.Context) *preflight.Report {
+			return &preflight.Report{Distro: "Ubuntu", Passed: true}
+		},
+	}
+
+	bundle := Collect(context.Background(), StepsFromOptions(d, testOptions(), sources))
+	items := map[string]Item{}
+	for _, item := range bundle.Items {
+		items[item.Name] = item
+		if item.Status != StatusOK && item.Name != "agent-socket" {
+			t.Errorf("%s: status = %s (%s)", item.Name, item.Status, item.Summary)
+		}
+	}
+	if got := items["distributions"].Summary; got != "Ubuntu is running, WSL 2" {
+		t.Errorf("distributions summary = %q", got)
+	}
+	if got := items["agent-status"].Summary; got != "version v1.2.3, pid 42, 2 sessions" {
+		t.Errorf("agent-status summary = %q", got)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := bundle.WriteZip(buf); err != nil {
+		t.Fatalf("WriteZip: %v", err)
+	}
+	files := readZip(t, buf.Bytes())
+	for _, name := range []string{"summary.txt", "wsl/version.txt", "wsl/list.txt", "options.txt", "distro/info.txt",
+		"distro/disk.txt", "agent/binary.txt", "agent/socket.txt", "agent/status.json", "logs/agent.log",
+		"logs/provider.log", "preflight.json"} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("bundle is missing %s", name)
+		}
+	}
+	if strings.Contains(files["options.txt"], "s3cr3t") {
+		t.Errorf("options.txt leaks a secret:\n%s", files["options.txt"])
+	}
+	if !strings.Contains(files["options.txt"], "WORKSPACE_ENV=EDITOR=vim TOKEN="+env.Redacted) {
+		t.Errorf("options.txt = %s", files["options.txt"])
+	}
+	if got := files["logs/provider.log"]; len(got) != LogTail || !strings.HasSuffix(got, "last line\n") {
+		t.Errorf("provider.log has %d bytes, want the last %d", len(got), LogTail)
+	}
+}
+
+func TestFormatOptions_CredentialHelper(t *testing.T) {
+	opts := &options.Options{
+		WorkspaceEnv:        env.New(),
+		GitCredentialHelper: "!f() { echo password=s3cr3t; }; f",
+	}
+	got := FormatOptions(opts)
+	if strings.Contains(got, "s3cr3t") || !strings.Contains(got, "GIT_CREDENTIAL_HELPER="+env.Redacted+"\n") {
+		t.Errorf("FormatOptions() = %s", got)
+	}
+	if got := FormatOptions(&options.Options{WorkspaceEnv: env.New()}); !strings.Contains(got, "GIT_CREDENTIAL_HELPER=\n") {
+		t.Errorf("FormatOptions() without a helper = %s", got)
+	}
+}
+
+func TestStepsFromOptions_AgentProblems(t *testing.T) {
+	d := &fakeDistro{
+		outputs: map[string]string{
+			"ls": strings.Repeat("f", 64) + "  " + agent.AgentPath + "\nv0.0.1\n",
+		},
+		errs: map[string]error{},
+	}
+	steps := StepsFromOptions(d, testOptions(), Sources{AgentChecksum: checksum})
+	bundle := Collect(context.Background(), steps)
+
+	for _, item := range bundle.Items {
+		switch item.Name {
+		case "agent-binary":
+			if item.Status != StatusWarn || !strings.Contains(item.Summary, "differs") {
+				t.Errorf("agent-binary = %s %q, want a checksum warning", item.Status, item.Summary)
+			}
+		case "agent-status", "provider-log", "preflight":
+			t.Errorf("step %s should be skipped without a source", item.Name)
+		}
+	}
+
+	// Both agent steps run ls, so failing it hits the binary and the socket
+	d.errs["ls"] = errors.New("exit status 2")
+	for _, item := range Collect(context.Background(), steps).Items {
+		if (item.Name == "agent-binary" || item.Name == "agent-socket") && item.Status != StatusWarn {
+			t.Errorf("%s = %s, want warn", item.Name, item.Status)
+		}
+	}
+}
+
+func TestSocketStep_QuotesPath(t *testing.T) {
+	d := &fakeDistro{outputs: map[string]string{}, errs: map[string]error{}}
+	socketStep(d, "/tmp/a b; touch /tmp/pwned").Run(context.Background())
+	if len(d.scripts) != 1 || d.scripts[0] != `ls -l '/tmp/a b; touch /tmp/pwned' && test -S '/tmp/a b; touch /tmp/pwned'` {
+		t.Errorf("scripts = %q", d.scripts)
+	}
+}
@@ -0,0 +1,224 @@
+package diagnostics
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/cosysn/devpod-provider-wsl/pkg/agent"
+	"github.com/cosysn/devpod-provider-wsl/pkg/env"
+	pb "github.com/cosysn/devpod-provider-wsl/pkg/grpc/proto"
+	"github.com/cosysn/devpod-provider-wsl/pkg/logging"
+	"github.com/cosysn/devpod-provider-wsl/pkg/options"
+	"github.com/cosysn/devpod-provider-wsl/pkg/preflight"
+	"github.com/cosysn/devpod-provider-wsl/pkg/wsl"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// LogTail is how much of the end of every log file goes into the bundle
+const LogTail = 1 << 20
+
+// Distro is the part of wsl.WSL the diagnostics need
+type Distro interface {
+	VersionInfo() (string, error)
+	ListVerbose() (string, error)
+	Run(script string) ([]byte, error)
+}
+
+var _ Distro = &wsl.WSL{}
+
+// Sources are the parts of the bundle that don't come from the distro,
+// nil functions and empty paths skip their step
+type Sources struct {
+	// AgentStatus calls the agent's Status RPC
+	AgentStatus func(ctx context.Context) (*pb.AgentStatus, error)
+	// AgentChecksum is the sha256 of the agent the provider would install
+	AgentChecksum string
+	// ProviderLog is the provider's own log file
+	ProviderLog string
+	// Preflight runs the preflight checks without fixing anything
+	Preflight func(ctx context.Context) *preflight.Report
+}
+
+// StepsFromOptions builds the collection steps for a distro
+func StepsFromOptions(d Distro, opts *options.Options, src Sources) []Step {
+	steps := []Step{
+		{Name: "wsl-version", File: "wsl/version.txt", Run: func(ctx context.Context) ([]byte, string, error) {
+			out, err := d.VersionInfo()
+			return []byte(out), firstLine(out), err
+		}},
+		{Name: "distributions", File: "wsl/list.txt", Run: func(ctx context.Context) ([]byte, string, error) {
+			out, err := d.ListVerbose()
+			return []byte(out), distroState(out, opts.WSLDistro), err
+		}},
+		{Name: "options", File: "options.txt", Run: func(ctx context.Context) ([]byte, string, error) {
+			return []byte(FormatOptions(opts)), "secrets masked", nil
+		}},
+		distroStep(d, "distro", "distro/info.txt",
+			"uname -a; echo; cat /etc/os-release; echo; id; echo; cat /etc/wsl.conf 2>/dev/null"),
+		distroStep(d, "disk", "distro/disk.txt",
+			"df -h; echo; df -i"),
+		agentBinaryStep(d, src.AgentChecksum),
+		socketStep(d, opts.SocketPath),
+		distroStep(d, "agent-log", "logs/agent.log",
+			fmt.Sprintf("tail -c %d %s", LogTail, wsl.ShellQuote(logging.DefaultAgentLogFile))),
+	}
+
+	if src.AgentStatus != nil {
+		steps = append(steps, Step{Name: "agent-status", File: "agent/status.json", Run: func(ctx context.Context) ([]byte, string, error) {
+			status, err := src.AgentStatus(ctx)
+			if err != nil {
+				return nil, "", &Warning{Message: fmt.Sprintf("status RPC failed: %v", err)}
+			}
+			content, err := protojson.MarshalOptions{Multiline: true}.Marshal(status)
+			return content, fmt.Sprintf("version %s, pid %d, %d sessions", status.Version, status.Pid, status.Sessions), err
+		}})
+	}
+	if src.ProviderLog != "" {
+		steps = append(steps, Step{Name: "provider-log", File: "logs/provider.log", Run: func(ctx context.Context) ([]byte, string, error) {
+			content, err := tailFile(src.ProviderLog, LogTail)
+			return content, fmt.Sprintf("%d bytes", len(content)), err
+		}})
+	}
+	if src.Preflight != nil {
+		steps = append(steps, Step{Name: "preflight", File: "preflight.json", Run: func(ctx context.Context) ([]byte, string, error) {
+			report := src.Preflight(ctx)
+			content := &strings.Builder{}
+			if err := report.WriteJSON(content); err != nil {
+				return nil, "", err
+			}
+			summary := fmt.Sprintf("%d passed, %d warnings, %d failed",
+				report.Count(preflight.StatusPass), report.Count(preflight.StatusWarn), report.Count(preflight.StatusFail))
+			if !report.Passed {
+				return []byte(content.String()), "", &Warning{Message: summary}
+			}
+			return []byte(content.String()), summary, nil
+		}})
+	}
+	return steps
+}
+
+// distroStep runs a script inside the distro and stores its output
+func distroStep(d Distro, name, file, script string) Step {
+	return Step{Name: name, File: file, Run: func(ctx context.Context) ([]byte, string, error) {
+		out, err := d.Run(script)
+		return out, fmt.Sprintf("%d bytes", len(out)), err
+	}}
+}
+
+func agentBinaryStep(d Distro, expected string) Step {
+	script := fmt.Sprintf("ls -l %[1]s && sha256sum %[1]s && %[1]s -version", wsl.ShellQuote(agent.AgentPath))
+	return Step{Name: "agent-binary", File: "agent/binary.txt", Run: func(ctx context.Context) ([]byte, string, error) {
+		out, err := d.Run(script)
+		if err != nil {
+			return out, "", &Warning{Message: "agent not installed or not runnable"}
+		}
+		installed := checksumFromOutput(string(out))
+		if expected != "" && installed != expected {
+			return out, "", &Warning{Message: fmt.Sprintf("installed agent %.12s differs from the provider's %.12s", installed, expected)}
+		}
+		lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+		return out, "version " + lines[len(lines)-1], nil
+	}}
+}
+
+func socketStep(d Distro, socketPath string) Step {
+	script := fmt.Sprintf("ls -l %[1]s && test -S %[1]s", wsl.ShellQuote(socketPath))
+	return Step{Name: "agent-socket", File: "agent/socket.txt", Run: func(ctx context.Context) ([]byte, string, error) {
+		out, err := d.Run(script)
+		if err != nil {
+			return out, "", &Warning{Message: socketPath + " is not a socket, the agent is not running"}
+		}
+		return out, socketPath, nil
+	}}
+}
+
+// checksumFromOutput finds the sha256sum line in the agent-binary output
+func checksumFromOutput(output string) string {
+	for _, line := range strings.Split(output, "\n") {
+		if fields := strings.Fields(line); len(fields) == 2 && len(fields[0]) == 64 && fields[1] == agent.AgentPath {
+			return fields[0]
+		}
+	}
+	return ""
+}
+
+// distroState returns the line of wsl -l -v describing distro
+func distroState(list, distro string) string {
+	for _, line := range strings.Split(list, "\n") {
+		fields := strings.Fields(strings.TrimPrefix(strings.TrimSpace(line), "*"))
+		if len(fields) >= 3 && strings.EqualFold(fields[0], distro) {
+			return fmt.Sprintf("%s is %s, WSL %s", fields[0], strings.ToLower(fields[1]), fields[2])
+		}
+	}
+	return distro + " not listed"
+}
+
+// FormatOptions lists the provider options, secret values are masked
+func FormatOptions(opts *options.Options) string {
+	values := [][2]string{
+		{options.WSL_DISTRO, opts.WSLDistro},
+		{options.WSL_USER, opts.WSLUser},
+		{options.IDLE_TIMEOUT, opts.IdleTimeout.String()},
+		{options.AGENT_PATH, opts.AgentPath},
+		{options.AGENT_URL, opts.AgentURL},
+		{options.AGENT_CHECKSUM, opts.AgentChecksum},
+		{options.AGENT_SYSTEMD, strconv.FormatBool(opts.AgentSystemd)},
+		{options.SOCKET_PATH, opts.SocketPath},
+		{options.WORKSPACE_ROOT, opts.WorkspaceRoot},
+		{options.WORKSPACE_ENV, opts.WorkspaceEnv.String()},
+		{options.REQUIRED_TOOLS, strings.Join(opts.RequiredTools, ",")},
+		{options.MIN_DISK_SPACE, strconv.Itoa(opts.MinDiskSpaceGB)},
+		{options.LOG_LEVEL, opts.LogLevel},
+		{options.MIN_KERNEL_VERSION, opts.MinKernelVersion},
+		{options.REQUIRE_SYSTEMD, strconv.FormatBool(opts.RequireSystemd)},
+		{options.WSL_VERSION, strconv.Itoa(opts.WSLVersion)},
+		{options.MIN_MEMORY, strconv.Itoa(opts.MinMemoryGB)},
+		{options.GIT_REPOSITORY, options.RedactURL(opts.GitRepository)},
+		{options.GIT_BRANCH, opts.GitBranch},
+		{options.GIT_COMMIT, opts.GitCommit},
+		{options.GIT_SHALLOW, strconv.FormatBool(opts.GitShallow)},
+		{options.GIT_CREDENTIAL_HELPER, redactSet(opts.GitCredentialHelper)},
+		{options.DOTFILES_REPOSITORY, options.RedactURL(opts.DotfilesRepository)},
+		{options.DOTFILES_SCRIPT, opts.DotfilesScript},
+		{options.MACHINE_ID, opts.MachineID},
+		{options.MACHINE_FOLDER, opts.MachineFolder},
+	}
+
+	b := &strings.Builder{}
+	for _, v := range values {
+		fmt.Fprintf(b, "%s=%s\n", v[0], v[1])
+	}
+	return b.String()
+}
+
+// redactSet masks a value that may hold a secret, only showing whether it is set
+func redactSet(value string) string {
+	if value == "" {
+		return ""
+	}
+	return env.Redacted
+}
+
+// tailFile reads at most n bytes from the end of a file
+func tailFile(path string, n int64) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() > n {
+		if _, err := f.Seek(-n, io.SeekEnd); err != nil {
+			return nil, err
+		}
+	}
+	return io.ReadAll(f)
+}
@@ -0,0 +1,220 @@
+package env
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Redacted replaces secret values in logs
+const Redacted = "******"
+
+var nameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ValidName reports whether name can be used as an environment variable
+func ValidName(name string) bool {
+	return nameRegexp.MatchString(name)
+}
+
+// Env is a set of environment variables, values of secret variables are
+// never included in String or Redact output.
+type Env struct {
+	values  map[string]string
+	secrets map[string]bool
+}
+
+// New returns an empty Env
+func New() *Env {
+	return &Env{values: map[string]string{}, secrets: map[string]bool{}}
+}
+
+// FromMap returns an Env holding m, every variable is secret when secret is set
+func FromMap(m map[string]string, secret bool) *Env {
+	e := New()
+	for name, value := range m {
+		e.Set(name, value, secret)
+	}
+	return e
+}
+
+// Set sets a variable. A variable stays secret once it was set as secret,
+// so overriding a secret from a less trusted layer doesn't expose it.
+func (e *Env) Set(name, value string, secret bool) {
+	e.values[name] = value
+	if secret {
+		e.secrets[name] = true
+	}
+}
+
+// Get returns the value of name
+func (e *Env) Get(name string) (string, bool) {
+	value, ok := e.values[name]
+	return value, ok
+}
+
+// Merge applies layers in order, later layers override earlier ones
+func Merge(layers ...*Env) *Env {
+	merged := New()
+	for _, layer := range layers {
+		if layer == nil {
+			continue
+		}
+		for name, value := range layer.values {
+			merged.Set(name, value, layer.secrets[name])
+		}
+	}
+	return merged
+}
+
+// Len returns the number of variables
+func (e *Env) Len() int {
+	return len(e.values)
+}
+
+// Names returns the variable names in sorted order
+func (e *Env) Names() []string {
+	names := make([]string, 0, len(e.values))
+	for name := range e.values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SecretNames returns the names of the secret variables in sorted order
+func (e *Env) SecretNames() []string {
+	names := make([]string, 0, len(e.secrets))
+	for name := range e.secrets {
+		if _, ok := e.values[name]; ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Map returns the variables as a map
+func (e *Env) Map() map[string]string {
+	m := make(map[string]string, len(e.values))
+	for name, value := range e.values {
+		m[name] = value
+	}
+	return m
+}
+
+// Environ returns the variables in os.Environ format, sorted by name
+func (e *Env) Environ() []string {
+	environ := make([]string, 0, len(e.values))
+	for _, name := range e.Names() {
+		environ = append(environ, name+"="+e.values[name])
+	}
+	return environ
+}
+
+// Redact replaces the values of secret variables in s
+func (e *Env) Redact(s string) string {
+	var secrets []string
+	for name := range e.secrets {
+		if value := e.values[name]; value != "" {
+			secrets = append(secrets, value)
+		}
+	}
+	// Longer values first, so a secret containing another one is fully replaced
+	sort.Slice(secrets, func(i, j int) bool { return len(secrets[i]) > len(secrets[j]) })
+	for _, secret := range secrets {
+		s = strings.ReplaceAll(s, secret, Redacted)
+	}
+	return s
+}
+
+// String lists the variables with secret values redacted
+func (e *Env) String() string {
+	parts := make([]string, 0, len(e.values))
+	for _, name := range e.Names() {
+		value := e.values[name]
+		if e.secrets[name] {
+			value = Redacted
+		}
+		parts = append(parts, name+"="+value)
+	}
+	return strings.Join(parts, " ")
+}
+
+// ParseList parses comma separated NAME=VALUE pairs as used by provider options
+func ParseList(list string, secret bool) (*Env, error) {
+	e := New()
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(item, "=")
+		name = strings.TrimSpace(name)
+		if !ok || !ValidName(name) {
+			return nil, fmt.Errorf("invalid entry %q, expected NAME=VALUE", redactEntry(item, secret))
+		}
+		e.Set(name, value, secret)
+	}
+	return e, nil
+}
+
+// ParseDotenv parses a .env file: NAME=VALUE lines with optional export
+// prefix, single or double quoted values and # comments
+func ParseDotenv(content string) (*Env, error) {
+	e := New()
+	for i, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		name, value, ok := strings.Cut(line, "=")
+		name = strings.TrimSpace(name)
+		if !ok || !ValidName(name) {
+			return nil, fmt.Errorf("line %d: expected NAME=VALUE", i+1)
+		}
+
+		value, err := unquote(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		e.Set(name, value, false)
+	}
+	return e, nil
+}
+
+// unquote strips quotes from a .env value. Double quoted values support
+// \n, \" and \\ escapes, unquoted values end at an inline comment.
+func unquote(value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	switch quote := value[0]; quote {
+	case '\'', '"':
+		end := strings.LastIndexByte(value, quote)
+		if end == 0 {
+			return "", fmt.Errorf("unterminated %c quote", quote)
+		}
+		inner := value[1:end]
+		if quote == '"' {
+			inner = strings.NewReplacer(`\n`, "\n", `\"`, `"`, `\\`, `\`).Replace(inner)
+		}
+		return inner, nil
+	}
+	if i := strings.Index(value, " #"); i >= 0 {
+		value = strings.TrimSpace(value[:i])
+	}
+	return value, nil
+}
+
+func redactEntry(entry string, secret bool) string {
+	if !secret {
+		return entry
+	}
+	if name, _, ok := strings.Cut(entry, "="); ok {
+		return name + "=" + Redacted
+	}
+	return Redacted
+}
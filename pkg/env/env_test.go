@@ -0,0 +1,107 @@
+package env
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	provider := New()
+	provider.Set("EDITOR", "vi", false)
+	provider.Set("TOKEN", "from-provider", true)
+
+	file := New()
+	file.Set("EDITOR", "vim", false)
+	file.Set("TOKEN", "from-file", false)
+
+	merged := Merge(provider, nil, file)
+	if got := strings.Join(merged.Environ(), ","); got != "EDITOR=vim,TOKEN=from-file" {
+		t.Errorf("Environ() = %q", got)
+	}
+	// TOKEN stays secret although the file didn't mark it
+	if got := merged.String(); got != "EDITOR=vim TOKEN="+Redacted {
+		t.Errorf("String() = %q", got)
+	}
+}
+
+func TestRedact(t *testing.T) {
+	e := New()
+	e.Set("SHORT", "abc", true)
+	e.Set("LONG", "abcdef", true)
+	e.Set("PUBLIC", "visible", false)
+	e.Set("EMPTY", "", true)
+
+	got := e.Redact("curl -H 'Authorization: abcdef' -d abc visible")
+	want := "curl -H 'Authorization: " + Redacted + "' -d " + Redacted + " visible"
+	if got != want {
+		t.Errorf("Redact() = %q, want %q", got, want)
+	}
+}
+
+func TestSecretNames(t *testing.T) {
+	e := New()
+	e.Set("TOKEN", "abc", true)
+	e.Set("API_KEY", "def", true)
+	e.Set("EDITOR", "vim", false)
+
+	got := strings.Join(e.SecretNames(), ",")
+	if got != "API_KEY,TOKEN" {
+		t.Errorf("SecretNames() = %q, want %q", got, "API_KEY,TOKEN")
+	}
+}
+
+func TestParseList(t *testing.T) {
+	e, err := ParseList(" A=1, B=x=y ,,C=", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(e.Environ(), ","); got != "A=1,B=x=y,C=" {
+		t.Errorf("Environ() = %q", got)
+	}
+
+	_, err = ParseList("TOKEN=ok,1BAD=hunter2", true)
+	if err == nil {
+		t.Fatal("ParseList should reject invalid names")
+	}
+	if strings.Contains(err.Error(), "hunter2") {
+		t.Errorf("error leaks the secret: %v", err)
+	}
+}
+
+func TestParseDotenv(t *testing.T) {
+	content := `# workspace settings
+export NAME="dev pod"
+SINGLE='$NOT_EXPANDED'
+ESCAPED="line1\nline2 \"quoted\""
+PLAIN=value # comment
+EMPTY=
+`
+	e, err := ParseDotenv(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"NAME":    "dev pod",
+		"SINGLE":  "$NOT_EXPANDED",
+		"ESCAPED": "line1\nline2 \"quoted\"",
+		"PLAIN":   "value",
+		"EMPTY":   "",
+	}
+	if e.Len() != len(want) {
+		t.Errorf("got %d variables, want %d", e.Len(), len(want))
+	}
+	for name, value := range want {
+		if got, _ := e.Get(name); got != value {
+			t.Errorf("%s = %q, want %q", name, got, value)
+		}
+	}
+}
+
+func TestParseDotenv_Errors(t *testing.T) {
+	for _, content := range []string{"NO_EQUALS", "1X=1", `OPEN="unterminated`} {
+		if _, err := ParseDotenv(content); err == nil {
+			t.Errorf("ParseDotenv(%q) should fail", content)
+		}
+	}
+}
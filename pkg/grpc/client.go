@@ -2,45 +2,95 @@ package grpc
 
 import (
 	"context"
+	"io"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	pb "github.com/cosysn/devpod-provider-wsl/pkg/grpc/proto"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/backoff"
+	"google.golang.org/grpc/connectivity"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/keepalive"
 )
 
 // Client gRPC 客户端
 type Client struct {
 	conn      *grpc.ClientConn
 	client    pb.DevPodWSLServiceClient
+	files     pb.FileServiceClient
 	stdinLock sync.Mutex
 	stdinStream pb.DevPodWSLService_StdinClient
 }
 
-// NewClient 创建 gRPC 客户端，连接到 Unix socket
-func NewClient(socketPath string, timeout time.Duration) (*Client, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
-	defer cancel()
+// NewClient 创建 gRPC 客户端，连接到 Unix socket。agent 刚启动、socket 还没
+// 就绪时按退避间隔重连，直到连接就绪或超过 timeout
+func NewClient(socketPath string, timeout time.Duration, opts ...ClientOption) (*Client, error) {
+	options := clientOptions{retry: DefaultRetryPolicy, keepalive: 10 * time.Second}
+	for _, opt := range opts {
+		opt(&options)
+	}
 
+	// 记录最近一次拨号错误，用于区分 agent 没有运行和没有响应
+	var lastDialErr atomic.Pointer[error]
 	dialer := func(ctx context.Context, addr string) (net.Conn, error) {
-		return net.DialTimeout("unix", socketPath, timeout)
+		conn, err := (&net.Dialer{}).DialContext(ctx, "unix", socketPath)
+		if err != nil {
+			lastDialErr.Store(&err)
+		}
+		return conn, err
 	}
 
-	conn, err := grpc.DialContext(
-		ctx,
+	conn, err := grpc.NewClient(
 		"passthrough:///unix",
 		grpc.WithTransportCredentials(insecure.NewCredentials()),
 		grpc.WithContextDialer(dialer),
+		grpc.WithConnectParams(grpc.ConnectParams{
+			Backoff: backoff.Config{
+				BaseDelay:  100 * time.Millisecond,
+				Multiplier: 1.6,
+				Jitter:     0.2,
+				MaxDelay:   2 * time.Second,
+			},
+			MinConnectTimeout: timeout,
+		}),
+		grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:                options.keepalive,
+			Timeout:             options.keepalive / 2,
+			PermitWithoutStream: true,
+		}),
+		grpc.WithDefaultCallOptions(
+			grpc.MaxCallRecvMsgSize(MaxMessageSize),
+			grpc.MaxCallSendMsgSize(MaxMessageSize),
+		),
+		grpc.WithChainUnaryInterceptor(requestIDUnaryClientInterceptor, options.retry.retryUnaryClientInterceptor),
+		grpc.WithChainStreamInterceptor(requestIDStreamClientInterceptor),
 	)
 	if err != nil {
 		return nil, err
 	}
 
+	// 等待连接就绪
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	conn.Connect()
+	for state := conn.GetState(); state != connectivity.Ready; state = conn.GetState() {
+		if !conn.WaitForStateChange(ctx, state) {
+			conn.Close()
+			var dialErr error
+			if last := lastDialErr.Load(); last != nil {
+				dialErr = *last
+			}
+			return nil, dialError(socketPath, dialErr, ctx.Err())
+		}
+	}
+
 	return &Client{
 		conn:   conn,
 		client: pb.NewDevPodWSLServiceClient(conn),
+		files:  pb.NewFileServiceClient(conn),
 	}, nil
 }
 
@@ -63,6 +113,18 @@ func (c *Client) Exec(ctx context.Context) (pb.DevPodWSLService_ExecClient, erro
 	return c.client.Exec(ctx)
 }
 
+// Attach 重新连接到一个 Exec 会话
+func (c *Client) Attach(ctx context.Context, sessionID string) (pb.DevPodWSLService_AttachClient, error) {
+	stream, err := c.client.Attach(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := stream.Send(&pb.ExecRequest{Data: &pb.ExecRequest_SessionId{SessionId: sessionID}}); err != nil {
+		return nil, err
+	}
+	return stream, nil
+}
+
 // OpenStdin 打开 stdin 流
 func (c *Client) OpenStdin(ctx context.Context) error {
 	c.stdinLock.Lock()
@@ -105,6 +167,127 @@ func (c *Client) Status(ctx context.Context) (*pb.AgentStatus, error) {
 	return c.client.Status(ctx, &pb.Empty{})
 }
 
+// Health 获取 agent 的健康检查结果
+func (c *Client) Health(ctx context.Context) (*pb.HealthResponse, error) {
+	return c.client.Health(ctx, &pb.Empty{})
+}
+
+// Metrics 获取 Prometheus 文本格式的 agent 指标
+func (c *Client) Metrics(ctx context.Context) (string, error) {
+	resp, err := c.client.Metrics(ctx, &pb.Empty{})
+	if err != nil {
+		return "", err
+	}
+	return resp.Text, nil
+}
+
+// upgradeChunkSize 是上传 agent 时每条消息的大小
+const upgradeChunkSize = 64 << 10
+
+// Upgrade 把新的 agent 上传给正在运行的 agent，校验通过后 agent 原地重启。
+// 还有命令在运行时 agent 拒绝升级，返回 FailedPrecondition
+func (c *Client) Upgrade(ctx context.Context, agent io.Reader, sha256, version string) (*pb.UpgradeResponse, error) {
+	return c.upgrade(ctx, agent, sha256, version, false)
+}
+
+// ForceUpgrade 和 Upgrade 相同，但会结束正在运行的命令：会话不能跨越重启保留，
+// 它们的客户端收到退出码后也无法再 Attach
+func (c *Client) ForceUpgrade(ctx context.Context, agent io.Reader, sha256, version string) (*pb.UpgradeResponse, error) {
+	return c.upgrade(ctx, agent, sha256, version, true)
+}
+
+func (c *Client) upgrade(ctx context.Context, agent io.Reader, sha256, version string, force bool) (*pb.UpgradeResponse, error) {
+	stream, err := c.client.Upgrade(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	chunk := &pb.UpgradeChunk{Sha256: sha256, Version: version, Force: force}
+	buf := make([]byte, upgradeChunkSize)
+	for {
+		n, readErr := agent.Read(buf)
+		if n > 0 || chunk.Sha256 != "" {
+			chunk.Content = buf[:n]
+			if err := stream.Send(chunk); err != nil {
+				// 服务端提前拒绝时，真正的错误由 CloseAndRecv 返回
+				break
+			}
+			chunk = &pb.UpgradeChunk{}
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			stream.CloseSend()
+			return nil, readErr
+		}
+	}
+	return stream.CloseAndRecv()
+}
+
+// Stat 返回文件信息，不解析最后一级的符号链接
+func (c *Client) Stat(ctx context.Context, path string) (*pb.FileInfo, error) {
+	return c.files.Stat(ctx, &pb.StatRequest{Path: path})
+}
+
+// ReadDir 返回按名称排序的目录内容
+func (c *Client) ReadDir(ctx context.Context, path string) ([]*pb.FileInfo, error) {
+	resp, err := c.files.ReadDir(ctx, &pb.ReadDirRequest{Path: path})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Entries, nil
+}
+
+// MkdirAll 创建目录及其父目录，mode 为 0 时使用 0755
+func (c *Client) MkdirAll(ctx context.Context, path string, mode uint32) error {
+	_, err := c.files.MkdirAll(ctx, &pb.MkdirRequest{Path: path, Mode: mode})
+	return err
+}
+
+// Remove 删除文件或空目录，recursive 为 true 时连同目录内容一起删除
+func (c *Client) Remove(ctx context.Context, path string, recursive bool) error {
+	_, err := c.files.Remove(ctx, &pb.RemoveRequest{Path: path, Recursive: recursive})
+	return err
+}
+
+// Rename 移动文件或目录
+func (c *Client) Rename(ctx context.Context, oldPath, newPath string) error {
+	_, err := c.files.Rename(ctx, &pb.RenameRequest{OldPath: oldPath, NewPath: newPath})
+	return err
+}
+
+// Chmod 修改权限位
+func (c *Client) Chmod(ctx context.Context, path string, mode uint32) error {
+	_, err := c.files.Chmod(ctx, &pb.ChmodRequest{Path: path, Mode: mode})
+	return err
+}
+
+// Symlink 创建指向 target 的符号链接 path
+func (c *Client) Symlink(ctx context.Context, target, path string) error {
+	_, err := c.files.Symlink(ctx, &pb.SymlinkRequest{Target: target, Path: path})
+	return err
+}
+
+// Watch 监视目录树的变化，返回时监视已经就绪。取消 ctx 结束监视
+func (c *Client) Watch(ctx context.Context, req *pb.WatchRequest) (pb.FileService_WatchClient, error) {
+	stream, err := c.files.Watch(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	// agent 在所有目录都被监视之后才发送 header；没有 header 表示调用已经结束，
+	// 错误由 Recv 返回
+	md, err := stream.Header()
+	if err != nil {
+		return nil, err
+	}
+	if md == nil {
+		_, err := stream.Recv()
+		return nil, err
+	}
+	return stream, nil
+}
+
 // Close 关闭连接
 func (c *Client) Close() error {
 	return c.conn.Close()
@@ -0,0 +1,153 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	pb "github.com/cosysn/devpod-provider-wsl/pkg/grpc/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var fastRetry = RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: 10 * time.Millisecond, Multiplier: 2}
+
+// serveService serves impl on socketPath until the test ends
+func serveService(t *testing.T, socketPath string, impl pb.DevPodWSLServiceServer, opts ...grpc.ServerOption) {
+	t.Helper()
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer(opts...)
+	pb.RegisterDevPodWSLServiceServer(server, impl)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+}
+
+// flakyServer fails the first failures calls of Status and Start with Unavailable
+type flakyServer struct {
+	*WSLServer
+	failures int32
+	calls    atomic.Int32
+}
+
+func (f *flakyServer) fail() error {
+	if f.calls.Add(1) <= f.failures {
+		return status.Error(codes.Unavailable, "restarting")
+	}
+	return nil
+}
+
+func (f *flakyServer) Status(ctx context.Context, req *pb.Empty) (*pb.AgentStatus, error) {
+	if err := f.fail(); err != nil {
+		return nil, err
+	}
+	return f.WSLServer.Status(ctx, req)
+}
+
+func (f *flakyServer) Start(ctx context.Context, req *pb.StartRequest) (*pb.StartResponse, error) {
+	if err := f.fail(); err != nil {
+		return nil, err
+	}
+	return f.WSLServer.Start(ctx, req)
+}
+
+func TestNewClient_WaitsForAgent(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "agent.sock")
+	type result struct {
+		client *Client
+		err    error
+	}
+	dialed := make(chan result, 1)
+	go func() {
+		client, err := NewClient(socketPath, 5*time.Second)
+		dialed <- result{client, err}
+	}()
+
+	// The agent creates its socket a moment after the client starts dialing
+	time.Sleep(300 * time.Millisecond)
+	serveService(t, socketPath, NewWSLServer())
+
+	r := <-dialed
+	if r.err != nil {
+		t.Fatalf("NewClient: %v", r.err)
+	}
+	client := r.client
+	defer client.Close()
+	if _, err := client.Status(context.Background()); err != nil {
+		t.Fatalf("Status: %v", err)
+	}
+}
+
+func TestNewClient_AgentNotRunning(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "agent.sock")
+
+	start := time.Now()
+	_, err := NewClient(socketPath, 300*time.Millisecond)
+	if !errors.Is(err, ErrAgentNotRunning) {
+		t.Fatalf("NewClient error = %v, want ErrAgentNotRunning", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("NewClient took %s, want about the timeout", elapsed)
+	}
+}
+
+func TestClient_RetriesIdempotentRPCs(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "agent.sock")
+	flaky := &flakyServer{WSLServer: NewWSLServer(), failures: 2}
+	serveService(t, socketPath, flaky)
+
+	client, err := NewClient(socketPath, 5*time.Second, WithRetryPolicy(fastRetry))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	if _, err := client.Status(context.Background()); err != nil {
+		t.Fatalf("Status after two failures: %v", err)
+	}
+	if calls := flaky.calls.Load(); calls != 3 {
+		t.Errorf("Status was called %d times, want 3", calls)
+	}
+
+	// Start is not idempotent and fails on the first Unavailable
+	flaky.calls.Store(0)
+	_, err = client.Start(context.Background(), "true", "", nil)
+	if !errors.Is(err, ErrAgentUnavailable) || status.Code(err) != codes.Unavailable {
+		t.Errorf("Start error = %v, want ErrAgentUnavailable", err)
+	}
+	if calls := flaky.calls.Load(); calls != 1 {
+		t.Errorf("Start was called %d times, want 1", calls)
+	}
+}
+
+func TestClient_OutdatedAgent(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "agent.sock")
+	serveService(t, socketPath, pb.UnimplementedDevPodWSLServiceServer{})
+
+	client, err := NewClient(socketPath, 5*time.Second, WithRetryPolicy(fastRetry))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	if _, err := client.Health(context.Background()); !errors.Is(err, ErrAgentOutdated) {
+		t.Errorf("Health error = %v, want ErrAgentOutdated", err)
+	}
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	p := RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second, Multiplier: 3}
+	want := []time.Duration{100 * time.Millisecond, 300 * time.Millisecond, 900 * time.Millisecond, time.Second}
+	for i, w := range want {
+		if got := p.backoff(i + 1); got != w {
+			t.Errorf("backoff(%d) = %s, want %s", i+1, got, w)
+		}
+	}
+}
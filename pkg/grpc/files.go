@@ -0,0 +1,311 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+
+	pb "github.com/cosysn/devpod-provider-wsl/pkg/grpc/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// defaultDirMode 用于没有指定 mode 的 MkdirAll
+const defaultDirMode = 0o755
+
+// FileServer 实现 FileService，所有路径都限制在 Root 之内
+type FileServer struct {
+	pb.UnimplementedFileServiceServer
+
+	// Root 是允许访问的目录，相对路径以它为基准
+	Root string
+
+	// stopCtx 在 Shutdown 时取消，结束所有 Watch
+	stopOnce sync.Once
+	stopCtx  context.Context
+	stop     context.CancelFunc
+}
+
+// NewFileServer 创建限制在 root 之内的 FileServer
+func NewFileServer(root string) *FileServer {
+	if abs, err := filepath.Abs(root); err == nil {
+		root = abs
+	}
+	return &FileServer{Root: root}
+}
+
+// stopContext 返回 Shutdown 时取消的 context
+func (f *FileServer) stopContext() context.Context {
+	f.stopOnce.Do(func() { f.stopCtx, f.stop = context.WithCancel(context.Background()) })
+	return f.stopCtx
+}
+
+// Shutdown 结束所有 Watch 流并拒绝新的 Watch 调用。Watch 只在客户端取消时
+// 才会结束，不先结束它们 GracefulStop 会一直等到 drain 超时
+func (f *FileServer) Shutdown() {
+	f.stopContext()
+	f.stop()
+}
+
+// resolve 把请求中的路径转换成 Root 之内的真实路径。follow 为 false 时不解析
+// 最后一级的符号链接，Stat、Remove、Rename 和 Symlink 操作的是链接本身。
+// 检查解析符号链接之后的路径，防止通过链接离开 Root
+func (f *FileServer) resolve(name string, follow bool) (string, error) {
+	if name == "" {
+		return "", status.Error(codes.InvalidArgument, "path is required")
+	}
+	p := name
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(f.Root, p)
+	}
+	p = filepath.Clean(p)
+	if !within(f.Root, p) {
+		return "", status.Errorf(codes.PermissionDenied, "%s is outside %s", name, f.Root)
+	}
+
+	root, err := filepath.EvalSymlinks(f.Root)
+	if err != nil {
+		return "", status.Errorf(codes.FailedPrecondition, "file root: %v", err)
+	}
+	rel, _ := filepath.Rel(f.Root, p)
+	p = filepath.Join(root, rel)
+	if p == root {
+		return root, nil
+	}
+
+	dir, base := p, ""
+	if !follow {
+		dir, base = filepath.Dir(p), filepath.Base(p)
+	}
+	real, err := evalExisting(dir)
+	if err != nil {
+		return "", fileError(err)
+	}
+	if !within(root, real) {
+		return "", status.Errorf(codes.PermissionDenied, "%s resolves outside %s", name, f.Root)
+	}
+	return filepath.Join(real, base), nil
+}
+
+// resolveEntry 解析一个会被删除或移动的路径，Root 本身不允许
+func (f *FileServer) resolveEntry(name string) (string, error) {
+	p, err := f.resolve(name, false)
+	if err != nil {
+		return "", err
+	}
+	if root, _ := filepath.EvalSymlinks(f.Root); p == root {
+		return "", status.Errorf(codes.PermissionDenied, "cannot change the file root %s", f.Root)
+	}
+	return p, nil
+}
+
+// evalExisting 解析路径中已经存在的部分的符号链接，不存在的部分原样拼接
+func evalExisting(p string) (string, error) {
+	rest := ""
+	for {
+		real, err := filepath.EvalSymlinks(p)
+		if err == nil {
+			return filepath.Join(real, rest), nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", err
+		}
+		parent := filepath.Dir(p)
+		if parent == p {
+			return "", err
+		}
+		rest = filepath.Join(filepath.Base(p), rest)
+		p = parent
+	}
+}
+
+// within 判断 p 是否是 root 或者在 root 之下，两者都是干净的绝对路径
+func within(root, p string) bool {
+	rel, err := filepath.Rel(root, p)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// fileError 把文件系统错误转换成对应的 gRPC 状态码
+func fileError(err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	// 错误信息中只保留路径和原因
+	msg := err.Error()
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		msg = pathErr.Path + ": " + pathErr.Err.Error()
+	}
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return status.Error(codes.NotFound, msg)
+	// ENOTEMPTY 也匹配 fs.ErrExist，要先判断
+	case errors.Is(err, syscall.ENOTEMPTY), errors.Is(err, syscall.ENOTDIR), errors.Is(err, syscall.EISDIR):
+		return status.Error(codes.FailedPrecondition, msg)
+	case errors.Is(err, fs.ErrExist):
+		return status.Error(codes.AlreadyExists, msg)
+	case errors.Is(err, fs.ErrPermission):
+		return status.Error(codes.PermissionDenied, msg)
+	}
+	return status.Error(codes.Internal, msg)
+}
+
+// fileInfo 把 Lstat 的结果转换成 FileInfo，符号链接带上它的目标
+func fileInfo(p string, info fs.FileInfo) *pb.FileInfo {
+	resp := &pb.FileInfo{
+		Name:      info.Name(),
+		Size:      info.Size(),
+		Mode:      uint32(info.Mode().Perm()),
+		ModTime:   info.ModTime().UnixNano(),
+		IsDir:     info.IsDir(),
+		IsSymlink: info.Mode()&fs.ModeSymlink != 0,
+	}
+	mode := info.Mode()
+	if mode&fs.ModeSetuid != 0 {
+		resp.Mode |= 0o4000
+	}
+	if mode&fs.ModeSetgid != 0 {
+		resp.Mode |= 0o2000
+	}
+	if mode&fs.ModeSticky != 0 {
+		resp.Mode |= 0o1000
+	}
+	if resp.IsSymlink {
+		resp.SymlinkTarget, _ = os.Readlink(p)
+	}
+	return resp
+}
+
+// fileMode 把请求中的权限位转换成 fs.FileMode
+func fileMode(mode uint32) fs.FileMode {
+	m := fs.FileMode(mode & 0o777)
+	if mode&0o4000 != 0 {
+		m |= fs.ModeSetuid
+	}
+	if mode&0o2000 != 0 {
+		m |= fs.ModeSetgid
+	}
+	if mode&0o1000 != 0 {
+		m |= fs.ModeSticky
+	}
+	return m
+}
+
+func (f *FileServer) Stat(ctx context.Context, req *pb.StatRequest) (*pb.FileInfo, error) {
+	p, err := f.resolve(req.Path, false)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Lstat(p)
+	if err != nil {
+		return nil, fileError(err)
+	}
+	return fileInfo(p, info), nil
+}
+
+func (f *FileServer) ReadDir(ctx context.Context, req *pb.ReadDirRequest) (*pb.ReadDirResponse, error) {
+	p, err := f.resolve(req.Path, true)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(p)
+	if err != nil {
+		return nil, fileError(err)
+	}
+	resp := &pb.ReadDirResponse{Entries: make([]*pb.FileInfo, 0, len(entries))}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			// 读取目录之后被删除的条目
+			continue
+		}
+		resp.Entries = append(resp.Entries, fileInfo(filepath.Join(p, entry.Name()), info))
+	}
+	return resp, nil
+}
+
+func (f *FileServer) MkdirAll(ctx context.Context, req *pb.MkdirRequest) (*pb.Empty, error) {
+	p, err := f.resolve(req.Path, true)
+	if err != nil {
+		return nil, err
+	}
+	mode := fs.FileMode(defaultDirMode)
+	if req.Mode != 0 {
+		mode = fileMode(req.Mode)
+	}
+	if err := os.MkdirAll(p, mode); err != nil {
+		return nil, fileError(err)
+	}
+	return &pb.Empty{}, nil
+}
+
+func (f *FileServer) Remove(ctx context.Context, req *pb.RemoveRequest) (*pb.Empty, error) {
+	p, err := f.resolveEntry(req.Path)
+	if err != nil {
+		return nil, err
+	}
+	if req.Recursive {
+		err = os.RemoveAll(p)
+	} else {
+		err = os.Remove(p)
+	}
+	if err != nil {
+		return nil, fileError(err)
+	}
+	return &pb.Empty{}, nil
+}
+
+func (f *FileServer) Rename(ctx context.Context, req *pb.RenameRequest) (*pb.Empty, error) {
+	oldPath, err := f.resolveEntry(req.OldPath)
+	if err != nil {
+		return nil, err
+	}
+	newPath, err := f.resolveEntry(req.NewPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Rename(oldPath, newPath); err != nil {
+		return nil, fileError(err)
+	}
+	return &pb.Empty{}, nil
+}
+
+func (f *FileServer) Chmod(ctx context.Context, req *pb.ChmodRequest) (*pb.Empty, error) {
+	// chmod 作用于链接的目标，所以目标也必须在 Root 之内
+	p, err := f.resolve(req.Path, true)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(p, fileMode(req.Mode)); err != nil {
+		return nil, fileError(err)
+	}
+	return &pb.Empty{}, nil
+}
+
+func (f *FileServer) Symlink(ctx context.Context, req *pb.SymlinkRequest) (*pb.Empty, error) {
+	if req.Target == "" {
+		return nil, status.Error(codes.InvalidArgument, "target is required")
+	}
+	p, err := f.resolveEntry(req.Path)
+	if err != nil {
+		return nil, err
+	}
+	// 相对目标按链接所在目录解析，绝对目标按原样检查
+	target := req.Target
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(filepath.Dir(p), target)
+	}
+	root, _ := filepath.EvalSymlinks(f.Root)
+	if !within(root, filepath.Clean(target)) && !within(f.Root, filepath.Clean(target)) {
+		return nil, status.Errorf(codes.PermissionDenied, "link target %s is outside %s", req.Target, f.Root)
+	}
+	if err := os.Symlink(req.Target, p); err != nil {
+		return nil, fileError(err)
+	}
+	return &pb.Empty{}, nil
+}
@@ -0,0 +1,156 @@
+package grpc
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	pb "github.com/cosysn/devpod-provider-wsl/pkg/grpc/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// serveFiles serves a FileServer confined to a new temp dir and returns a
+// client and the root
+func serveFiles(t *testing.T) (*Client, string) {
+	t.Helper()
+	root := filepath.Join(t.TempDir(), "root")
+	if err := os.Mkdir(root, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return serveFileServer(t, NewFileServer(root)), root
+}
+
+// serveFileServer serves files and returns a client
+func serveFileServer(t *testing.T, files *FileServer) *Client {
+	t.Helper()
+	socketPath := filepath.Join(t.TempDir(), "agent.sock")
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer(NewWSLServer().ServerOptions()...)
+	pb.RegisterFileServiceServer(server, files)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	client, err := NewClient(socketPath, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestFiles_Operations(t *testing.T) {
+	client, root := serveFiles(t)
+	ctx := context.Background()
+
+	if err := client.MkdirAll(ctx, "src/pkg", 0o750); err != nil {
+		t.Fatalf("MkdirAll failed: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "src", "main.go"), []byte("package main\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := client.Stat(ctx, filepath.Join(root, "src", "pkg"))
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	if !info.IsDir || info.Mode != 0o750 || info.Name != "pkg" {
+		t.Errorf("Stat(src/pkg) = %v", info)
+	}
+
+	if err := client.Chmod(ctx, "src/main.go", 0o600); err != nil {
+		t.Fatalf("Chmod failed: %v", err)
+	}
+	if err := client.Symlink(ctx, "main.go", "src/link.go"); err != nil {
+		t.Fatalf("Symlink failed: %v", err)
+	}
+	if err := client.Rename(ctx, "src/pkg", "src/lib"); err != nil {
+		t.Fatalf("Rename failed: %v", err)
+	}
+
+	entries, err := client.ReadDir(ctx, "src")
+	if err != nil {
+		t.Fatalf("ReadDir failed: %v", err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name)
+	}
+	if got := strings.Join(names, ","); got != "lib,link.go,main.go" {
+		t.Fatalf("ReadDir(src) = %v", names)
+	}
+	if link := entries[1]; !link.IsSymlink || link.SymlinkTarget != "main.go" {
+		t.Errorf("link entry = %v", link)
+	}
+	if file := entries[2]; file.Mode != 0o600 || file.Size != int64(len("package main\n")) {
+		t.Errorf("main.go entry = %v", file)
+	}
+
+	// A non-empty directory is only removed recursively
+	if err := client.Remove(ctx, "src", false); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("Remove(src) = %v, want FailedPrecondition", err)
+	}
+	if err := client.Remove(ctx, "src", true); err != nil {
+		t.Fatalf("Remove(src, recursive) failed: %v", err)
+	}
+	if _, err := client.Stat(ctx, "src"); status.Code(err) != codes.NotFound {
+		t.Errorf("Stat after Remove = %v, want NotFound", err)
+	}
+}
+
+func TestFiles_Confinement(t *testing.T) {
+	client, root := serveFiles(t)
+	ctx := context.Background()
+
+	outside := filepath.Dir(root)
+	if err := os.WriteFile(filepath.Join(outside, "secret"), []byte("secret"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	// A link inside the root that points out of it
+	if err := os.Symlink(outside, filepath.Join(root, "escape")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		call func() error
+	}{
+		{"stat parent", func() error { _, err := client.Stat(ctx, "../secret"); return err }},
+		{"stat absolute", func() error { _, err := client.Stat(ctx, filepath.Join(outside, "secret")); return err }},
+		{"read dir through link", func() error { _, err := client.ReadDir(ctx, "escape"); return err }},
+		{"stat through link", func() error { _, err := client.Stat(ctx, "escape/secret"); return err }},
+		{"mkdir through link", func() error { return client.MkdirAll(ctx, "escape/new", 0) }},
+		{"chmod link target", func() error { return client.Chmod(ctx, "escape", 0o777) }},
+		{"remove through link", func() error { return client.Remove(ctx, "escape/secret", false) }},
+		{"rename out", func() error { return client.Rename(ctx, "escape", "../moved") }},
+		{"symlink out", func() error { return client.Symlink(ctx, "../secret", "link") }},
+		{"remove root", func() error { return client.Remove(ctx, ".", true) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.call(); status.Code(err) != codes.PermissionDenied {
+				t.Errorf("got %v, want PermissionDenied", err)
+			}
+		})
+	}
+
+	if _, err := os.Stat(filepath.Join(outside, "secret")); err != nil {
+		t.Errorf("file outside the root was touched: %v", err)
+	}
+	// The link itself is inside the root and can be inspected and removed
+	info, err := client.Stat(ctx, "escape")
+	if err != nil || !info.IsSymlink {
+		t.Errorf("Stat(escape) = %v, %v", info, err)
+	}
+	if err := client.Remove(ctx, "escape", false); err != nil {
+		t.Errorf("Remove(escape) = %v", err)
+	}
+}
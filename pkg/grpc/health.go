@@ -0,0 +1,138 @@
+package grpc
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	pb "github.com/cosysn/devpod-provider-wsl/pkg/grpc/proto"
+	"github.com/creack/pty"
+)
+
+// 健康检查状态，与 diagnostics 的取值一致
+const (
+	HealthOK    = "ok"
+	HealthWarn  = "warn"
+	HealthError = "error"
+)
+
+// LowDiskBytes 工作区可用空间低于该值时 workspace 检查报 warn
+var LowDiskBytes uint64 = 1 << 30
+
+// healthSeverity 用于汇总出最差的状态
+var healthSeverity = map[string]int{HealthOK: 0, HealthWarn: 1, HealthError: 2}
+
+func (s *WSLServer) Health(ctx context.Context, req *pb.Empty) (*pb.HealthResponse, error) {
+	// 已退出但仍保留以便 Attach 的会话不计入
+	sessions := s.activeSessions()
+	s.mu.Lock()
+	processes := len(s.processes)
+	s.mu.Unlock()
+
+	rss, cpu := resourceUsage()
+	resp := &pb.HealthResponse{
+		Status:         HealthOK,
+		Version:        s.Version,
+		Pid:            int32(os.Getpid()),
+		UptimeSeconds:  int64(time.Since(s.started).Seconds()),
+		Sessions:       int32(sessions),
+		Processes:      int32(processes),
+		SocketPath:     s.SocketPath,
+		MemoryRssBytes: rss,
+		CpuSeconds:     cpu.Seconds(),
+		WorkspaceRoot:  s.WorkspaceRoot,
+	}
+
+	var workspace *pb.HealthCheck
+	resp.WorkspaceFreeBytes, workspace = checkWorkspace(s.WorkspaceRoot)
+	checks := []*pb.HealthCheck{checkSocket(s.SocketPath), workspace, checkShell(), checkPty()}
+	for _, check := range checks {
+		if check == nil {
+			continue
+		}
+		resp.Checks = append(resp.Checks, check)
+		if healthSeverity[check.Status] > healthSeverity[resp.Status] {
+			resp.Status = check.Status
+		}
+	}
+	return resp, nil
+}
+
+// checkSocket 确认监听的 socket 文件还在，被删除后新的客户端无法连接
+func checkSocket(path string) *pb.HealthCheck {
+	if path == "" {
+		return nil
+	}
+	info, err := os.Stat(path)
+	switch {
+	case err != nil:
+		return &pb.HealthCheck{Name: "socket", Status: HealthError, Message: err.Error()}
+	case info.Mode()&os.ModeSocket == 0:
+		return &pb.HealthCheck{Name: "socket", Status: HealthError, Message: path + " is not a socket"}
+	}
+	return &pb.HealthCheck{Name: "socket", Status: HealthOK, Message: path}
+}
+
+// checkWorkspace 返回工作区可用空间，工作区还不存在时检查最近的父目录
+func checkWorkspace(root string) (uint64, *pb.HealthCheck) {
+	if root == "" {
+		return 0, nil
+	}
+	path := root
+	for {
+		if _, err := os.Stat(path); err == nil || filepath.Dir(path) == path {
+			break
+		}
+		path = filepath.Dir(path)
+	}
+
+	free, err := diskFree(path)
+	switch {
+	case err != nil:
+		return 0, &pb.HealthCheck{Name: "workspace", Status: HealthError, Message: err.Error()}
+	case free < LowDiskBytes:
+		return free, &pb.HealthCheck{Name: "workspace", Status: HealthWarn,
+			Message: fmt.Sprintf("only %s free on %s", formatBytes(free), path)}
+	}
+	return free, &pb.HealthCheck{Name: "workspace", Status: HealthOK,
+		Message: fmt.Sprintf("%s free on %s", formatBytes(free), path)}
+}
+
+// checkShell 命令都通过 /bin/sh 或登录 shell 运行
+func checkShell() *pb.HealthCheck {
+	info, err := os.Stat("/bin/sh")
+	if err != nil {
+		return &pb.HealthCheck{Name: "shell", Status: HealthError, Message: err.Error()}
+	}
+	if info.Mode()&0o111 == 0 {
+		return &pb.HealthCheck{Name: "shell", Status: HealthError, Message: "/bin/sh is not executable"}
+	}
+	return &pb.HealthCheck{Name: "shell", Status: HealthOK, Message: "/bin/sh"}
+}
+
+// checkPty Exec 会话需要能分配新的 PTY
+func checkPty() *pb.HealthCheck {
+	ptmx, tty, err := pty.Open()
+	if err != nil {
+		return &pb.HealthCheck{Name: "pty", Status: HealthError, Message: err.Error()}
+	}
+	name := tty.Name()
+	tty.Close()
+	ptmx.Close()
+	return &pb.HealthCheck{Name: "pty", Status: HealthOK, Message: name}
+}
+
+func formatBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := uint64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
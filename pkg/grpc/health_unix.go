@@ -0,0 +1,40 @@
+//go:build !windows
+
+package grpc
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// resourceUsage 返回 agent 当前的常驻内存和累计 CPU 时间
+func resourceUsage() (uint64, time.Duration) {
+	var usage unix.Rusage
+	if err := unix.Getrusage(unix.RUSAGE_SELF, &usage); err != nil {
+		return 0, 0
+	}
+	cpu := time.Duration(usage.Utime.Nano() + usage.Stime.Nano())
+
+	// /proc/self/statm 的第二列是常驻页数，没有 /proc 时退回到峰值 RSS (KiB)
+	if statm, err := os.ReadFile("/proc/self/statm"); err == nil {
+		if fields := strings.Fields(string(statm)); len(fields) > 1 {
+			if pages, err := strconv.ParseUint(fields[1], 10, 64); err == nil {
+				return pages * uint64(os.Getpagesize()), cpu
+			}
+		}
+	}
+	return uint64(usage.Maxrss) * 1024, cpu
+}
+
+// diskFree 返回 path 所在文件系统上普通用户可用的空间
+func diskFree(path string) (uint64, error) {
+	var stat unix.Statfs_t
+	if err := unix.Statfs(path, &stat); err != nil {
+		return 0, err
+	}
+	return stat.Bavail * uint64(stat.Bsize), nil
+}
@@ -0,0 +1,18 @@
+//go:build windows
+
+package grpc
+
+import (
+	"errors"
+	"time"
+)
+
+// resourceUsage agent 只运行在 WSL 内，Windows 上不统计
+func resourceUsage() (uint64, time.Duration) {
+	return 0, 0
+}
+
+// diskFree Windows 上不支持
+func diskFree(path string) (uint64, error) {
+	return 0, errors.New("disk usage is not supported on windows")
+}
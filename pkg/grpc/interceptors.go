@@ -0,0 +1,186 @@
+package grpc
+
+import (
+	"context"
+	"log/slog"
+	"path"
+	"runtime/debug"
+	"time"
+
+	grpcLib "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// RequestIDKey 是携带请求 ID 的 metadata 键，provider 和 agent 的日志都会记录它
+const RequestIDKey = "x-request-id"
+
+var (
+	// MaxMessageSize 是单条 gRPC 消息的上限，客户端和服务端相同
+	MaxMessageSize = 16 << 20
+	// DefaultUnaryTimeout 用于没有设置 deadline 的一元调用，流式调用可以长时间运行，不设默认值
+	DefaultUnaryTimeout = 30 * time.Second
+)
+
+// ServerOptions 返回创建 gRPC server 时需要的选项。拦截器从外到内依次是：
+// 请求 ID 和日志、指标、panic 恢复、默认 deadline，所以日志和指标能看到
+// panic 转换后的状态码
+func (s *WSLServer) ServerOptions() []grpcLib.ServerOption {
+	return []grpcLib.ServerOption{
+		grpcLib.MaxRecvMsgSize(MaxMessageSize),
+		grpcLib.MaxSendMsgSize(MaxMessageSize),
+		// 允许客户端用 keepalive 检测 agent 是否还活着
+		grpcLib.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+			MinTime:             5 * time.Second,
+			PermitWithoutStream: true,
+		}),
+		grpcLib.ChainUnaryInterceptor(
+			loggingUnaryInterceptor,
+			s.metrics.unaryInterceptor,
+			recoveryUnaryInterceptor,
+			deadlineUnaryInterceptor,
+		),
+		grpcLib.ChainStreamInterceptor(
+			loggingStreamInterceptor,
+			s.metrics.streamInterceptor,
+			recoveryStreamInterceptor,
+		),
+	}
+}
+
+// NewRequestID 生成一个新的请求 ID
+func NewRequestID() string {
+	return newSessionID()
+}
+
+// WithRequestID 把请求 ID 放进发往 agent 的 metadata，id 为空时生成一个。
+// 返回的 ID 用于在 provider 日志中关联 agent 日志
+func WithRequestID(ctx context.Context, id string) (context.Context, string) {
+	if id == "" {
+		id = NewRequestID()
+	}
+	return metadata.AppendToOutgoingContext(ctx, RequestIDKey, id), id
+}
+
+// outgoingRequestID 返回已经放进发出 metadata 的请求 ID
+func outgoingRequestID(ctx context.Context) string {
+	if md, ok := metadata.FromOutgoingContext(ctx); ok {
+		if ids := md.Get(RequestIDKey); len(ids) > 0 {
+			return ids[0]
+		}
+	}
+	return ""
+}
+
+type requestIDContextKey struct{}
+
+// RequestID 返回服务端处理中的请求 ID
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDContextKey{}).(string)
+	return id
+}
+
+// incomingRequestID 读取客户端带来的请求 ID，老版本客户端不带时由 agent 生成
+func incomingRequestID(ctx context.Context) context.Context {
+	id := ""
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if ids := md.Get(RequestIDKey); len(ids) > 0 {
+			id = ids[0]
+		}
+	}
+	if id == "" {
+		id = NewRequestID()
+	}
+	return context.WithValue(ctx, requestIDContextKey{}, id)
+}
+
+// contextStream 替换 ServerStream 的 context
+type contextStream struct {
+	grpcLib.ServerStream
+	ctx context.Context
+}
+
+func (c *contextStream) Context() context.Context {
+	return c.ctx
+}
+
+// logCall 记录一次调用的方法、耗时和状态，失败的调用用 warn 级别
+func logCall(ctx context.Context, fullMethod string, started time.Time, err error) {
+	code := status.Code(err)
+	level := slog.LevelDebug
+	if code != codes.OK && code != codes.Canceled {
+		level = slog.LevelWarn
+	}
+	attrs := []any{
+		"method", path.Base(fullMethod),
+		"duration", time.Since(started),
+		"code", code.String(),
+		"request_id", RequestID(ctx),
+	}
+	if err != nil {
+		attrs = append(attrs, "error", status.Convert(err).Message())
+	}
+	slog.Log(ctx, level, "RPC finished", attrs...)
+}
+
+func loggingUnaryInterceptor(ctx context.Context, req any, info *grpcLib.UnaryServerInfo, handler grpcLib.UnaryHandler) (any, error) {
+	ctx = incomingRequestID(ctx)
+	started := time.Now()
+	resp, err := handler(ctx, req)
+	logCall(ctx, info.FullMethod, started, err)
+	return resp, err
+}
+
+func loggingStreamInterceptor(srv any, stream grpcLib.ServerStream, info *grpcLib.StreamServerInfo, handler grpcLib.StreamHandler) error {
+	ctx := incomingRequestID(stream.Context())
+	started := time.Now()
+	err := handler(srv, &contextStream{ServerStream: stream, ctx: ctx})
+	logCall(ctx, info.FullMethod, started, err)
+	return err
+}
+
+// recovered 把 handler 中的 panic 转成 codes.Internal，agent 继续运行
+func recovered(ctx context.Context, fullMethod string, err *error) {
+	if r := recover(); r != nil {
+		slog.Error("RPC panicked", "method", path.Base(fullMethod), "request_id", RequestID(ctx),
+			"panic", r, "stack", string(debug.Stack()))
+		*err = status.Errorf(codes.Internal, "internal error in %s", path.Base(fullMethod))
+	}
+}
+
+func recoveryUnaryInterceptor(ctx context.Context, req any, info *grpcLib.UnaryServerInfo, handler grpcLib.UnaryHandler) (resp any, err error) {
+	defer recovered(ctx, info.FullMethod, &err)
+	return handler(ctx, req)
+}
+
+func recoveryStreamInterceptor(srv any, stream grpcLib.ServerStream, info *grpcLib.StreamServerInfo, handler grpcLib.StreamHandler) (err error) {
+	defer recovered(stream.Context(), info.FullMethod, &err)
+	return handler(srv, stream)
+}
+
+// deadlineUnaryInterceptor 给没有 deadline 的一元调用加上 DefaultUnaryTimeout
+func deadlineUnaryInterceptor(ctx context.Context, req any, info *grpcLib.UnaryServerInfo, handler grpcLib.UnaryHandler) (any, error) {
+	if _, ok := ctx.Deadline(); !ok && DefaultUnaryTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, DefaultUnaryTimeout)
+		defer cancel()
+	}
+	return handler(ctx, req)
+}
+
+// requestIDUnaryClientInterceptor 保证每个调用都带请求 ID
+func requestIDUnaryClientInterceptor(ctx context.Context, method string, req, reply any, cc *grpcLib.ClientConn, invoker grpcLib.UnaryInvoker, opts ...grpcLib.CallOption) error {
+	if outgoingRequestID(ctx) == "" {
+		ctx, _ = WithRequestID(ctx, "")
+	}
+	return invoker(ctx, method, req, reply, cc, opts...)
+}
+
+func requestIDStreamClientInterceptor(ctx context.Context, desc *grpcLib.StreamDesc, cc *grpcLib.ClientConn, method string, streamer grpcLib.Streamer, opts ...grpcLib.CallOption) (grpcLib.ClientStream, error) {
+	if outgoingRequestID(ctx) == "" {
+		ctx, _ = WithRequestID(ctx, "")
+	}
+	return streamer(ctx, desc, cc, method, opts...)
+}
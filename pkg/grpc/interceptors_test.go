@@ -0,0 +1,141 @@
+package grpc
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	pb "github.com/cosysn/devpod-provider-wsl/pkg/grpc/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// panickingServer panics in Status, every other RPC works
+type panickingServer struct {
+	*WSLServer
+}
+
+func (p *panickingServer) Status(ctx context.Context, req *pb.Empty) (*pb.AgentStatus, error) {
+	panic("boom")
+}
+
+// servePanicking serves a panickingServer with the agent's server options
+func servePanicking(t *testing.T) *Client {
+	t.Helper()
+	socketPath := filepath.Join(t.TempDir(), "agent.sock")
+	wslServer := NewWSLServer()
+	serveService(t, socketPath, &panickingServer{wslServer}, wslServer.ServerOptions()...)
+
+	client, err := NewClient(socketPath, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+// logBuffer is written by server goroutines while the test reads it
+type logBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (l *logBuffer) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.buf.Write(p)
+}
+
+func (l *logBuffer) String() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.buf.String()
+}
+
+// captureLogs sends slog output to a buffer for the rest of the test
+func captureLogs(t *testing.T) *logBuffer {
+	t.Helper()
+	buf := &logBuffer{}
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+	return buf
+}
+
+func TestInterceptors_RecoverPanic(t *testing.T) {
+	logs := captureLogs(t)
+	client := servePanicking(t)
+
+	_, err := client.Status(context.Background())
+	if status.Code(err) != codes.Internal {
+		t.Fatalf("Status error = %v, want Internal", err)
+	}
+	// The agent keeps serving after the panic
+	if _, err := client.Health(context.Background()); err != nil {
+		t.Fatalf("Health after panic: %v", err)
+	}
+	if !strings.Contains(logs.String(), `"msg":"RPC panicked"`) || !strings.Contains(logs.String(), `"code":"Internal"`) {
+		t.Errorf("panic not logged:\n%s", logs)
+	}
+}
+
+func TestInterceptors_RequestIDIsLogged(t *testing.T) {
+	logs := captureLogs(t)
+	client := serveAgent(t)
+
+	ctx, id := WithRequestID(context.Background(), "")
+	if _, err := client.Status(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if code, _ := waitExec(t, execOn(t, ctx, client, "exit 0\n"), "", nil); code != 0 {
+		t.Fatalf("exit code = %d", code)
+	}
+
+	for _, want := range []string{`"method":"Status"`, `"msg":"Session started"`, `"request_id":"` + id + `"`} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("logs are missing %s:\n%s", want, logs)
+		}
+	}
+}
+
+func TestInterceptors_MaxMessageSize(t *testing.T) {
+	defer func(size int) { MaxMessageSize = size }(MaxMessageSize)
+	MaxMessageSize = 1024
+	client := serveAgent(t)
+
+	_, err := client.Start(context.Background(), "echo "+strings.Repeat("x", 2048), "", nil)
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("Start error = %v, want ResourceExhausted", err)
+	}
+}
+
+func TestDeadlineUnaryInterceptor(t *testing.T) {
+	defer func(timeout time.Duration) { DefaultUnaryTimeout = timeout }(DefaultUnaryTimeout)
+	DefaultUnaryTimeout = time.Minute
+
+	remaining := func(ctx context.Context) time.Duration {
+		var left time.Duration
+		deadlineUnaryInterceptor(ctx, nil, &grpc.UnaryServerInfo{}, func(ctx context.Context, req any) (any, error) {
+			if deadline, ok := ctx.Deadline(); ok {
+				left = time.Until(deadline)
+			}
+			return nil, nil
+		})
+		return left
+	}
+
+	if left := remaining(context.Background()); left <= 50*time.Second || left > time.Minute {
+		t.Errorf("default deadline in %s, want about a minute", left)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if left := remaining(ctx); left > time.Second {
+		t.Errorf("caller deadline replaced, %s left", left)
+	}
+}
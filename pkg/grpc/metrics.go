@@ -0,0 +1,117 @@
+package grpc
+
+import (
+	"context"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	pb "github.com/cosysn/devpod-provider-wsl/pkg/grpc/proto"
+	"github.com/cosysn/devpod-provider-wsl/pkg/metrics"
+	grpcLib "google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// agentMetrics 是 agent 暴露的指标，RPC 相关的由拦截器统计
+type agentMetrics struct {
+	registry *metrics.Registry
+	requests *metrics.Counter
+	received *metrics.Counter
+	sent     *metrics.Counter
+	duration *metrics.Histogram
+	exits    *metrics.Counter
+}
+
+func newAgentMetrics(s *WSLServer) *agentMetrics {
+	r := metrics.NewRegistry()
+	m := &agentMetrics{
+		registry: r,
+		requests: r.Counter("devpod_agent_rpc_requests_total", "Finished RPCs by method and status code.", "method", "code"),
+		received: r.Counter("devpod_agent_rpc_received_bytes_total", "Bytes of request messages received by method.", "method"),
+		sent:     r.Counter("devpod_agent_rpc_sent_bytes_total", "Bytes of response messages sent by method.", "method"),
+		duration: r.Histogram("devpod_agent_command_duration_seconds", "Run time of Exec commands.", metrics.DefaultBuckets),
+		exits:    r.Counter("devpod_agent_command_exits_total", "Exited Exec commands by exit code.", "code"),
+	}
+	r.GaugeFunc("devpod_agent_sessions_active", "Exec sessions whose command is still running.", func() float64 {
+		return float64(s.activeSessions())
+	})
+	r.GaugeFunc("devpod_agent_processes", "Processes started through Start and not stopped yet.", func() float64 {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return float64(len(s.processes))
+	})
+	r.GaugeFunc("devpod_agent_uptime_seconds", "Seconds since the agent started.", func() float64 {
+		return time.Since(s.started).Seconds()
+	})
+	return m
+}
+
+// commandExited 记录一个 Exec 命令的运行时长和退出码
+func (m *agentMetrics) commandExited(started time.Time, code int) {
+	m.duration.Observe(time.Since(started).Seconds())
+	m.exits.Inc(strconv.Itoa(code))
+}
+
+func (m *agentMetrics) unaryInterceptor(ctx context.Context, req any, info *grpcLib.UnaryServerInfo, handler grpcLib.UnaryHandler) (any, error) {
+	method := path.Base(info.FullMethod)
+	m.received.Add(messageSize(req), method)
+	resp, err := handler(ctx, req)
+	if err == nil {
+		m.sent.Add(messageSize(resp), method)
+	}
+	m.requests.Inc(method, status.Code(err).String())
+	return resp, err
+}
+
+func (m *agentMetrics) streamInterceptor(srv any, stream grpcLib.ServerStream, info *grpcLib.StreamServerInfo, handler grpcLib.StreamHandler) error {
+	method := path.Base(info.FullMethod)
+	err := handler(srv, &countingStream{ServerStream: stream, method: method, metrics: m})
+	m.requests.Inc(method, status.Code(err).String())
+	return err
+}
+
+// countingStream 统计流上收发的消息字节数
+type countingStream struct {
+	grpcLib.ServerStream
+	method  string
+	metrics *agentMetrics
+}
+
+func (c *countingStream) SendMsg(msg any) error {
+	err := c.ServerStream.SendMsg(msg)
+	if err == nil {
+		c.metrics.sent.Add(messageSize(msg), c.method)
+	}
+	return err
+}
+
+func (c *countingStream) RecvMsg(msg any) error {
+	err := c.ServerStream.RecvMsg(msg)
+	if err == nil {
+		c.metrics.received.Add(messageSize(msg), c.method)
+	}
+	return err
+}
+
+func messageSize(msg any) float64 {
+	if m, ok := msg.(proto.Message); ok {
+		return float64(proto.Size(m))
+	}
+	return 0
+}
+
+// MetricsHandler 以 Prometheus 文本格式提供指标
+func (s *WSLServer) MetricsHandler() http.Handler {
+	return s.metrics.registry
+}
+
+func (s *WSLServer) Metrics(ctx context.Context, req *pb.Empty) (*pb.MetricsResponse, error) {
+	var text strings.Builder
+	if err := s.metrics.registry.WriteText(&text); err != nil {
+		return nil, err
+	}
+	return &pb.MetricsResponse{Text: text.String()}, nil
+}
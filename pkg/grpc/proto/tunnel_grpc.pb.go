@@ -19,14 +19,18 @@ import (
 const _ = grpc.SupportPackageIsVersion9
 
 const (
-	DevPodWSLService_Start_FullMethodName  = "/tunnel.DevPodWSLService/Start"
-	DevPodWSLService_Stop_FullMethodName   = "/tunnel.DevPodWSLService/Stop"
-	DevPodWSLService_Exec_FullMethodName   = "/tunnel.DevPodWSLService/Exec"
-	DevPodWSLService_Stdin_FullMethodName  = "/tunnel.DevPodWSLService/Stdin"
-	DevPodWSLService_Stdout_FullMethodName = "/tunnel.DevPodWSLService/Stdout"
-	DevPodWSLService_Stderr_FullMethodName = "/tunnel.DevPodWSLService/Stderr"
-	DevPodWSLService_Status_FullMethodName = "/tunnel.DevPodWSLService/Status"
-	DevPodWSLService_Upload_FullMethodName = "/tunnel.DevPodWSLService/Upload"
+	DevPodWSLService_Start_FullMethodName   = "/tunnel.DevPodWSLService/Start"
+	DevPodWSLService_Stop_FullMethodName    = "/tunnel.DevPodWSLService/Stop"
+	DevPodWSLService_Exec_FullMethodName    = "/tunnel.DevPodWSLService/Exec"
+	DevPodWSLService_Attach_FullMethodName  = "/tunnel.DevPodWSLService/Attach"
+	DevPodWSLService_Stdin_FullMethodName   = "/tunnel.DevPodWSLService/Stdin"
+	DevPodWSLService_Stdout_FullMethodName  = "/tunnel.DevPodWSLService/Stdout"
+	DevPodWSLService_Stderr_FullMethodName  = "/tunnel.DevPodWSLService/Stderr"
+	DevPodWSLService_Status_FullMethodName  = "/tunnel.DevPodWSLService/Status"
+	DevPodWSLService_Health_FullMethodName  = "/tunnel.DevPodWSLService/Health"
+	DevPodWSLService_Metrics_FullMethodName = "/tunnel.DevPodWSLService/Metrics"
+	DevPodWSLService_Upload_FullMethodName  = "/tunnel.DevPodWSLService/Upload"
+	DevPodWSLService_Upgrade_FullMethodName = "/tunnel.DevPodWSLService/Upgrade"
 )
 
 // DevPodWSLServiceClient is the client API for DevPodWSLService service.
@@ -36,11 +40,22 @@ type DevPodWSLServiceClient interface {
 	Start(ctx context.Context, in *StartRequest, opts ...grpc.CallOption) (*StartResponse, error)
 	Stop(ctx context.Context, in *StopRequest, opts ...grpc.CallOption) (*StopResponse, error)
 	Exec(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[ExecRequest, ExecResponse], error)
+	// Attach reconnects to a running Exec session, the first request carries session_id
+	Attach(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[ExecRequest, ExecResponse], error)
 	Stdin(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[StdinRequest, Empty], error)
 	Stdout(ctx context.Context, in *Empty, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Data], error)
 	Stderr(ctx context.Context, in *Empty, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Data], error)
 	Status(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*AgentStatus, error)
+	// Health reports resource usage and the result of every subsystem check
+	Health(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*HealthResponse, error)
+	// Metrics returns the agent metrics in the Prometheus text format
+	Metrics(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*MetricsResponse, error)
 	Upload(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[Chunk, UploadResponse], error)
+	// Upgrade streams a new agent binary, the agent restarts itself in place
+	// once it is verified and installed. The socket is handed over, sessions
+	// are not: the upgrade is refused while commands run unless force is set,
+	// which terminates them
+	Upgrade(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[UpgradeChunk, UpgradeResponse], error)
 }
 
 type devPodWSLServiceClient struct {
@@ -84,9 +99,22 @@ func (c *devPodWSLServiceClient) Exec(ctx context.Context, opts ...grpc.CallOpti
 // This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
 type DevPodWSLService_ExecClient = grpc.BidiStreamingClient[ExecRequest, ExecResponse]
 
+func (c *devPodWSLServiceClient) Attach(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[ExecRequest, ExecResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &DevPodWSLService_ServiceDesc.Streams[1], DevPodWSLService_Attach_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ExecRequest, ExecResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type DevPodWSLService_AttachClient = grpc.BidiStreamingClient[ExecRequest, ExecResponse]
+
 func (c *devPodWSLServiceClient) Stdin(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[StdinRequest, Empty], error) {
 	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
-	stream, err := c.cc.NewStream(ctx, &DevPodWSLService_ServiceDesc.Streams[1], DevPodWSLService_Stdin_FullMethodName, cOpts...)
+	stream, err := c.cc.NewStream(ctx, &DevPodWSLService_ServiceDesc.Streams[2], DevPodWSLService_Stdin_FullMethodName, cOpts...)
 	if err != nil {
 		return nil, err
 	}
@@ -99,7 +127,7 @@ type DevPodWSLService_StdinClient = grpc.ClientStreamingClient[StdinRequest, Emp
 
 func (c *devPodWSLServiceClient) Stdout(ctx context.Context, in *Empty, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Data], error) {
 	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
-	stream, err := c.cc.NewStream(ctx, &DevPodWSLService_ServiceDesc.Streams[2], DevPodWSLService_Stdout_FullMethodName, cOpts...)
+	stream, err := c.cc.NewStream(ctx, &DevPodWSLService_ServiceDesc.Streams[3], DevPodWSLService_Stdout_FullMethodName, cOpts...)
 	if err != nil {
 		return nil, err
 	}
@@ -118,7 +146,7 @@ type DevPodWSLService_StdoutClient = grpc.ServerStreamingClient[Data]
 
 func (c *devPodWSLServiceClient) Stderr(ctx context.Context, in *Empty, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Data], error) {
 	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
-	stream, err := c.cc.NewStream(ctx, &DevPodWSLService_ServiceDesc.Streams[3], DevPodWSLService_Stderr_FullMethodName, cOpts...)
+	stream, err := c.cc.NewStream(ctx, &DevPodWSLService_ServiceDesc.Streams[4], DevPodWSLService_Stderr_FullMethodName, cOpts...)
 	if err != nil {
 		return nil, err
 	}
@@ -145,9 +173,29 @@ func (c *devPodWSLServiceClient) Status(ctx context.Context, in *Empty, opts ...
 	return out, nil
 }
 
+func (c *devPodWSLServiceClient) Health(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*HealthResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(HealthResponse)
+	err := c.cc.Invoke(ctx, DevPodWSLService_Health_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *devPodWSLServiceClient) Metrics(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*MetricsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(MetricsResponse)
+	err := c.cc.Invoke(ctx, DevPodWSLService_Metrics_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *devPodWSLServiceClient) Upload(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[Chunk, UploadResponse], error) {
 	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
-	stream, err := c.cc.NewStream(ctx, &DevPodWSLService_ServiceDesc.Streams[4], DevPodWSLService_Upload_FullMethodName, cOpts...)
+	stream, err := c.cc.NewStream(ctx, &DevPodWSLService_ServiceDesc.Streams[5], DevPodWSLService_Upload_FullMethodName, cOpts...)
 	if err != nil {
 		return nil, err
 	}
@@ -158,6 +206,19 @@ func (c *devPodWSLServiceClient) Upload(ctx context.Context, opts ...grpc.CallOp
 // This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
 type DevPodWSLService_UploadClient = grpc.ClientStreamingClient[Chunk, UploadResponse]
 
+func (c *devPodWSLServiceClient) Upgrade(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[UpgradeChunk, UpgradeResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &DevPodWSLService_ServiceDesc.Streams[6], DevPodWSLService_Upgrade_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[UpgradeChunk, UpgradeResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type DevPodWSLService_UpgradeClient = grpc.ClientStreamingClient[UpgradeChunk, UpgradeResponse]
+
 // DevPodWSLServiceServer is the server API for DevPodWSLService service.
 // All implementations must embed UnimplementedDevPodWSLServiceServer
 // for forward compatibility.
@@ -165,11 +226,22 @@ type DevPodWSLServiceServer interface {
 	Start(context.Context, *StartRequest) (*StartResponse, error)
 	Stop(context.Context, *StopRequest) (*StopResponse, error)
 	Exec(grpc.BidiStreamingServer[ExecRequest, ExecResponse]) error
+	// Attach reconnects to a running Exec session, the first request carries session_id
+	Attach(grpc.BidiStreamingServer[ExecRequest, ExecResponse]) error
 	Stdin(grpc.ClientStreamingServer[StdinRequest, Empty]) error
 	Stdout(*Empty, grpc.ServerStreamingServer[Data]) error
 	Stderr(*Empty, grpc.ServerStreamingServer[Data]) error
 	Status(context.Context, *Empty) (*AgentStatus, error)
+	// Health reports resource usage and the result of every subsystem check
+	Health(context.Context, *Empty) (*HealthResponse, error)
+	// Metrics returns the agent metrics in the Prometheus text format
+	Metrics(context.Context, *Empty) (*MetricsResponse, error)
 	Upload(grpc.ClientStreamingServer[Chunk, UploadResponse]) error
+	// Upgrade streams a new agent binary, the agent restarts itself in place
+	// once it is verified and installed. The socket is handed over, sessions
+	// are not: the upgrade is refused while commands run unless force is set,
+	// which terminates them
+	Upgrade(grpc.ClientStreamingServer[UpgradeChunk, UpgradeResponse]) error
 	mustEmbedUnimplementedDevPodWSLServiceServer()
 }
 
@@ -189,6 +261,9 @@ func (UnimplementedDevPodWSLServiceServer) Stop(context.Context, *StopRequest) (
 func (UnimplementedDevPodWSLServiceServer) Exec(grpc.BidiStreamingServer[ExecRequest, ExecResponse]) error {
 	return status.Errorf(codes.Unimplemented, "method Exec not implemented")
 }
+func (UnimplementedDevPodWSLServiceServer) Attach(grpc.BidiStreamingServer[ExecRequest, ExecResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method Attach not implemented")
+}
 func (UnimplementedDevPodWSLServiceServer) Stdin(grpc.ClientStreamingServer[StdinRequest, Empty]) error {
 	return status.Errorf(codes.Unimplemented, "method Stdin not implemented")
 }
@@ -201,9 +276,18 @@ func (UnimplementedDevPodWSLServiceServer) Stderr(*Empty, grpc.ServerStreamingSe
 func (UnimplementedDevPodWSLServiceServer) Status(context.Context, *Empty) (*AgentStatus, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Status not implemented")
 }
+func (UnimplementedDevPodWSLServiceServer) Health(context.Context, *Empty) (*HealthResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Health not implemented")
+}
+func (UnimplementedDevPodWSLServiceServer) Metrics(context.Context, *Empty) (*MetricsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Metrics not implemented")
+}
 func (UnimplementedDevPodWSLServiceServer) Upload(grpc.ClientStreamingServer[Chunk, UploadResponse]) error {
 	return status.Errorf(codes.Unimplemented, "method Upload not implemented")
 }
+func (UnimplementedDevPodWSLServiceServer) Upgrade(grpc.ClientStreamingServer[UpgradeChunk, UpgradeResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method Upgrade not implemented")
+}
 func (UnimplementedDevPodWSLServiceServer) mustEmbedUnimplementedDevPodWSLServiceServer() {}
 func (UnimplementedDevPodWSLServiceServer) testEmbeddedByValue()                          {}
 
@@ -268,6 +352,13 @@ func _DevPodWSLService_Exec_Handler(srv interface{}, stream grpc.ServerStream) e
 // This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
 type DevPodWSLService_ExecServer = grpc.BidiStreamingServer[ExecRequest, ExecResponse]
 
+func _DevPodWSLService_Attach_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(DevPodWSLServiceServer).Attach(&grpc.GenericServerStream[ExecRequest, ExecResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type DevPodWSLService_AttachServer = grpc.BidiStreamingServer[ExecRequest, ExecResponse]
+
 func _DevPodWSLService_Stdin_Handler(srv interface{}, stream grpc.ServerStream) error {
 	return srv.(DevPodWSLServiceServer).Stdin(&grpc.GenericServerStream[StdinRequest, Empty]{ServerStream: stream})
 }
@@ -315,6 +406,42 @@ func _DevPodWSLService_Status_Handler(srv interface{}, ctx context.Context, dec
 	return interceptor(ctx, in, info, handler)
 }
 
+func _DevPodWSLService_Health_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DevPodWSLServiceServer).Health(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: DevPodWSLService_Health_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DevPodWSLServiceServer).Health(ctx, req.(*Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _DevPodWSLService_Metrics_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DevPodWSLServiceServer).Metrics(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: DevPodWSLService_Metrics_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DevPodWSLServiceServer).Metrics(ctx, req.(*Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _DevPodWSLService_Upload_Handler(srv interface{}, stream grpc.ServerStream) error {
 	return srv.(DevPodWSLServiceServer).Upload(&grpc.GenericServerStream[Chunk, UploadResponse]{ServerStream: stream})
 }
@@ -322,6 +449,13 @@ func _DevPodWSLService_Upload_Handler(srv interface{}, stream grpc.ServerStream)
 // This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
 type DevPodWSLService_UploadServer = grpc.ClientStreamingServer[Chunk, UploadResponse]
 
+func _DevPodWSLService_Upgrade_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(DevPodWSLServiceServer).Upgrade(&grpc.GenericServerStream[UpgradeChunk, UpgradeResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type DevPodWSLService_UpgradeServer = grpc.ClientStreamingServer[UpgradeChunk, UpgradeResponse]
+
 // DevPodWSLService_ServiceDesc is the grpc.ServiceDesc for DevPodWSLService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -341,6 +475,14 @@ var DevPodWSLService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "Status",
 			Handler:    _DevPodWSLService_Status_Handler,
 		},
+		{
+			MethodName: "Health",
+			Handler:    _DevPodWSLService_Health_Handler,
+		},
+		{
+			MethodName: "Metrics",
+			Handler:    _DevPodWSLService_Metrics_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{
 		{
@@ -349,6 +491,12 @@ var DevPodWSLService_ServiceDesc = grpc.ServiceDesc{
 			ServerStreams: true,
 			ClientStreams: true,
 		},
+		{
+			StreamName:    "Attach",
+			Handler:       _DevPodWSLService_Attach_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
 		{
 			StreamName:    "Stdin",
 			Handler:       _DevPodWSLService_Stdin_Handler,
@@ -369,6 +517,397 @@ var DevPodWSLService_ServiceDesc = grpc.ServiceDesc{
 			Handler:       _DevPodWSLService_Upload_Handler,
 			ClientStreams: true,
 		},
+		{
+			StreamName:    "Upgrade",
+			Handler:       _DevPodWSLService_Upgrade_Handler,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "pkg/grpc/proto/tunnel.proto",
+}
+
+const (
+	FileService_Stat_FullMethodName     = "/tunnel.FileService/Stat"
+	FileService_ReadDir_FullMethodName  = "/tunnel.FileService/ReadDir"
+	FileService_MkdirAll_FullMethodName = "/tunnel.FileService/MkdirAll"
+	FileService_Remove_FullMethodName   = "/tunnel.FileService/Remove"
+	FileService_Rename_FullMethodName   = "/tunnel.FileService/Rename"
+	FileService_Chmod_FullMethodName    = "/tunnel.FileService/Chmod"
+	FileService_Symlink_FullMethodName  = "/tunnel.FileService/Symlink"
+	FileService_Watch_FullMethodName    = "/tunnel.FileService/Watch"
+)
+
+// FileServiceClient is the client API for FileService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// FileService manipulates files below the agent's file root. Paths are
+// relative to the root or absolute inside it; paths leaving the root, also
+// through symlinks, fail with PERMISSION_DENIED.
+type FileServiceClient interface {
+	// Stat does not follow a symlink in the last path element
+	Stat(ctx context.Context, in *StatRequest, opts ...grpc.CallOption) (*FileInfo, error)
+	ReadDir(ctx context.Context, in *ReadDirRequest, opts ...grpc.CallOption) (*ReadDirResponse, error)
+	MkdirAll(ctx context.Context, in *MkdirRequest, opts ...grpc.CallOption) (*Empty, error)
+	Remove(ctx context.Context, in *RemoveRequest, opts ...grpc.CallOption) (*Empty, error)
+	Rename(ctx context.Context, in *RenameRequest, opts ...grpc.CallOption) (*Empty, error)
+	Chmod(ctx context.Context, in *ChmodRequest, opts ...grpc.CallOption) (*Empty, error)
+	Symlink(ctx context.Context, in *SymlinkRequest, opts ...grpc.CallOption) (*Empty, error)
+	// Watch reports changes below a directory until the call is cancelled.
+	// The response headers are sent once every directory is watched.
+	Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[WatchEvent], error)
+}
+
+type fileServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewFileServiceClient(cc grpc.ClientConnInterface) FileServiceClient {
+	return &fileServiceClient{cc}
+}
+
+func (c *fileServiceClient) Stat(ctx context.Context, in *StatRequest, opts ...grpc.CallOption) (*FileInfo, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(FileInfo)
+	err := c.cc.Invoke(ctx, FileService_Stat_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fileServiceClient) ReadDir(ctx context.Context, in *ReadDirRequest, opts ...grpc.CallOption) (*ReadDirResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ReadDirResponse)
+	err := c.cc.Invoke(ctx, FileService_ReadDir_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fileServiceClient) MkdirAll(ctx context.Context, in *MkdirRequest, opts ...grpc.CallOption) (*Empty, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, FileService_MkdirAll_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fileServiceClient) Remove(ctx context.Context, in *RemoveRequest, opts ...grpc.CallOption) (*Empty, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, FileService_Remove_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fileServiceClient) Rename(ctx context.Context, in *RenameRequest, opts ...grpc.CallOption) (*Empty, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, FileService_Rename_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fileServiceClient) Chmod(ctx context.Context, in *ChmodRequest, opts ...grpc.CallOption) (*Empty, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, FileService_Chmod_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fileServiceClient) Symlink(ctx context.Context, in *SymlinkRequest, opts ...grpc.CallOption) (*Empty, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, FileService_Symlink_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fileServiceClient) Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[WatchEvent], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &FileService_ServiceDesc.Streams[0], FileService_Watch_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchRequest, WatchEvent]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type FileService_WatchClient = grpc.ServerStreamingClient[WatchEvent]
+
+// FileServiceServer is the server API for FileService service.
+// All implementations must embed UnimplementedFileServiceServer
+// for forward compatibility.
+//
+// FileService manipulates files below the agent's file root. Paths are
+// relative to the root or absolute inside it; paths leaving the root, also
+// through symlinks, fail with PERMISSION_DENIED.
+type FileServiceServer interface {
+	// Stat does not follow a symlink in the last path element
+	Stat(context.Context, *StatRequest) (*FileInfo, error)
+	ReadDir(context.Context, *ReadDirRequest) (*ReadDirResponse, error)
+	MkdirAll(context.Context, *MkdirRequest) (*Empty, error)
+	Remove(context.Context, *RemoveRequest) (*Empty, error)
+	Rename(context.Context, *RenameRequest) (*Empty, error)
+	Chmod(context.Context, *ChmodRequest) (*Empty, error)
+	Symlink(context.Context, *SymlinkRequest) (*Empty, error)
+	// Watch reports changes below a directory until the call is cancelled.
+	// The response headers are sent once every directory is watched.
+	Watch(*WatchRequest, grpc.ServerStreamingServer[WatchEvent]) error
+	mustEmbedUnimplementedFileServiceServer()
+}
+
+// UnimplementedFileServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedFileServiceServer struct{}
+
+func (UnimplementedFileServiceServer) Stat(context.Context, *StatRequest) (*FileInfo, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Stat not implemented")
+}
+func (UnimplementedFileServiceServer) ReadDir(context.Context, *ReadDirRequest) (*ReadDirResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ReadDir not implemented")
+}
+func (UnimplementedFileServiceServer) MkdirAll(context.Context, *MkdirRequest) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method MkdirAll not implemented")
+}
+func (UnimplementedFileServiceServer) Remove(context.Context, *RemoveRequest) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Remove not implemented")
+}
+func (UnimplementedFileServiceServer) Rename(context.Context, *RenameRequest) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Rename not implemented")
+}
+func (UnimplementedFileServiceServer) Chmod(context.Context, *ChmodRequest) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Chmod not implemented")
+}
+func (UnimplementedFileServiceServer) Symlink(context.Context, *SymlinkRequest) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Symlink not implemented")
+}
+func (UnimplementedFileServiceServer) Watch(*WatchRequest, grpc.ServerStreamingServer[WatchEvent]) error {
+	return status.Errorf(codes.Unimplemented, "method Watch not implemented")
+}
+func (UnimplementedFileServiceServer) mustEmbedUnimplementedFileServiceServer() {}
+func (UnimplementedFileServiceServer) testEmbeddedByValue()                     {}
+
+// UnsafeFileServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to FileServiceServer will
+// result in compilation errors.
+type UnsafeFileServiceServer interface {
+	mustEmbedUnimplementedFileServiceServer()
+}
+
+func RegisterFileServiceServer(s grpc.ServiceRegistrar, srv FileServiceServer) {
+	// If the following call pancis, it indicates UnimplementedFileServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&FileService_ServiceDesc, srv)
+}
+
+func _FileService_Stat_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StatRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FileServiceServer).Stat(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FileService_Stat_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FileServiceServer).Stat(ctx, req.(*StatRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FileService_ReadDir_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReadDirRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FileServiceServer).ReadDir(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FileService_ReadDir_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FileServiceServer).ReadDir(ctx, req.(*ReadDirRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FileService_MkdirAll_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MkdirRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FileServiceServer).MkdirAll(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FileService_MkdirAll_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FileServiceServer).MkdirAll(ctx, req.(*MkdirRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FileService_Remove_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RemoveRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FileServiceServer).Remove(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FileService_Remove_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FileServiceServer).Remove(ctx, req.(*RemoveRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FileService_Rename_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RenameRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FileServiceServer).Rename(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FileService_Rename_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FileServiceServer).Rename(ctx, req.(*RenameRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FileService_Chmod_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ChmodRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FileServiceServer).Chmod(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FileService_Chmod_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FileServiceServer).Chmod(ctx, req.(*ChmodRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FileService_Symlink_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SymlinkRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FileServiceServer).Symlink(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FileService_Symlink_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FileServiceServer).Symlink(ctx, req.(*SymlinkRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FileService_Watch_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(FileServiceServer).Watch(m, &grpc.GenericServerStream[WatchRequest, WatchEvent]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type FileService_WatchServer = grpc.ServerStreamingServer[WatchEvent]
+
+// FileService_ServiceDesc is the grpc.ServiceDesc for FileService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var FileService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "tunnel.FileService",
+	HandlerType: (*FileServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Stat",
+			Handler:    _FileService_Stat_Handler,
+		},
+		{
+			MethodName: "ReadDir",
+			Handler:    _FileService_ReadDir_Handler,
+		},
+		{
+			MethodName: "MkdirAll",
+			Handler:    _FileService_MkdirAll_Handler,
+		},
+		{
+			MethodName: "Remove",
+			Handler:    _FileService_Remove_Handler,
+		},
+		{
+			MethodName: "Rename",
+			Handler:    _FileService_Rename_Handler,
+		},
+		{
+			MethodName: "Chmod",
+			Handler:    _FileService_Chmod_Handler,
+		},
+		{
+			MethodName: "Symlink",
+			Handler:    _FileService_Symlink_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Watch",
+			Handler:       _FileService_Watch_Handler,
+			ServerStreams: true,
+		},
 	},
 	Metadata: "pkg/grpc/proto/tunnel.proto",
 }
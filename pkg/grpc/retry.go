@@ -0,0 +1,126 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+
+	pb "github.com/cosysn/devpod-provider-wsl/pkg/grpc/proto"
+	grpcLib "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// 客户端返回的错误类型，调用方据此决定启动、重启还是重新安装 agent。
+// 这些错误包装了原始的 gRPC 错误，status.Code 仍然可用
+var (
+	// ErrAgentNotRunning socket 不存在或拒绝连接，需要启动 agent
+	ErrAgentNotRunning = errors.New("agent is not running")
+	// ErrAgentUnavailable 连接断开或 keepalive 超时，需要重启 agent
+	ErrAgentUnavailable = errors.New("agent is not responding")
+	// ErrAgentOutdated agent 不支持这个 RPC，需要重新安装新版本
+	ErrAgentOutdated = errors.New("agent does not support this call")
+)
+
+// RetryPolicy 决定幂等 RPC 在 agent 暂时不可用时的重试方式
+type RetryPolicy struct {
+	// MaxAttempts 包括第一次调用，1 表示不重试
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+}
+
+// DefaultRetryPolicy 覆盖 agent 重启所需的几秒钟
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    5,
+	InitialBackoff: 100 * time.Millisecond,
+	MaxBackoff:     2 * time.Second,
+	Multiplier:     2,
+}
+
+// backoff 返回第 attempt 次重试前的等待时间，attempt 从 1 开始
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	delay := float64(p.InitialBackoff)
+	for i := 1; i < attempt; i++ {
+		delay *= p.Multiplier
+	}
+	if max := float64(p.MaxBackoff); p.MaxBackoff > 0 && delay > max {
+		delay = max
+	}
+	return time.Duration(delay)
+}
+
+// idempotentMethods 是可以安全重试的只读 RPC
+var idempotentMethods = map[string]bool{
+	pb.DevPodWSLService_Status_FullMethodName:  true,
+	pb.DevPodWSLService_Health_FullMethodName:  true,
+	pb.DevPodWSLService_Metrics_FullMethodName: true,
+	pb.FileService_Stat_FullMethodName:         true,
+	pb.FileService_ReadDir_FullMethodName:      true,
+}
+
+// ClientOption 配置 NewClient
+type ClientOption func(*clientOptions)
+
+type clientOptions struct {
+	retry     RetryPolicy
+	keepalive time.Duration
+}
+
+// WithRetryPolicy 替换幂等 RPC 的重试策略
+func WithRetryPolicy(policy RetryPolicy) ClientOption {
+	return func(o *clientOptions) { o.retry = policy }
+}
+
+// WithKeepalive 设置 keepalive ping 的间隔，agent 在一个间隔内没有响应时连接被视为断开
+func WithKeepalive(interval time.Duration) ClientOption {
+	return func(o *clientOptions) { o.keepalive = interval }
+}
+
+// retryUnaryClientInterceptor 重试返回 Unavailable 的幂等 RPC，并把最终的错误分类
+func (p RetryPolicy) retryUnaryClientInterceptor(ctx context.Context, method string, req, reply any, cc *grpcLib.ClientConn, invoker grpcLib.UnaryInvoker, opts ...grpcLib.CallOption) error {
+	attempts := 1
+	if idempotentMethods[method] && p.MaxAttempts > 1 {
+		attempts = p.MaxAttempts
+	}
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = invoker(ctx, method, req, reply, cc, opts...)
+		if err == nil || status.Code(err) != codes.Unavailable || attempt >= attempts {
+			break
+		}
+		select {
+		case <-time.After(p.backoff(attempt)):
+		case <-ctx.Done():
+			return classifyError(err)
+		}
+	}
+	return classifyError(err)
+}
+
+// classifyError 把 agent 无法处理调用的 gRPC 错误包装成 ErrAgent* 错误
+func classifyError(err error) error {
+	switch status.Code(err) {
+	case codes.Unavailable:
+		return fmt.Errorf("%w: %w", ErrAgentUnavailable, err)
+	case codes.Unimplemented:
+		return fmt.Errorf("%w: %w", ErrAgentOutdated, err)
+	}
+	return err
+}
+
+// dialError 区分 agent 没有运行（socket 不存在或拒绝连接）和 agent 没有在超时内就绪
+func dialError(socketPath string, lastDialErr, err error) error {
+	if errors.Is(lastDialErr, os.ErrNotExist) || errors.Is(lastDialErr, syscall.ECONNREFUSED) {
+		return fmt.Errorf("%w: %w", ErrAgentNotRunning, lastDialErr)
+	}
+	if lastDialErr != nil {
+		err = lastDialErr
+	}
+	return fmt.Errorf("%w: connect to %s: %w", ErrAgentUnavailable, socketPath, err)
+}
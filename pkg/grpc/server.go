@@ -3,42 +3,95 @@ package grpc
 import (
 	"context"
 	"io"
+	"log/slog"
 	"os"
-	"os/exec"
 	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 
 	"github.com/creack/pty"
 	pb "github.com/cosysn/devpod-provider-wsl/pkg/grpc/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 // WSLServer implements the DevPodWSLServiceServer interface
 type WSLServer struct {
 	pb.UnimplementedDevPodWSLServiceServer
+	// Version is reported by Status and Health
+	Version string
+	// SocketPath and WorkspaceRoot are checked by Health, empty skips the check
+	SocketPath    string
+	WorkspaceRoot string
+	// Executable is the agent binary replaced by Upgrade, OnUpgrade is called
+	// once a new binary is installed and restarts the agent. Upgrade is
+	// disabled unless both are set.
+	Executable string
+	OnUpgrade  func(path string)
+
+	started time.Time
+
 	mu        sync.Mutex
-	processes map[int]*exec.Cmd
+	processes map[int]*process
+	sessions  map[string]*session
+
+	// shuttingDown 在 Shutdown 开始时关闭，之后不再接受新命令
+	shuttingDown chan struct{}
+	shutdownOnce sync.Once
+	upgrading    atomic.Bool
+
+	// 新会话使用的宽限期和 scrollback 大小
+	killGrace      time.Duration
+	scrollbackSize int
+
+	metrics *agentMetrics
 }
 
 // NewWSLServer creates a new WSLServer instance
 func NewWSLServer() *WSLServer {
-	return &WSLServer{
-		processes: make(map[int]*exec.Cmd),
+	s := &WSLServer{
+		started:   time.Now(),
+		processes: make(map[int]*process),
+		sessions:  make(map[string]*session),
+
+		shuttingDown: make(chan struct{}),
+
+		killGrace:      KillGracePeriod,
+		scrollbackSize: ScrollbackSize,
 	}
+	s.metrics = newAgentMetrics(s)
+	return s
 }
 
 func (s *WSLServer) Start(ctx context.Context, req *pb.StartRequest) (*pb.StartResponse, error) {
-	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", req.Command)
-	cmd.Dir = req.Workdir
+	if s.isShuttingDown() {
+		return nil, errShuttingDown
+	}
 
-	// 设置环境变量
-	for k, v := range req.Env {
-		cmd.Env = append(cmd.Env, k+"="+v)
+	// 进程要比这次调用活得久，不能绑定请求的 context，由 Stop 或 Shutdown 结束
+	cmd, vars, err := shellCommand(context.Background(), commandSpec{
+		Command:     req.Command,
+		User:        req.User,
+		ProviderEnv: req.ProviderEnv,
+		SecretNames: req.SecretNames,
+		EnvFile:     req.EnvFile,
+		Env:         req.Env,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if req.Workdir != "" {
+		cmd.Dir = req.Workdir
 	}
 
-	// 创建 PTY
+	// 创建 PTY，错误会被记录到日志，先隐藏其中的 secret
 	ptyFile, err := pty.Start(cmd)
 	if err != nil {
-		return nil, err
+		return nil, status.Error(codes.Internal, vars.Redact(err.Error()))
 	}
+	slog.Debug("Process started", "pid", cmd.Process.Pid, "command", vars.Redact(req.Command),
+		"user", req.User, "request_id", RequestID(ctx))
 
 	// 异步读取输出到 os.Stdout/os.Stderr
 	go func() {
@@ -46,33 +99,43 @@ func (s *WSLServer) Start(ctx context.Context, req *pb.StartRequest) (*pb.StartR
 		ptyFile.Close()
 	}()
 
+	// 进程退出后从列表中移除，Stop 和 Shutdown 通过 done 等待退出
+	proc := &process{cmd: cmd, done: make(chan struct{}), killGrace: s.killGrace}
+	pid := cmd.Process.Pid
 	s.mu.Lock()
-	s.processes[cmd.Process.Pid] = cmd
+	s.processes[pid] = proc
 	s.mu.Unlock()
+	go func() {
+		cmd.Wait()
+		close(proc.done)
+		s.mu.Lock()
+		delete(s.processes, pid)
+		s.mu.Unlock()
+	}()
 
-	return &pb.StartResponse{Pid: int32(cmd.Process.Pid)}, nil
+	return &pb.StartResponse{Pid: int32(pid)}, nil
 }
 
 func (s *WSLServer) Stop(ctx context.Context, req *pb.StopRequest) (*pb.StopResponse, error) {
 	s.mu.Lock()
-	cmd, ok := s.processes[int(req.Pid)]
+	proc, ok := s.processes[int(req.Pid)]
 	s.mu.Unlock()
 
 	if !ok {
 		return &pb.StopResponse{ExitCode: 0}, nil
 	}
 
-	cmd.Process.Kill()
-	cmd.Wait()
-
-	s.mu.Lock()
-	delete(s.processes, int(req.Pid))
-	s.mu.Unlock()
+	proc.cmd.Process.Kill()
+	<-proc.done
 
 	return &pb.StopResponse{ExitCode: 0}, nil
 }
 
 func (s *WSLServer) Exec(stream pb.DevPodWSLService_ExecServer) error {
+	if s.isShuttingDown() {
+		return errShuttingDown
+	}
+
 	// 解析命令
 	req, err := stream.Recv()
 	if err != nil {
@@ -86,52 +149,134 @@ func (s *WSLServer) Exec(stream pb.DevPodWSLService_ExecServer) error {
 		command = data.Input
 	}
 
-	// 启动 PTY shell
-	cmd := exec.Command("/bin/sh", "-c", command)
-	cmd.Env = os.Environ()
+	// 启动 PTY shell，指定用户时以该用户的登录 shell 运行
+	cmd, vars, err := shellCommand(context.Background(), commandSpec{
+		Command:     command,
+		User:        req.User,
+		ProviderEnv: req.ProviderEnv,
+		SecretNames: req.SecretNames,
+		EnvFile:     req.EnvFile,
+		Env:         req.Env,
+	})
+	if err != nil {
+		return err
+	}
 
-	// 创建 PTY
+	// 创建 PTY，错误会被记录到日志，先隐藏其中的 secret
 	ptyFile, err := pty.Start(cmd)
 	if err != nil {
+		return status.Error(codes.Internal, vars.Redact(err.Error()))
+	}
+
+	// 会话独立于连接运行，客户端断开后可以通过 Attach 重新连接
+	sess := newSession(cmd, ptyFile, s.killGrace, s.scrollbackSize)
+	s.mu.Lock()
+	s.sessions[sess.id] = sess
+	s.mu.Unlock()
+	slog.Debug("Session started", "session", sess.id, "pid", cmd.Process.Pid, "command", vars.Redact(command),
+		"user", req.User, "request_id", RequestID(stream.Context()))
+	started := time.Now()
+	go func() {
+		<-sess.done
+		s.metrics.commandExited(started, sess.exitCode)
+		time.AfterFunc(SessionRetention, func() { s.removeSession(sess.id) })
+	}()
+
+	return s.serveSession(stream, sess)
+}
+
+// Attach 重新连接到一个会话，先回放 scrollback 再转发实时输出
+func (s *WSLServer) Attach(stream pb.DevPodWSLService_AttachServer) error {
+	req, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	sess, ok := s.sessions[req.GetSessionId()]
+	s.mu.Unlock()
+	if !ok {
+		return status.Errorf(codes.NotFound, "session %q not found", req.GetSessionId())
+	}
+	slog.Debug("Session attached", "session", sess.id, "request_id", RequestID(stream.Context()))
+
+	return s.serveSession(stream, sess)
+}
+
+// serveSession 把一个客户端连接到会话，直到命令退出或客户端断开。
+// 客户端断开时会话继续运行；命令退出后把退出码发给客户端并移除会话。
+func (s *WSLServer) serveSession(stream pb.DevPodWSLService_ExecServer, sess *session) error {
+	backlog, output := sess.attach()
+	defer sess.detach(output)
+
+	if err := stream.Send(&pb.ExecResponse{SessionId: sess.id, Stdout: backlog}); err != nil {
 		return err
 	}
-	defer ptyFile.Close()
 
-	// 异步转发 stdin 到 PTY (过滤 Windows 换行符 CR)
+	// 异步转发 stdin 和信号到 PTY
+	shuttingDown := s.shuttingDown
 	go func() {
 		for {
 			req, err := stream.Recv()
 			if err != nil {
-				break
+				return
 			}
 			switch data := req.Data.(type) {
 			case *pb.ExecRequest_Input:
-				ptyFile.Write([]byte(data.Input))
+				sess.write(data.Input)
 			case *pb.ExecRequest_Eof:
-				ptyFile.Close()
+				sess.closeInput()
+			case *pb.ExecRequest_Signal:
+				sess.signal(syscall.Signal(data.Signal.GetNumber()))
 			}
 		}
 	}()
 
-	// 读取 PTY 输出
-	buf := make([]byte, 4096)
 	for {
-		n, err := ptyFile.Read(buf)
-		if n > 0 {
-			stream.Send(&pb.ExecResponse{Stdout: buf[:n]})
-		}
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			break
+		select {
+		case data, ok := <-output:
+			if !ok {
+				if !sess.exited() {
+					return status.Error(codes.ResourceExhausted, "client too slow, attach again to continue")
+				}
+				if err := stream.Send(&pb.ExecResponse{Done: true, ExitCode: int32(sess.exitCode)}); err != nil {
+					return err
+				}
+				s.removeSession(sess.id)
+				return nil
+			}
+			if err := stream.Send(&pb.ExecResponse{Stdout: data}); err != nil {
+				return nil
+			}
+		case <-shuttingDown:
+			// agent 正在关闭，命令随后会收到 SIGTERM，通知客户端一次
+			shuttingDown = nil
+			if err := stream.Send(&pb.ExecResponse{Notice: shutdownNotice}); err != nil {
+				return nil
+			}
+		case <-stream.Context().Done():
+			return nil
 		}
 	}
+}
 
-	cmd.Wait()
-	stream.Send(&pb.ExecResponse{Done: true})
+// activeSessions 返回命令仍在运行的会话数，已退出但还保留着的不算
+func (s *WSLServer) activeSessions() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	active := 0
+	for _, sess := range s.sessions {
+		if !sess.exited() {
+			active++
+		}
+	}
+	return active
+}
 
-	return nil
+func (s *WSLServer) removeSession(id string) {
+	s.mu.Lock()
+	delete(s.sessions, id)
+	s.mu.Unlock()
 }
 
 func (s *WSLServer) Stdin(stream pb.DevPodWSLService_StdinServer) error {
@@ -147,7 +292,13 @@ func (s *WSLServer) Stderr(req *pb.Empty, stream pb.DevPodWSLService_StderrServe
 }
 
 func (s *WSLServer) Status(ctx context.Context, req *pb.Empty) (*pb.AgentStatus, error) {
-	return &pb.AgentStatus{Running: true}, nil
+	// 已退出但仍保留以便 Attach 的会话不计入
+	return &pb.AgentStatus{
+		Running:  true,
+		Pid:      int32(os.Getpid()),
+		Version:  s.Version,
+		Sessions: int32(s.activeSessions()),
+	}, nil
 }
 
 func (s *WSLServer) Upload(stream pb.DevPodWSLService_UploadServer) error {
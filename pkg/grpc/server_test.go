@@ -2,9 +2,21 @@ package grpc
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
 	"testing"
+	"time"
 
 	pb "github.com/cosysn/devpod-provider-wsl/pkg/grpc/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 func TestServer_Start(t *testing.T) {
@@ -70,3 +82,556 @@ func TestServer_Stop(t *testing.T) {
 
 	t.Logf("Stopped process %d with exit code: %d", startResp.Pid, stopResp.ExitCode)
 }
+
+func TestServer_Status(t *testing.T) {
+	server := NewWSLServer()
+	server.Version = "v1.2.3"
+
+	status, err := server.Status(context.Background(), &pb.Empty{})
+	if err != nil {
+		t.Fatalf("Status failed: %v", err)
+	}
+	if !status.Running || status.Version != "v1.2.3" || status.Pid != int32(os.Getpid()) || status.Sessions != 0 {
+		t.Errorf("unexpected status: %v", status)
+	}
+}
+
+func TestServer_StatusSkipsExitedSessions(t *testing.T) {
+	var server *WSLServer
+	client := serveAgent(t, func(s *WSLServer) { server = s })
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := client.Exec(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := stream.Send(&pb.ExecRequest{Data: &pb.ExecRequest_Input{Input: "sleep 0.2"}}); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := stream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Disconnect, the session is retained for Attach after the command exits
+	cancel()
+
+	var sess *session
+	deadline := time.Now().Add(5 * time.Second)
+	for sess == nil || !sess.exited() {
+		if time.Now().After(deadline) {
+			t.Fatal("session did not exit")
+		}
+		time.Sleep(10 * time.Millisecond)
+		server.mu.Lock()
+		sess = server.sessions[resp.SessionId]
+		server.mu.Unlock()
+	}
+
+	status, err := server.Status(context.Background(), &pb.Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Sessions != 0 {
+		t.Errorf("Sessions = %d, want 0", status.Sessions)
+	}
+	health, err := server.Health(context.Background(), &pb.Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if health.Sessions != 0 {
+		t.Errorf("Health Sessions = %d, want 0", health.Sessions)
+	}
+}
+
+// serveAgent serves a WSLServer on a temp socket and connects a client to it
+func serveAgent(t *testing.T, configure ...func(*WSLServer)) *Client {
+	t.Helper()
+	socketPath := filepath.Join(t.TempDir(), "agent.sock")
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wslServer := NewWSLServer()
+	for _, fn := range configure {
+		fn(wslServer)
+	}
+	server := grpc.NewServer(wslServer.ServerOptions()...)
+	pb.RegisterDevPodWSLServiceServer(server, wslServer)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	client, err := NewClient(socketPath, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+// startExec starts command through Exec on a new agent
+func startExec(t *testing.T, command string) pb.DevPodWSLService_ExecClient {
+	t.Helper()
+	return execOn(t, context.Background(), serveAgent(t), command)
+}
+
+func execOn(t *testing.T, ctx context.Context, client *Client, command string) pb.DevPodWSLService_ExecClient {
+	t.Helper()
+	stream, err := client.Exec(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := stream.Send(&pb.ExecRequest{Data: &pb.ExecRequest_Input{Input: command}}); err != nil {
+		t.Fatal(err)
+	}
+	return stream
+}
+
+// waitExec waits for marker in the output, runs fn and returns the exit
+// code and the whole output
+func waitExec(t *testing.T, stream pb.DevPodWSLService_ExecClient, marker string, fn func()) (int32, string) {
+	t.Helper()
+	var output strings.Builder
+	for {
+		resp, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("recv failed: %v (output %q)", err, output.String())
+		}
+		if resp.Done {
+			return resp.ExitCode, output.String()
+		}
+		output.Write(resp.Stdout)
+		if fn != nil && strings.Contains(output.String(), marker) {
+			fn()
+			fn = nil
+		}
+	}
+}
+
+func sendSignal(t *testing.T, stream pb.DevPodWSLService_ExecClient, sig syscall.Signal) {
+	t.Helper()
+	err := stream.Send(&pb.ExecRequest{
+		Data: &pb.ExecRequest_Signal{Signal: &pb.Signal{Number: int32(sig)}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestServer_ExecSignal(t *testing.T) {
+	stream := startExec(t, "echo ready; sleep 30")
+
+	code, _ := waitExec(t, stream, "ready", func() { sendSignal(t, stream, syscall.SIGTERM) })
+	if want := int32(ExitCodeForSignal(syscall.SIGTERM)); code != want {
+		t.Errorf("exit code = %d, want %d", code, want)
+	}
+}
+
+func TestServer_ExecSignalTrapped(t *testing.T) {
+	stream := startExec(t, "trap 'echo bye; exit 3' INT; echo ready; while :; do sleep 0.1; done")
+
+	code, _ := waitExec(t, stream, "ready", func() { sendSignal(t, stream, syscall.SIGINT) })
+	if code != 3 {
+		t.Errorf("exit code = %d, want 3", code)
+	}
+}
+
+func TestServer_ExecSignalEscalates(t *testing.T) {
+	client := serveAgent(t, func(s *WSLServer) { s.killGrace = 200 * time.Millisecond })
+	stream := execOn(t, context.Background(), client, "trap '' TERM; echo ready; sleep 30")
+
+	start := time.Now()
+	code, _ := waitExec(t, stream, "ready", func() { sendSignal(t, stream, syscall.SIGTERM) })
+	if want := int32(ExitCodeForSignal(syscall.SIGKILL)); code != want {
+		t.Errorf("exit code = %d, want %d", code, want)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("command took %s to be killed", elapsed)
+	}
+}
+
+// detachWhen reads from stream until marker shows up, then drops the connection
+// and returns the session ID
+func detachWhen(t *testing.T, client *Client, command, marker string) string {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stream := execOn(t, ctx, client, command)
+	var sessionID string
+	var output strings.Builder
+	for !strings.Contains(output.String(), marker) {
+		resp, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("recv failed: %v (output %q)", err, output.String())
+		}
+		if resp.SessionId != "" {
+			sessionID = resp.SessionId
+		}
+		output.Write(resp.Stdout)
+	}
+	if sessionID == "" {
+		t.Fatal("no session ID received")
+	}
+	return sessionID
+}
+
+func TestServer_AttachAfterDetach(t *testing.T) {
+	client := serveAgent(t)
+	sessionID := detachWhen(t, client, "echo ready; read line; echo got $line", "ready")
+
+	stream, err := client.Attach(context.Background(), sessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := stream.Recv()
+	if err != nil {
+		t.Fatalf("attach failed: %v", err)
+	}
+	if resp.SessionId != sessionID || !strings.Contains(string(resp.Stdout), "ready") {
+		t.Fatalf("first response = %q %q, want session %s with scrollback", resp.SessionId, resp.Stdout, sessionID)
+	}
+
+	if err := stream.Send(&pb.ExecRequest{Data: &pb.ExecRequest_Input{Input: "hello\n"}}); err != nil {
+		t.Fatal(err)
+	}
+	var output strings.Builder
+	for {
+		resp, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("recv failed: %v", err)
+		}
+		output.Write(resp.Stdout)
+		if resp.Done {
+			if resp.ExitCode != 0 {
+				t.Errorf("exit code = %d, want 0", resp.ExitCode)
+			}
+			break
+		}
+	}
+	if !strings.Contains(output.String(), "got hello") {
+		t.Errorf("output = %q, want got hello", output.String())
+	}
+
+	// The session is gone once its exit code was delivered
+	stream, err = client.Attach(context.Background(), sessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.Recv(); status.Code(err) != codes.NotFound {
+		t.Errorf("attach to finished session: %v, want NotFound", err)
+	}
+}
+
+func TestServer_AttachScrollbackIsBounded(t *testing.T) {
+	client := serveAgent(t, func(s *WSLServer) { s.scrollbackSize = 8 })
+	sessionID := detachWhen(t, client, "printf abcdefghijklmnop; read line", "p")
+
+	stream, err := client.Attach(context.Background(), sessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Send(&pb.ExecRequest{Data: &pb.ExecRequest_Input{Input: "\n"}})
+
+	resp, err := stream.Recv()
+	if err != nil {
+		t.Fatalf("attach failed: %v", err)
+	}
+	if string(resp.Stdout) != "ijklmnop" {
+		t.Errorf("scrollback = %q, want %q", resp.Stdout, "ijklmnop")
+	}
+}
+
+func TestServer_ExecEnvLayers(t *testing.T) {
+	t.Setenv("DEVPOD_AGENT_ONLY", "agent")
+	t.Setenv("OVERRIDE", "agent")
+	envFile := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(envFile, []byte("FROM_FILE=file\nOVERRIDE=file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	client := serveAgent(t)
+	stream, err := client.Exec(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = stream.Send(&pb.ExecRequest{
+		Data:        &pb.ExecRequest_Input{Input: `echo "[$FROM_PROVIDER $FROM_FILE $OVERRIDE $DEVPOD_AGENT_ONLY]"`},
+		ProviderEnv: map[string]string{"FROM_PROVIDER": "provider", "FROM_FILE": "provider", "OVERRIDE": "provider"},
+		EnvFile:     envFile,
+		Env:         map[string]string{"OVERRIDE": "request"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, output := waitExec(t, stream, "", nil)
+	if code != 0 {
+		t.Fatalf("exit code = %d", code)
+	}
+	// Commands run as the agent's own user inherit its environment below the layers
+	if want := "[provider file request agent]"; !strings.Contains(output, want) {
+		t.Errorf("output = %q, want %q", output, want)
+	}
+}
+
+func TestServer_Health(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "agent.sock")
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	server := NewWSLServer()
+	server.Version = "v1.2.3"
+	server.SocketPath = socketPath
+	// A workspace root that does not exist yet is checked through its parent
+	server.WorkspaceRoot = filepath.Join(t.TempDir(), "workspaces", "missing")
+
+	health, err := server.Health(context.Background(), &pb.Empty{})
+	if err != nil {
+		t.Fatalf("Health failed: %v", err)
+	}
+	if health.Status != HealthOK || health.Version != "v1.2.3" || health.Pid != int32(os.Getpid()) {
+		t.Errorf("unexpected health: %v", health)
+	}
+	if health.MemoryRssBytes == 0 || health.WorkspaceFreeBytes == 0 {
+		t.Errorf("resource usage missing: %v", health)
+	}
+	checks := map[string]string{}
+	for _, check := range health.Checks {
+		checks[check.Name] = check.Status
+	}
+	for _, name := range []string{"socket", "workspace", "shell", "pty"} {
+		if checks[name] != HealthOK {
+			t.Errorf("check %s = %q, want ok", name, checks[name])
+		}
+	}
+}
+
+func TestServer_HealthReportsWorstCheck(t *testing.T) {
+	server := NewWSLServer()
+	server.WorkspaceRoot = t.TempDir()
+	low := LowDiskBytes
+	LowDiskBytes = math.MaxUint64
+	defer func() { LowDiskBytes = low }()
+
+	health, err := server.Health(context.Background(), &pb.Empty{})
+	if err != nil {
+		t.Fatalf("Health failed: %v", err)
+	}
+	if health.Status != HealthWarn {
+		t.Errorf("status = %q, want warn for low disk space", health.Status)
+	}
+
+	// A deleted socket makes the agent unreachable
+	server.SocketPath = filepath.Join(t.TempDir(), "gone.sock")
+	if health, _ = server.Health(context.Background(), &pb.Empty{}); health.Status != HealthError {
+		t.Errorf("status = %q, want error for a missing socket", health.Status)
+	}
+}
+
+func TestServer_MetricsCountRPCs(t *testing.T) {
+	client := serveAgent(t)
+	ctx := context.Background()
+
+	if _, err := client.Status(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if code, _ := waitExec(t, execOn(t, ctx, client, "echo hello; exit 3\n"), "", nil); code != 3 {
+		t.Fatalf("exit code = %d, want 3", code)
+	}
+
+	// The Exec handler and the session goroutine finish just after Done was sent
+	want := []string{
+		`devpod_agent_rpc_requests_total{method="Status",code="OK"} 1`,
+		`devpod_agent_rpc_requests_total{method="Exec",code="OK"} 1`,
+		`devpod_agent_command_exits_total{code="3"} 1`,
+		`devpod_agent_command_duration_seconds_count 1`,
+		`devpod_agent_sessions_active 0`,
+	}
+	var text string
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+		var err error
+		if text, err = client.Metrics(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if containsAll(text, want) {
+			break
+		}
+	}
+	for _, line := range want {
+		if !strings.Contains(text, line+"\n") {
+			t.Errorf("metrics are missing %q", line)
+		}
+	}
+	if strings.Contains(text, `devpod_agent_rpc_sent_bytes_total{method="Exec"} 0`) ||
+		!strings.Contains(text, `devpod_agent_rpc_sent_bytes_total{method="Exec"}`) {
+		t.Errorf("no bytes counted for Exec:\n%s", text)
+	}
+}
+
+func containsAll(text string, lines []string) bool {
+	for _, line := range lines {
+		if !strings.Contains(text, line+"\n") {
+			return false
+		}
+	}
+	return true
+}
+
+func TestServer_ShutdownNotifiesClients(t *testing.T) {
+	var server *WSLServer
+	client := serveAgent(t, func(s *WSLServer) { server = s })
+	stream := execOn(t, context.Background(), client, "echo ready; sleep 30")
+
+	var notice string
+	for notice == "" {
+		resp, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("recv failed: %v", err)
+		}
+		if strings.Contains(string(resp.Stdout), "ready") {
+			go server.Shutdown(context.Background())
+		}
+		notice = resp.Notice
+	}
+	if notice != shutdownNotice {
+		t.Errorf("notice = %q", notice)
+	}
+}
+
+func TestServer_ShutdownTimeoutKillsCommands(t *testing.T) {
+	var server *WSLServer
+	client := serveAgent(t, func(s *WSLServer) { server = s })
+	stream := execOn(t, context.Background(), client, "trap '' TERM; echo ready; sleep 30")
+
+	shutdown := make(chan error, 1)
+	code, _ := waitExec(t, stream, "ready", func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		go func() {
+			defer cancel()
+			shutdown <- server.Shutdown(ctx)
+		}()
+	})
+	if want := int32(ExitCodeForSignal(syscall.SIGKILL)); code != want {
+		t.Errorf("exit code = %d, want %d", code, want)
+	}
+	if err := <-shutdown; err == nil || !strings.Contains(err.Error(), "1 commands") {
+		t.Errorf("Shutdown = %v, want an error for the trapped command", err)
+	}
+}
+
+// serveUpgradable serves an agent whose executable is a script in a temp dir
+// and returns the channel OnUpgrade reports to
+func serveUpgradable(t *testing.T) (*Client, string, chan string) {
+	t.Helper()
+	executable := filepath.Join(t.TempDir(), "devpod-wsl-agent")
+	if err := os.WriteFile(executable, []byte("#!/bin/sh\necho v1\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	upgraded := make(chan string, 1)
+	client := serveAgent(t, func(s *WSLServer) {
+		s.Version = "v1"
+		s.Executable = executable
+		s.OnUpgrade = func(path string) { upgraded <- path }
+	})
+	return client, executable, upgraded
+}
+
+func upgradeTo(client *Client, agent, version string, force bool) (*pb.UpgradeResponse, error) {
+	sum := sha256.Sum256([]byte(agent))
+	if force {
+		return client.ForceUpgrade(context.Background(), strings.NewReader(agent), hex.EncodeToString(sum[:]), version)
+	}
+	return client.Upgrade(context.Background(), strings.NewReader(agent), hex.EncodeToString(sum[:]), version)
+}
+
+func TestServer_Upgrade(t *testing.T) {
+	client, executable, upgraded := serveUpgradable(t)
+	agent := "#!/bin/sh\necho v2\n"
+
+	resp, err := upgradeTo(client, agent, "v2", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.PreviousVersion != "v1" || resp.Version != "v2" {
+		t.Errorf("response = %v", resp)
+	}
+	if path := <-upgraded; path != executable {
+		t.Errorf("OnUpgrade(%q), want %q", path, executable)
+	}
+	if content, _ := os.ReadFile(executable); string(content) != agent {
+		t.Errorf("executable = %q, want the new agent", content)
+	}
+	if content, _ := os.ReadFile(executable + ".old"); !strings.Contains(string(content), "v1") {
+		t.Errorf("previous agent = %q, want it kept", content)
+	}
+	if _, err := os.Stat(executable + ".new"); !os.IsNotExist(err) {
+		t.Errorf("temporary file left behind: %v", err)
+	}
+}
+
+func TestServer_UpgradeRejected(t *testing.T) {
+	tests := []struct {
+		name    string
+		agent   string
+		sha256  string
+		version string
+		code    codes.Code
+	}{
+		{name: "checksum mismatch", agent: "#!/bin/sh\necho v2\n", sha256: strings.Repeat("0", 64), version: "v2", code: codes.InvalidArgument},
+		{name: "invalid checksum", agent: "#!/bin/sh\necho v2\n", sha256: "abc", version: "v2", code: codes.InvalidArgument},
+		{name: "version mismatch", agent: "#!/bin/sh\necho v3\n", version: "v2", code: codes.InvalidArgument},
+		{name: "does not run", agent: "#!/bin/sh\nexit 1\n", version: "v2", code: codes.FailedPrecondition},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, executable, upgraded := serveUpgradable(t)
+			var err error
+			if tt.sha256 != "" {
+				_, err = client.Upgrade(context.Background(), strings.NewReader(tt.agent), tt.sha256, tt.version)
+			} else {
+				_, err = upgradeTo(client, tt.agent, tt.version, false)
+			}
+			if status.Code(err) != tt.code {
+				t.Errorf("Upgrade = %v, want %v", err, tt.code)
+			}
+			if content, _ := os.ReadFile(executable); !strings.Contains(string(content), "v1") {
+				t.Errorf("executable replaced by a rejected agent: %q", content)
+			}
+			if _, err := os.Stat(executable + ".new"); !os.IsNotExist(err) {
+				t.Errorf("temporary file left behind: %v", err)
+			}
+			select {
+			case <-upgraded:
+				t.Error("OnUpgrade called for a rejected agent")
+			default:
+			}
+		})
+	}
+}
+
+func TestServer_UpgradeWithRunningCommands(t *testing.T) {
+	client, _, upgraded := serveUpgradable(t)
+	stream := execOn(t, context.Background(), client, "echo ready; sleep 30")
+	agent := "#!/bin/sh\necho v2\n"
+
+	waitExec(t, stream, "ready", func() {
+		_, err := upgradeTo(client, agent, "v2", false)
+		if status.Code(err) != codes.FailedPrecondition {
+			t.Errorf("Upgrade without force = %v, want FailedPrecondition", err)
+		}
+		if _, err := upgradeTo(client, agent, "v2", true); err != nil {
+			t.Errorf("Upgrade with force = %v", err)
+		}
+		sendSignal(t, stream, syscall.SIGKILL)
+	})
+	<-upgraded
+}
+
+func TestServer_UpgradeNotEnabled(t *testing.T) {
+	client := serveAgent(t)
+	if _, err := upgradeTo(client, "agent", "v2", false); status.Code(err) != codes.Unimplemented {
+		t.Errorf("Upgrade = %v, want Unimplemented", err)
+	}
+}
@@ -0,0 +1,43 @@
+//go:build !windows
+
+package grpc
+
+import (
+	"context"
+	"syscall"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestServer_ShutdownDrainsCommands(t *testing.T) {
+	var server *WSLServer
+	client := serveAgent(t, func(s *WSLServer) { server = s })
+	ctx := context.Background()
+
+	started, err := client.Start(ctx, "sleep 30", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream := execOn(t, ctx, client, "echo ready; sleep 30")
+
+	shutdown := make(chan error, 1)
+	code, _ := waitExec(t, stream, "ready", func() {
+		go func() { shutdown <- server.Shutdown(ctx) }()
+	})
+	if want := int32(ExitCodeForSignal(syscall.SIGTERM)); code != want {
+		t.Errorf("exit code = %d, want %d", code, want)
+	}
+	if err := <-shutdown; err != nil {
+		t.Errorf("Shutdown = %v, want nil", err)
+	}
+	if err := syscall.Kill(int(started.Pid), 0); err != syscall.ESRCH {
+		t.Errorf("process %d started through Start is still running", started.Pid)
+	}
+
+	// New commands are refused once shutdown started
+	if _, err := client.Start(ctx, "true", "", nil); status.Code(err) != codes.Unavailable {
+		t.Errorf("Start after shutdown = %v, want Unavailable", err)
+	}
+}
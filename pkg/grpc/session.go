@@ -0,0 +1,161 @@
+package grpc
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// ScrollbackSize 是每个会话保留的最近输出字节数，重新 attach 时先回放
+var ScrollbackSize = 256 * 1024
+
+// SessionRetention 是会话结束后等待客户端取回退出码的时间
+var SessionRetention = 10 * time.Minute
+
+// clientBuffer 是每个客户端待发送输出块的上限，超出时断开该客户端
+const clientBuffer = 256
+
+// session 是一个在 PTY 中运行的命令，客户端断开后继续运行
+type session struct {
+	id   string
+	cmd  *exec.Cmd
+	pty  *os.File
+	done chan struct{}
+
+	killGrace      time.Duration
+	scrollbackSize int
+
+	mu         sync.Mutex
+	scrollback []byte
+	clients    map[chan []byte]struct{}
+	exitCode   int
+
+	escalateOnce sync.Once
+}
+
+func newSessionID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func newSession(cmd *exec.Cmd, ptyFile *os.File, killGrace time.Duration, scrollbackSize int) *session {
+	s := &session{
+		id:             newSessionID(),
+		cmd:            cmd,
+		pty:            ptyFile,
+		done:           make(chan struct{}),
+		killGrace:      killGrace,
+		scrollbackSize: scrollbackSize,
+		clients:        make(map[chan []byte]struct{}),
+	}
+	go s.run()
+	return s
+}
+
+// run 读取 PTY 输出写入 scrollback 并分发给客户端，命令退出后关闭 done
+func (s *session) run() {
+	buf := make([]byte, 4096)
+	for {
+		n, err := s.pty.Read(buf)
+		if n > 0 {
+			s.broadcast(buf[:n])
+		}
+		if err != nil {
+			break
+		}
+	}
+
+	s.cmd.Wait()
+	s.pty.Close()
+
+	// 先关闭 done 再关闭客户端 channel，客户端据此区分命令退出和被断开
+	s.mu.Lock()
+	s.exitCode = exitCode(s.cmd)
+	close(s.done)
+	for client := range s.clients {
+		close(client)
+	}
+	s.clients = nil
+	s.mu.Unlock()
+	slog.Debug("Session exited", "session", s.id, "exit_code", s.exitCode)
+}
+
+func (s *session) broadcast(data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.scrollback = append(s.scrollback, data...)
+	if over := len(s.scrollback) - s.scrollbackSize; over > 0 {
+		s.scrollback = append(s.scrollback[:0], s.scrollback[over:]...)
+	}
+
+	for client := range s.clients {
+		chunk := append([]byte(nil), data...)
+		select {
+		case client <- chunk:
+		default:
+			// 客户端太慢，断开它，输出仍保留在 scrollback 中
+			close(client)
+			delete(s.clients, client)
+		}
+	}
+}
+
+// attach 返回当前的 scrollback 和之后输出的 channel，
+// channel 在命令退出或客户端跟不上时关闭
+func (s *session) attach() ([]byte, chan []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	backlog := append([]byte(nil), s.scrollback...)
+	client := make(chan []byte, clientBuffer)
+	if s.clients == nil {
+		close(client)
+	} else {
+		s.clients[client] = struct{}{}
+	}
+	return backlog, client
+}
+
+func (s *session) detach(client chan []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.clients[client]; ok {
+		close(client)
+		delete(s.clients, client)
+	}
+}
+
+func (s *session) exited() bool {
+	select {
+	case <-s.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// signal 把信号发送给会话的进程组，终止信号在宽限期后升级为 SIGKILL
+func (s *session) signal(sig syscall.Signal) {
+	signalGroup(s.cmd.Process, sig)
+	if isTermination(sig) {
+		s.escalateOnce.Do(func() { go escalate(s.cmd.Process, s.killGrace, s.done) })
+	}
+}
+
+func (s *session) write(input string) {
+	io.WriteString(s.pty, input)
+}
+
+// closeInput 发送 EOF (Ctrl-D)，保持 PTY 打开以便继续读取输出
+func (s *session) closeInput() {
+	s.pty.Write([]byte{4})
+}
@@ -0,0 +1,83 @@
+package grpc
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"syscall"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// shutdownNotice 发给关闭时还连着的 Exec 客户端
+const shutdownNotice = "agent is shutting down, the command is being terminated"
+
+// errShuttingDown 是关闭期间新的 Exec 和 Start 调用收到的错误
+var errShuttingDown = status.Error(codes.Unavailable, "agent is shutting down")
+
+// process 是 Start 启动的进程，done 在进程退出后关闭
+type process struct {
+	cmd       *exec.Cmd
+	done      chan struct{}
+	killGrace time.Duration
+}
+
+// terminate 向进程组发送 SIGTERM，宽限期后升级为 SIGKILL
+func (p *process) terminate() {
+	signalGroup(p.cmd.Process, syscall.SIGTERM)
+	go escalate(p.cmd.Process, p.killGrace, p.done)
+}
+
+func (s *WSLServer) isShuttingDown() bool {
+	select {
+	case <-s.shuttingDown:
+		return true
+	default:
+		return false
+	}
+}
+
+// Shutdown 停止接受新命令，通知连接中的 Exec 客户端，并向所有会话和 Start
+// 启动的进程组发送 SIGTERM，宽限期后升级为 SIGKILL。所有命令在 ctx 结束前
+// 退出时返回 nil，否则强制结束剩余的命令并返回错误
+func (s *WSLServer) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.shutdownOnce.Do(func() { close(s.shuttingDown) })
+	var kills []func()
+	var done []<-chan struct{}
+	for _, sess := range s.sessions {
+		if !sess.exited() {
+			sess.signal(syscall.SIGTERM)
+			kills = append(kills, func() { signalGroup(sess.cmd.Process, syscall.SIGKILL) })
+			done = append(done, sess.done)
+		}
+	}
+	for _, proc := range s.processes {
+		proc.terminate()
+		kills = append(kills, func() { signalGroup(proc.cmd.Process, syscall.SIGKILL) })
+		done = append(done, proc.done)
+	}
+	s.mu.Unlock()
+
+	slog.Info("Draining commands", "count", len(done))
+	for i, ch := range done {
+		select {
+		case <-ch:
+		case <-ctx.Done():
+			remaining := 0
+			for j := i; j < len(done); j++ {
+				select {
+				case <-done[j]:
+				default:
+					kills[j]()
+					remaining++
+				}
+			}
+			return fmt.Errorf("%d commands still running after the drain timeout were killed", remaining)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package grpc
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// KillGracePeriod 是转发终止信号后等待命令退出的时间，超时后发送 SIGKILL
+var KillGracePeriod = 10 * time.Second
+
+// ExitCodeForSignal 返回被信号终止的进程的约定退出码 128+signal
+func ExitCodeForSignal(sig syscall.Signal) int {
+	return 128 + int(sig)
+}
+
+// isTermination 判断信号是否需要在宽限期后升级为 SIGKILL
+func isTermination(sig syscall.Signal) bool {
+	return sig == syscall.SIGINT || sig == syscall.SIGTERM || sig == syscall.SIGHUP
+}
+
+// exitCode 返回命令的退出码，被信号终止时为 128+signal
+func exitCode(cmd *exec.Cmd) int {
+	state := cmd.ProcessState
+	if state == nil {
+		return -1
+	}
+	if status, ok := state.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		return ExitCodeForSignal(status.Signal())
+	}
+	return state.ExitCode()
+}
+
+// escalate 在宽限期内命令未退出时杀死整个进程组
+func escalate(process *os.Process, grace time.Duration, done <-chan struct{}) {
+	select {
+	case <-done:
+	case <-time.After(grace):
+		signalGroup(process, syscall.SIGKILL)
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !windows
+
+package grpc
+
+import (
+	"os"
+	"syscall"
+)
+
+// signalGroup 向进程所在的进程组发送信号，pty.Start 会让命令成为会话首进程
+func signalGroup(process *os.Process, sig syscall.Signal) error {
+	return syscall.Kill(-process.Pid, sig)
+}
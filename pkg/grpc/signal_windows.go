@@ -0,0 +1,13 @@
+//go:build windows
+
+package grpc
+
+import (
+	"os"
+	"syscall"
+)
+
+// signalGroup Windows 上没有进程组信号，只能直接结束进程
+func signalGroup(process *os.Process, sig syscall.Signal) error {
+	return process.Kill()
+}
@@ -0,0 +1,146 @@
+package grpc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+
+	pb "github.com/cosysn/devpod-provider-wsl/pkg/grpc/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	// MaxAgentSize 限制上传的 agent 大小
+	MaxAgentSize int64 = 256 << 20
+	// versionTimeout 是运行新 agent -version 的超时
+	versionTimeout = 10 * time.Second
+)
+
+var sha256Regexp = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// Upgrade 接收新的 agent，校验 checksum 和版本后写到旧 agent 旁边再替换它，
+// 旧版本保留为 .old。安装成功后调用 OnUpgrade，由调用方重启 agent。
+// 监听的 socket 会交给新 agent，但会话的 PTY 不会：有命令在运行时拒绝升级，
+// 除非设置了 force，此时重启前的排空会结束这些命令
+func (s *WSLServer) Upgrade(stream pb.DevPodWSLService_UpgradeServer) error {
+	if s.Executable == "" || s.OnUpgrade == nil {
+		return status.Error(codes.Unimplemented, "self-update is not enabled on this agent")
+	}
+	if s.isShuttingDown() {
+		return errShuttingDown
+	}
+
+	first, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	if !sha256Regexp.MatchString(first.Sha256) {
+		return status.Errorf(codes.InvalidArgument, "invalid sha256 %q", first.Sha256)
+	}
+	if running := s.runningCommands(); running > 0 {
+		if !first.Force {
+			return status.Errorf(codes.FailedPrecondition, "%d commands are running, upgrade with force to terminate them", running)
+		}
+		slog.Warn("Forced upgrade terminates running commands", "count", running, "request_id", RequestID(stream.Context()))
+	}
+	if !s.upgrading.CompareAndSwap(false, true) {
+		return status.Error(codes.Aborted, "another upgrade is in progress")
+	}
+
+	version, err := s.installAgent(stream, first)
+	if err != nil {
+		s.upgrading.Store(false)
+		return err
+	}
+
+	resp := &pb.UpgradeResponse{PreviousVersion: s.Version, Version: version}
+	if err := stream.SendAndClose(resp); err != nil {
+		return err
+	}
+	slog.Info("Agent upgraded, restarting", "from", s.Version, "to", version, "request_id", RequestID(stream.Context()))
+	s.OnUpgrade(s.Executable)
+	return nil
+}
+
+// installAgent 把上传的 agent 写到 Executable.new，校验通过后替换 Executable
+func (s *WSLServer) installAgent(stream pb.DevPodWSLService_UpgradeServer, first *pb.UpgradeChunk) (string, error) {
+	newPath := s.Executable + ".new"
+	f, err := os.OpenFile(newPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o755)
+	if err != nil {
+		return "", status.Errorf(codes.Internal, "create %s: %v", newPath, err)
+	}
+	installed := false
+	defer func() {
+		if !installed {
+			os.Remove(newPath)
+		}
+	}()
+
+	hash := sha256.New()
+	w := io.MultiWriter(f, hash)
+	size := int64(0)
+	for chunk := first; ; {
+		size += int64(len(chunk.Content))
+		if size > MaxAgentSize {
+			f.Close()
+			return "", status.Errorf(codes.ResourceExhausted, "agent is larger than %d bytes", MaxAgentSize)
+		}
+		if _, err := w.Write(chunk.Content); err != nil {
+			f.Close()
+			return "", status.Errorf(codes.Internal, "write %s: %v", newPath, err)
+		}
+		if chunk, err = stream.Recv(); err == io.EOF {
+			break
+		} else if err != nil {
+			f.Close()
+			return "", err
+		}
+	}
+	if err := f.Close(); err != nil {
+		return "", status.Errorf(codes.Internal, "write %s: %v", newPath, err)
+	}
+
+	if sum := hex.EncodeToString(hash.Sum(nil)); sum != first.Sha256 {
+		return "", status.Errorf(codes.InvalidArgument, "checksum mismatch: got %s, want %s", sum, first.Sha256)
+	}
+
+	// 新 agent 必须能在这个发行版里运行，版本也要和请求一致
+	ctx, cancel := context.WithTimeout(stream.Context(), versionTimeout)
+	defer cancel()
+	output, err := exec.CommandContext(ctx, newPath, "-version").Output()
+	if err != nil {
+		return "", status.Errorf(codes.FailedPrecondition, "new agent does not run: %v", err)
+	}
+	version := strings.TrimSpace(string(output))
+	if first.Version != "" && version != first.Version {
+		return "", status.Errorf(codes.InvalidArgument, "new agent reports version %q, want %q", version, first.Version)
+	}
+
+	// 保留旧版本以便回滚
+	oldPath := s.Executable + ".old"
+	os.Remove(oldPath)
+	if err := os.Link(s.Executable, oldPath); err != nil {
+		slog.Warn("Cannot keep the previous agent", "path", oldPath, "error", err)
+	}
+	if err := os.Rename(newPath, s.Executable); err != nil {
+		return "", status.Errorf(codes.Internal, "replace %s: %v", s.Executable, err)
+	}
+	installed = true
+	return version, nil
+}
+
+// runningCommands 返回仍在运行的会话和进程数
+func (s *WSLServer) runningCommands() int {
+	s.mu.Lock()
+	processes := len(s.processes)
+	s.mu.Unlock()
+	return s.activeSessions() + processes
+}
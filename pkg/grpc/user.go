@@ -0,0 +1,205 @@
+package grpc
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"os/exec"
+	"os/user"
+	"strconv"
+	"strings"
+
+	"github.com/cosysn/devpod-provider-wsl/pkg/env"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// passwdFile 用于查找用户的登录 shell，os/user 不提供该字段
+var passwdFile = "/etc/passwd"
+
+// defaultPath 是登录 shell 读取 profile 之前使用的 PATH
+const defaultPath = "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+
+// account 是运行命令所需的用户信息
+type account struct {
+	Name   string
+	Uid    uint32
+	Gid    uint32
+	Groups []uint32
+	Home   string
+	Shell  string
+}
+
+func lookupAccount(name string) (*account, error) {
+	u, err := user.Lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	return newAccount(u)
+}
+
+// currentAccount 返回 agent 自身的用户
+func currentAccount() (*account, error) {
+	u, err := user.Current()
+	if err != nil {
+		return nil, err
+	}
+	return newAccount(u)
+}
+
+func newAccount(u *user.User) (*account, error) {
+	uid, err := strconv.ParseUint(u.Uid, 10, 32)
+	if err != nil {
+		return nil, err
+	}
+	gid, err := strconv.ParseUint(u.Gid, 10, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	acct := &account{
+		Name:  u.Username,
+		Uid:   uint32(uid),
+		Gid:   uint32(gid),
+		Home:  u.HomeDir,
+		Shell: loginShell(u.Username),
+	}
+
+	// 附加组查询失败时只保留主组
+	groupIDs, _ := u.GroupIds()
+	for _, id := range groupIDs {
+		if g, err := strconv.ParseUint(id, 10, 32); err == nil {
+			acct.Groups = append(acct.Groups, uint32(g))
+		}
+	}
+	return acct, nil
+}
+
+// loginShell 从 passwd 中读取用户的 shell，找不到时使用 /bin/sh
+func loginShell(name string) string {
+	f, err := os.Open(passwdFile)
+	if err != nil {
+		return "/bin/sh"
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), ":")
+		if len(fields) == 7 && fields[0] == name && fields[6] != "" {
+			return fields[6]
+		}
+	}
+	return "/bin/sh"
+}
+
+// environ 返回与登录该用户时一致的基本环境，终端和语言设置沿用 agent 的
+func (a *account) environ() *env.Env {
+	base := env.New()
+	base.Set("HOME", a.Home, false)
+	base.Set("USER", a.Name, false)
+	base.Set("LOGNAME", a.Name, false)
+	base.Set("SHELL", a.Shell, false)
+	base.Set("PATH", defaultPath, false)
+	for _, key := range []string{"TERM", "LANG", "LC_ALL", "WSL_DISTRO_NAME", "WSL_INTEROP"} {
+		if val, ok := os.LookupEnv(key); ok {
+			base.Set(key, val, false)
+		}
+	}
+	return base
+}
+
+// agentEnviron 返回 agent 自身的环境，以 agent 的用户运行的命令沿用它，
+// 保留 WSL 启动时设置的 PATH 等变量
+func agentEnviron() *env.Env {
+	base := env.New()
+	for _, entry := range os.Environ() {
+		if name, value, ok := strings.Cut(entry, "="); ok && name != "" {
+			base.Set(name, value, false)
+		}
+	}
+	return base
+}
+
+// commandSpec 描述要运行的命令。环境按优先级从低到高依次为：用户的登录环境
+// （以 agent 的用户运行时为 agent 自身的环境）、provider 配置的变量、
+// 工作区 .env 文件、请求中的变量
+type commandSpec struct {
+	Command     string
+	User        string
+	ProviderEnv map[string]string
+	// SecretNames 是 ProviderEnv 中需要在日志和错误中隐藏的变量
+	SecretNames []string
+	EnvFile     string
+	Env         map[string]string
+}
+
+// providerEnv 返回 provider 配置的变量，保留哪些是 secret
+func (spec commandSpec) providerEnv() *env.Env {
+	secret := make(map[string]bool, len(spec.SecretNames))
+	for _, name := range spec.SecretNames {
+		secret[name] = true
+	}
+	vars := env.New()
+	for name, value := range spec.ProviderEnv {
+		vars.Set(name, value, secret[name])
+	}
+	return vars
+}
+
+// readEnvFile 读取工作区的 .env 文件，文件不存在时跳过
+func readEnvFile(path string) (*env.Env, error) {
+	if path == "" {
+		return nil, nil
+	}
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return env.ParseDotenv(string(content))
+}
+
+// shellCommand 构造运行命令的 exec.Cmd。User 为空时以 agent 自身用户通过
+// /bin/sh 运行；否则通过该用户的登录 shell 运行，并切换 uid、gid 和附加组。
+// 同时返回命令的环境，用于在日志和错误中隐藏 secret
+func shellCommand(ctx context.Context, spec commandSpec) (*exec.Cmd, *env.Env, error) {
+	var acct *account
+	var err error
+	if spec.User == "" {
+		acct, err = currentAccount()
+	} else {
+		acct, err = lookupAccount(spec.User)
+	}
+	if err != nil {
+		return nil, nil, status.Errorf(codes.InvalidArgument, "user %q: %v", spec.User, err)
+	}
+
+	fileEnv, err := readEnvFile(spec.EnvFile)
+	if err != nil {
+		return nil, nil, status.Errorf(codes.InvalidArgument, "env file %s: %v", spec.EnvFile, err)
+	}
+	base := acct.environ()
+	if spec.User == "" {
+		base = agentEnviron()
+	}
+	vars := env.Merge(base, spec.providerEnv(), fileEnv, env.FromMap(spec.Env, false))
+
+	if spec.User == "" {
+		cmd := exec.CommandContext(ctx, "/bin/sh", "-c", spec.Command)
+		cmd.Env = vars.Environ()
+		return cmd, vars, nil
+	}
+
+	cmd := exec.CommandContext(ctx, acct.Shell, "-l", "-c", spec.Command)
+	cmd.Env = vars.Environ()
+	if info, err := os.Stat(acct.Home); err == nil && info.IsDir() {
+		cmd.Dir = acct.Home
+	}
+	if err := setCredential(cmd, acct); err != nil {
+		return nil, nil, status.Errorf(codes.PermissionDenied, "run as %q: %v", spec.User, err)
+	}
+	return cmd, vars, nil
+}
@@ -0,0 +1,117 @@
+package grpc
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/cosysn/devpod-provider-wsl/pkg/env"
+	pb "github.com/cosysn/devpod-provider-wsl/pkg/grpc/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestLoginShell(t *testing.T) {
+	passwd := filepath.Join(t.TempDir(), "passwd")
+	content := "root:x:0:0:root:/root:/bin/bash\n" +
+		"dev:x:1000:1000:Dev,,,:/home/dev:/usr/bin/zsh\n" +
+		"noshell:x:1001:1001::/home/noshell:\n"
+	if err := os.WriteFile(passwd, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	orig := passwdFile
+	passwdFile = passwd
+	t.Cleanup(func() { passwdFile = orig })
+
+	tests := map[string]string{
+		"root":    "/bin/bash",
+		"dev":     "/usr/bin/zsh",
+		"noshell": "/bin/sh",
+		"missing": "/bin/sh",
+	}
+	for name, want := range tests {
+		if got := loginShell(name); got != want {
+			t.Errorf("loginShell(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestShellCommand_UnknownUser(t *testing.T) {
+	_, _, err := shellCommand(context.Background(), commandSpec{Command: "true", User: "devpod-no-such-user"})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("shellCommand() error = %v, want InvalidArgument", err)
+	}
+}
+
+func TestShellCommand_SecretNames(t *testing.T) {
+	cmd, vars, err := shellCommand(context.Background(), commandSpec{
+		Command:     "echo $TOKEN",
+		ProviderEnv: map[string]string{"TOKEN": "s3cret", "EDITOR": "vim"},
+		SecretNames: []string{"TOKEN"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The command still gets the value, only the logs hide it
+	if !slices.Contains(cmd.Env, "TOKEN=s3cret") {
+		t.Errorf("cmd.Env = %v, want TOKEN=s3cret", cmd.Env)
+	}
+	if got := vars.Redact("token s3cret editor vim"); got != "token "+env.Redacted+" editor vim" {
+		t.Errorf("Redact() = %q", got)
+	}
+}
+
+func TestServer_ExecAsUser(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("needs root to switch users")
+	}
+	nobody, err := user.Lookup("nobody")
+	if err != nil {
+		t.Skip("no nobody user")
+	}
+
+	// nobody usually has nologin as its shell
+	passwd := filepath.Join(t.TempDir(), "passwd")
+	line := fmt.Sprintf("nobody:x:%s:%s::%s:/bin/sh\n", nobody.Uid, nobody.Gid, nobody.HomeDir)
+	if err := os.WriteFile(passwd, []byte(line), 0644); err != nil {
+		t.Fatal(err)
+	}
+	orig := passwdFile
+	passwdFile = passwd
+	t.Cleanup(func() { passwdFile = orig })
+
+	client := serveAgent(t)
+	stream, err := client.Exec(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = stream.Send(&pb.ExecRequest{
+		Data: &pb.ExecRequest_Input{Input: `echo "id=$(id -u):$(id -g) home=$HOME user=$USER"`},
+		User: "nobody",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var output strings.Builder
+	for {
+		resp, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("recv failed: %v", err)
+		}
+		output.Write(resp.Stdout)
+		if resp.Done {
+			break
+		}
+	}
+
+	want := fmt.Sprintf("id=%s:%s home=%s user=nobody", nobody.Uid, nobody.Gid, nobody.HomeDir)
+	if !strings.Contains(output.String(), want) {
+		t.Errorf("output = %q, want %q", output.String(), want)
+	}
+}
@@ -0,0 +1,28 @@
+//go:build !windows
+
+package grpc
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// setCredential 让命令以 acct 的身份运行，切换到其他用户需要 agent 以 root 运行
+func setCredential(cmd *exec.Cmd, acct *account) error {
+	if int(acct.Uid) == os.Getuid() {
+		return nil
+	}
+	if os.Geteuid() != 0 {
+		return fmt.Errorf("agent runs as uid %d and cannot switch users", os.Geteuid())
+	}
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Credential: &syscall.Credential{
+			Uid:    acct.Uid,
+			Gid:    acct.Gid,
+			Groups: acct.Groups,
+		},
+	}
+	return nil
+}
@@ -0,0 +1,13 @@
+//go:build windows
+
+package grpc
+
+import (
+	"fmt"
+	"os/exec"
+)
+
+// setCredential Windows 上无法切换 Linux 用户
+func setCredential(cmd *exec.Cmd, acct *account) error {
+	return fmt.Errorf("switching users is not supported on windows")
+}
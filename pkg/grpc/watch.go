@@ -0,0 +1,145 @@
+package grpc
+
+import (
+	"path"
+	"strings"
+	"time"
+
+	pb "github.com/cosysn/devpod-provider-wsl/pkg/grpc/proto"
+)
+
+// WatchEvent.Op 的取值
+const (
+	WatchCreate = "create"
+	WatchModify = "modify"
+	WatchDelete = "delete"
+	WatchRename = "rename"
+	// WatchOverflow 表示内核丢弃了事件，客户端需要重新扫描
+	WatchOverflow = "overflow"
+)
+
+// defaultDebounce 是没有指定 debounce_ms 时合并事件的时间
+const defaultDebounce = 100 * time.Millisecond
+
+// watchFilter 按 include 和 exclude 过滤事件
+type watchFilter struct {
+	include []string
+	exclude []string
+}
+
+// newWatchFilter 检查 glob 的语法
+func newWatchFilter(include, exclude []string) (*watchFilter, error) {
+	for _, pattern := range append(append([]string{}, include...), exclude...) {
+		for _, segment := range strings.Split(pattern, "/") {
+			if _, err := path.Match(segment, ""); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return &watchFilter{include: include, exclude: exclude}, nil
+}
+
+// excluded 判断路径是否被排除，被排除的目录不会被监视
+func (f *watchFilter) excluded(rel string) bool {
+	for _, pattern := range f.exclude {
+		if matchGlob(pattern, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// match 判断路径的事件是否需要报告
+func (f *watchFilter) match(rel string) bool {
+	if f.excluded(rel) {
+		return false
+	}
+	if len(f.include) == 0 {
+		return true
+	}
+	for _, pattern := range f.include {
+		if matchGlob(pattern, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchGlob 匹配以斜杠分隔的相对路径。没有斜杠的模式只匹配最后一级，
+// ** 匹配任意多级目录
+func matchGlob(pattern, rel string) bool {
+	if !strings.Contains(pattern, "/") {
+		ok, _ := path.Match(pattern, path.Base(rel))
+		return ok
+	}
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(rel, "/"))
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// eventBatch 合并一个防抖周期内同一路径的事件，按路径第一次出现的顺序输出
+type eventBatch struct {
+	order  []string
+	events map[string]*pb.WatchEvent
+}
+
+func newEventBatch() *eventBatch {
+	return &eventBatch{events: map[string]*pb.WatchEvent{}}
+}
+
+func (b *eventBatch) add(ev *pb.WatchEvent) {
+	prev, seen := b.events[ev.Path]
+	if !seen {
+		b.order = append(b.order, ev.Path)
+	}
+	switch {
+	case prev == nil:
+		b.events[ev.Path] = ev
+	case prev.Op == WatchCreate && ev.Op == WatchDelete:
+		// 周期内创建又删除的文件不报告
+		b.events[ev.Path] = nil
+	case (prev.Op == WatchCreate || prev.Op == WatchRename) && ev.Op == WatchModify:
+		// 新文件的写入包含在 create 或 rename 中
+	case prev.Op == WatchDelete && ev.Op == WatchCreate:
+		// 原子替换，如编辑器先删除再写入
+		b.events[ev.Path] = &pb.WatchEvent{Op: WatchModify, Path: ev.Path, IsDir: ev.IsDir}
+	default:
+		b.events[ev.Path] = ev
+	}
+}
+
+func (b *eventBatch) empty() bool {
+	return len(b.order) == 0
+}
+
+// flush 返回合并后的事件并清空
+func (b *eventBatch) flush() []*pb.WatchEvent {
+	events := make([]*pb.WatchEvent, 0, len(b.order))
+	for _, p := range b.order {
+		if ev := b.events[p]; ev != nil {
+			events = append(events, ev)
+		}
+	}
+	b.order = nil
+	b.events = map[string]*pb.WatchEvent{}
+	return events
+}
@@ -0,0 +1,310 @@
+package grpc
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	pb "github.com/cosysn/devpod-provider-wsl/pkg/grpc/proto"
+	"golang.org/x/sys/unix"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const watchMask = unix.IN_CREATE | unix.IN_MODIFY | unix.IN_ATTRIB | unix.IN_DELETE |
+	unix.IN_MOVED_FROM | unix.IN_MOVED_TO | unix.IN_ONLYDIR | unix.IN_DONT_FOLLOW | unix.IN_EXCL_UNLINK
+
+// Watch 用 inotify 监视目录树。inotify 不递归，每个子目录单独监视，新建或
+// 移入的目录在收到事件时加入
+func (f *FileServer) Watch(req *pb.WatchRequest, stream pb.FileService_WatchServer) error {
+	stopped := f.stopContext()
+	if stopped.Err() != nil {
+		return errShuttingDown
+	}
+	root, err := f.resolve(req.Path, true)
+	if err != nil {
+		return err
+	}
+	filter, err := newWatchFilter(req.Include, req.Exclude)
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "invalid pattern: %v", err)
+	}
+	debounce := defaultDebounce
+	if req.DebounceMs > 0 {
+		debounce = time.Duration(req.DebounceMs) * time.Millisecond
+	}
+
+	w, err := newInotifyWatcher(root, filter)
+	if err != nil {
+		return err
+	}
+	defer w.close()
+	if err := w.addTree("", false); err != nil {
+		return err
+	}
+	// 告诉客户端监视已经就绪，之后的修改都会被报告
+	if err := stream.SendHeader(nil); err != nil {
+		return err
+	}
+	// agent 关闭时结束监视，客户端收到 Unavailable
+	ctx, cancel := context.WithCancel(stream.Context())
+	defer cancel()
+	defer context.AfterFunc(stopped, cancel)()
+	if err := w.run(ctx, debounce, stream.Send); err != nil {
+		return err
+	}
+	if stopped.Err() != nil {
+		return errShuttingDown
+	}
+	return nil
+}
+
+// movedFrom 是等待配对 IN_MOVED_TO 的 IN_MOVED_FROM
+type movedFrom struct {
+	path  string
+	isDir bool
+}
+
+// inotifyWatcher 维护 watch 描述符和相对目录的对应关系
+type inotifyWatcher struct {
+	fd     int
+	root   string
+	filter *watchFilter
+	dirs   map[int]string
+	wds    map[string]int
+	moves  map[uint32]movedFrom
+	batch  *eventBatch
+}
+
+func newInotifyWatcher(root string, filter *watchFilter) (*inotifyWatcher, error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, status.Errorf(codes.ResourceExhausted, "inotify: %v", err)
+	}
+	return &inotifyWatcher{
+		fd:     fd,
+		root:   root,
+		filter: filter,
+		dirs:   map[int]string{},
+		wds:    map[string]int{},
+		moves:  map[uint32]movedFrom{},
+		batch:  newEventBatch(),
+	}, nil
+}
+
+func (w *inotifyWatcher) close() {
+	unix.Close(w.fd)
+}
+
+// addTree 监视 rel 和它下面所有没有被排除的目录。report 为 true 时为已有的
+// 条目报告 create，它们可能在监视建立之前就已经创建
+func (w *inotifyWatcher) addTree(rel string, report bool) error {
+	return filepath.WalkDir(filepath.Join(w.root, rel), func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// 遍历过程中被删除的条目
+			if rel != "" || p != w.root {
+				return nil
+			}
+			return fileError(err)
+		}
+		sub, _ := filepath.Rel(w.root, p)
+		sub = filepath.ToSlash(sub)
+		if sub == "." {
+			sub = ""
+		}
+		if sub != rel && report {
+			w.report(WatchCreate, sub, "", d.IsDir())
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if sub != "" && w.filter.excluded(sub) {
+			return filepath.SkipDir
+		}
+		wd, err := unix.InotifyAddWatch(w.fd, p, watchMask)
+		if err != nil {
+			if sub == "" {
+				return status.Errorf(codes.ResourceExhausted, "watch %s: %v", p, err)
+			}
+			// 通常是超过了 fs.inotify.max_user_watches
+			slog.Warn("Cannot watch directory", "path", p, "error", err)
+			return filepath.SkipDir
+		}
+		w.dirs[wd] = sub
+		w.wds[sub] = wd
+		return nil
+	})
+}
+
+// removeTree 停止监视 rel 和它下面的目录
+func (w *inotifyWatcher) removeTree(rel string) {
+	for dir, wd := range w.wds {
+		if dir == rel || strings.HasPrefix(dir, rel+"/") {
+			unix.InotifyRmWatch(w.fd, uint32(wd))
+			delete(w.wds, dir)
+			delete(w.dirs, wd)
+		}
+	}
+}
+
+// moveTree 更新被重命名的目录和它下面的目录的路径
+func (w *inotifyWatcher) moveTree(from, to string) {
+	for dir, wd := range w.wds {
+		if dir == from || strings.HasPrefix(dir, from+"/") {
+			moved := to + strings.TrimPrefix(dir, from)
+			delete(w.wds, dir)
+			w.wds[moved] = wd
+			w.dirs[wd] = moved
+		}
+	}
+}
+
+func (w *inotifyWatcher) report(op, rel, oldRel string, isDir bool) {
+	if !w.filter.match(rel) && (oldRel == "" || !w.filter.match(oldRel)) {
+		return
+	}
+	w.batch.add(&pb.WatchEvent{Op: op, Path: rel, OldPath: oldRel, IsDir: isDir})
+}
+
+// handle 处理一个 inotify 事件
+func (w *inotifyWatcher) handle(wd int, mask, cookie uint32, name string) {
+	if mask&unix.IN_Q_OVERFLOW != 0 {
+		w.batch.add(&pb.WatchEvent{Op: WatchOverflow})
+		return
+	}
+	if mask&unix.IN_IGNORED != 0 {
+		// 目录被删除或移出，内核已经移除了 watch
+		if dir, ok := w.dirs[wd]; ok {
+			delete(w.dirs, wd)
+			if w.wds[dir] == wd {
+				delete(w.wds, dir)
+			}
+		}
+		return
+	}
+	dir, ok := w.dirs[wd]
+	if !ok || name == "" {
+		return
+	}
+	rel := path.Join(dir, name)
+	isDir := mask&unix.IN_ISDIR != 0
+	if w.filter.excluded(rel) {
+		return
+	}
+
+	switch {
+	case mask&unix.IN_CREATE != 0:
+		w.report(WatchCreate, rel, "", isDir)
+		if isDir {
+			w.addTree(rel, true)
+		}
+	case mask&(unix.IN_MODIFY|unix.IN_ATTRIB) != 0:
+		if !isDir {
+			w.report(WatchModify, rel, "", false)
+		}
+	case mask&unix.IN_DELETE != 0:
+		w.report(WatchDelete, rel, "", isDir)
+	case mask&unix.IN_MOVED_FROM != 0:
+		w.moves[cookie] = movedFrom{path: rel, isDir: isDir}
+	case mask&unix.IN_MOVED_TO != 0:
+		from, paired := w.moves[cookie]
+		if !paired {
+			// 从树外移入
+			w.report(WatchCreate, rel, "", isDir)
+			if isDir {
+				w.addTree(rel, true)
+			}
+			return
+		}
+		delete(w.moves, cookie)
+		if isDir {
+			w.moveTree(from.path, rel)
+		}
+		w.report(WatchRename, rel, from.path, isDir)
+	}
+}
+
+// flushMoves 把没有配对的 IN_MOVED_FROM 当作删除，条目被移出了监视的树
+func (w *inotifyWatcher) flushMoves() {
+	for cookie, from := range w.moves {
+		if from.isDir {
+			w.removeTree(from.path)
+		}
+		w.report(WatchDelete, from.path, "", from.isDir)
+		delete(w.moves, cookie)
+	}
+}
+
+// run 读取事件，每个防抖周期发送一次合并后的事件，直到 ctx 结束
+func (w *inotifyWatcher) run(ctx context.Context, debounce time.Duration, send func(*pb.WatchEvent) error) error {
+	// ctx 结束时写 pipe 唤醒 poll
+	var wake [2]int
+	if err := unix.Pipe2(wake[:], unix.O_CLOEXEC|unix.O_NONBLOCK); err != nil {
+		return status.Errorf(codes.Internal, "pipe: %v", err)
+	}
+	defer unix.Close(wake[0])
+	defer unix.Close(wake[1])
+	stop := context.AfterFunc(ctx, func() { unix.Write(wake[1], []byte{0}) })
+	defer stop()
+
+	buf := make([]byte, 64<<10)
+	var deadline time.Time
+	for {
+		timeout := -1
+		if !deadline.IsZero() {
+			timeout = max(0, int(time.Until(deadline).Milliseconds()))
+		}
+		fds := []unix.PollFd{{Fd: int32(w.fd), Events: unix.POLLIN}, {Fd: int32(wake[0]), Events: unix.POLLIN}}
+		if _, err := unix.Poll(fds, timeout); err != nil && !errors.Is(err, unix.EINTR) {
+			return status.Errorf(codes.Internal, "poll: %v", err)
+		}
+		if fds[1].Revents != 0 {
+			return nil
+		}
+		if fds[0].Revents&unix.POLLIN != 0 {
+			if err := w.read(buf); err != nil {
+				return err
+			}
+			if deadline.IsZero() && (!w.batch.empty() || len(w.moves) > 0) {
+				deadline = time.Now().Add(debounce)
+			}
+		}
+		if !deadline.IsZero() && !time.Now().Before(deadline) {
+			deadline = time.Time{}
+			w.flushMoves()
+			for _, ev := range w.batch.flush() {
+				if err := send(ev); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+// read 读出当前所有可读的事件
+func (w *inotifyWatcher) read(buf []byte) error {
+	n, err := unix.Read(w.fd, buf)
+	if errors.Is(err, unix.EAGAIN) || errors.Is(err, unix.EINTR) {
+		return nil
+	}
+	if err != nil {
+		return status.Errorf(codes.Internal, "read inotify events: %v", err)
+	}
+	for offset := 0; offset+unix.SizeofInotifyEvent <= n; {
+		wd := int(int32(binary.NativeEndian.Uint32(buf[offset:])))
+		mask := binary.NativeEndian.Uint32(buf[offset+4:])
+		cookie := binary.NativeEndian.Uint32(buf[offset+8:])
+		length := int(binary.NativeEndian.Uint32(buf[offset+12:]))
+		offset += unix.SizeofInotifyEvent
+		name := strings.TrimRight(string(buf[offset:offset+length]), "\x00")
+		offset += length
+		w.handle(wd, mask, cookie, name)
+	}
+	return nil
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+
+package grpc
+
+import (
+	pb "github.com/cosysn/devpod-provider-wsl/pkg/grpc/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Watch 依赖 inotify，只在 Linux 上可用
+func (f *FileServer) Watch(req *pb.WatchRequest, stream pb.FileService_WatchServer) error {
+	return status.Error(codes.Unimplemented, "watch requires inotify")
+}
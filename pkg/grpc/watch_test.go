@@ -0,0 +1,185 @@
+//go:build linux
+
+package grpc
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	pb "github.com/cosysn/devpod-provider-wsl/pkg/grpc/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"*.go", "main.go", true},
+		{"*.go", "pkg/grpc/server.go", true},
+		{"*.go", "main.go.orig", false},
+		{"node_modules", "web/node_modules", true},
+		{"src/*.go", "src/main.go", true},
+		{"src/*.go", "src/pkg/main.go", false},
+		{"src/**/*.go", "src/main.go", true},
+		{"src/**/*.go", "src/pkg/grpc/main.go", true},
+		{"build/**", "build", true},
+		{"build/**", "build/out/app", true},
+		{"build/**", "web/build", false},
+	}
+	for _, tt := range tests {
+		if got := matchGlob(tt.pattern, tt.path); got != tt.want {
+			t.Errorf("matchGlob(%q, %q) = %v, want %v", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestEventBatch(t *testing.T) {
+	b := newEventBatch()
+	b.add(&pb.WatchEvent{Op: WatchCreate, Path: "new.txt"})
+	b.add(&pb.WatchEvent{Op: WatchModify, Path: "new.txt"})
+	b.add(&pb.WatchEvent{Op: WatchCreate, Path: "tmp.txt"})
+	b.add(&pb.WatchEvent{Op: WatchDelete, Path: "tmp.txt"})
+	b.add(&pb.WatchEvent{Op: WatchDelete, Path: "saved.txt"})
+	b.add(&pb.WatchEvent{Op: WatchCreate, Path: "saved.txt"})
+
+	var got []string
+	for _, ev := range b.flush() {
+		got = append(got, ev.Op+" "+ev.Path)
+	}
+	if want := "create new.txt,modify saved.txt"; strings.Join(got, ",") != want {
+		t.Errorf("flush() = %v, want %s", got, want)
+	}
+	if !b.empty() {
+		t.Error("batch not empty after flush")
+	}
+}
+
+// nextEvents receives events until want events arrived or the timeout passed
+func nextEvents(t *testing.T, stream pb.FileService_WatchClient, want int) []string {
+	t.Helper()
+	var got []string
+	for len(got) < want {
+		ev, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("Recv failed after %v: %v", got, err)
+		}
+		line := ev.Op + " " + ev.Path
+		if ev.OldPath != "" {
+			line += " from " + ev.OldPath
+		}
+		got = append(got, line)
+	}
+	return got
+}
+
+func TestFiles_Watch(t *testing.T) {
+	client, root := serveFiles(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := os.MkdirAll(filepath.Join(root, "ws", "node_modules"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	stream, err := client.Watch(ctx, &pb.WatchRequest{
+		Path:       "ws",
+		Exclude:    []string{"node_modules", "*.swp"},
+		DebounceMs: 100,
+	})
+	if err != nil {
+		t.Fatalf("Watch failed: %v", err)
+	}
+	write := func(name, content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(root, "ws", name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Excluded paths are not reported, several writes are merged into one create
+	write("node_modules/dep.js", "x")
+	write("main.go.swp", "x")
+	write("main.go", "package main")
+	write("main.go", "package main\n")
+	if got := nextEvents(t, stream, 1); got[0] != "create main.go" {
+		t.Errorf("events = %v, want create main.go", got)
+	}
+
+	// Files in a new directory are reported even if they were written before
+	// the directory was watched
+	if err := os.MkdirAll(filepath.Join(root, "ws", "pkg", "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	write("pkg/sub/lib.go", "package sub")
+	got := nextEvents(t, stream, 3)
+	if strings.Join(got, ",") != "create pkg,create pkg/sub,create pkg/sub/lib.go" {
+		t.Errorf("events = %v", got)
+	}
+
+	if err := os.Rename(filepath.Join(root, "ws", "pkg"), filepath.Join(root, "ws", "lib")); err != nil {
+		t.Fatal(err)
+	}
+	if got := nextEvents(t, stream, 1); got[0] != "rename lib from pkg" {
+		t.Errorf("events = %v, want the rename", got)
+	}
+	// The watches below the renamed directory report the new path
+	write("lib/sub/lib.go", "package sub\n")
+	if got := nextEvents(t, stream, 1); got[0] != "modify lib/sub/lib.go" {
+		t.Errorf("events = %v, want modify lib/sub/lib.go", got)
+	}
+
+	if err := os.Remove(filepath.Join(root, "ws", "main.go")); err != nil {
+		t.Fatal(err)
+	}
+	if got := nextEvents(t, stream, 1); got[0] != "delete main.go" {
+		t.Errorf("events = %v, want delete main.go", got)
+	}
+}
+
+func TestFiles_WatchIncludeAndErrors(t *testing.T) {
+	client, root := serveFiles(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, err := client.Watch(ctx, &pb.WatchRequest{Path: "missing"}); status.Code(err) != codes.NotFound {
+		t.Errorf("Watch(missing) = %v, want NotFound", err)
+	}
+	if _, err := client.Watch(ctx, &pb.WatchRequest{Path: ".", Include: []string{"["}}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Watch with a bad pattern = %v, want InvalidArgument", err)
+	}
+
+	stream, err := client.Watch(ctx, &pb.WatchRequest{Path: ".", Include: []string{"*.go"}, DebounceMs: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(root, "README.md"), []byte("x"), 0o644)
+	os.WriteFile(filepath.Join(root, "main.go"), []byte("x"), 0o644)
+	if got := nextEvents(t, stream, 1); got[0] != "create main.go" {
+		t.Errorf("events = %v, want only create main.go", got)
+	}
+}
+
+func TestFiles_WatchShutdown(t *testing.T) {
+	files := NewFileServer(t.TempDir())
+	client := serveFileServer(t, files)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	stream, err := client.Watch(ctx, &pb.WatchRequest{Path: "."})
+	if err != nil {
+		t.Fatalf("Watch failed: %v", err)
+	}
+	files.Shutdown()
+	if _, err := stream.Recv(); status.Code(err) != codes.Unavailable {
+		t.Errorf("Recv after Shutdown = %v, want Unavailable", err)
+	}
+	if _, err := client.Watch(ctx, &pb.WatchRequest{Path: "."}); status.Code(err) != codes.Unavailable {
+		t.Errorf("Watch after Shutdown = %v, want Unavailable", err)
+	}
+}
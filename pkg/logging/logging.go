@@ -0,0 +1,104 @@
+package logging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// DefaultAgentLogFile is where the agent logs inside the distro
+const DefaultAgentLogFile = "/var/tmp/devpod/logs/agent.log"
+
+// Rotation limits of the log files
+const (
+	MaxSizeMB  = 10
+	MaxBackups = 5
+	MaxAgeDays = 14
+)
+
+// ParseLevel parses a LOG_LEVEL value: debug, info, warn or error
+func ParseLevel(level string) (slog.Level, error) {
+	switch strings.ToLower(strings.TrimSpace(level)) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return slog.LevelInfo, fmt.Errorf("unknown log level %q", level)
+}
+
+// NewFile returns a log file that is rotated once it grows past MaxSizeMB
+func NewFile(path string) (io.WriteCloser, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	return &lumberjack.Logger{
+		Filename:   path,
+		MaxSize:    MaxSizeMB,
+		MaxBackups: MaxBackups,
+		MaxAge:     MaxAgeDays,
+	}, nil
+}
+
+// New returns a logger writing human readable text to console and JSON
+// lines to file. Either writer may be nil.
+func New(console, file io.Writer, level slog.Level) *slog.Logger {
+	var handlers []slog.Handler
+	opts := &slog.HandlerOptions{Level: level}
+	if console != nil {
+		handlers = append(handlers, slog.NewTextHandler(console, opts))
+	}
+	if file != nil {
+		handlers = append(handlers, slog.NewJSONHandler(file, opts))
+	}
+	return slog.New(fanout(handlers))
+}
+
+// fanout sends every record to all handlers
+type fanout []slog.Handler
+
+func (f fanout) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, h := range f {
+		if h.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f fanout) Handle(ctx context.Context, record slog.Record) error {
+	var errs []error
+	for _, h := range f {
+		if h.Enabled(ctx, record.Level) {
+			errs = append(errs, h.Handle(ctx, record.Clone()))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (f fanout) WithAttrs(attrs []slog.Attr) slog.Handler {
+	handlers := make(fanout, len(f))
+	for i, h := range f {
+		handlers[i] = h.WithAttrs(attrs)
+	}
+	return handlers
+}
+
+func (f fanout) WithGroup(name string) slog.Handler {
+	handlers := make(fanout, len(f))
+	for i, h := range f {
+		handlers[i] = h.WithGroup(name)
+	}
+	return handlers
+}
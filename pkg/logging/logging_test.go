@@ -0,0 +1,69 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseLevel(t *testing.T) {
+	tests := map[string]slog.Level{
+		"debug": slog.LevelDebug,
+		"INFO":  slog.LevelInfo,
+		"":      slog.LevelInfo,
+		"warn":  slog.LevelWarn,
+		"error": slog.LevelError,
+	}
+	for in, want := range tests {
+		got, err := ParseLevel(in)
+		if err != nil || got != want {
+			t.Errorf("ParseLevel(%q) = %v, %v, want %v", in, got, err, want)
+		}
+	}
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Error("ParseLevel(verbose) should fail")
+	}
+}
+
+func TestNew(t *testing.T) {
+	var console, file bytes.Buffer
+	logger := New(&console, &file, slog.LevelInfo).With("component", "test")
+
+	logger.Debug("hidden")
+	logger.Info("Agent started", "socket", "/tmp/agent.sock")
+
+	if strings.Contains(console.String(), "hidden") || strings.Contains(file.String(), "hidden") {
+		t.Error("debug message should be filtered at info level")
+	}
+	if !strings.Contains(console.String(), `msg="Agent started" component=test socket=/tmp/agent.sock`) {
+		t.Errorf("console = %q", console.String())
+	}
+
+	var record map[string]any
+	if err := json.Unmarshal(file.Bytes(), &record); err != nil {
+		t.Fatalf("file should hold JSON lines: %v (%q)", err, file.String())
+	}
+	if record["msg"] != "Agent started" || record["level"] != "INFO" || record["component"] != "test" {
+		t.Errorf("file record = %v", record)
+	}
+}
+
+func TestNewFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "agent.log")
+	file, err := NewFile(path)
+	if err != nil {
+		t.Fatalf("NewFile failed: %v", err)
+	}
+	if _, err := file.Write([]byte("line\n")); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	if content, err := os.ReadFile(path); err != nil || string(content) != "line\n" {
+		t.Errorf("log file = %q, %v", content, err)
+	}
+}
@@ -0,0 +1,75 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRegistry_WriteText(t *testing.T) {
+	r := NewRegistry()
+	requests := r.Counter("requests_total", "Requests.", "method", "code")
+	r.GaugeFunc("sessions", "Sessions.", func() float64 { return 2 })
+	duration := r.Histogram("duration_seconds", "Duration.", []float64{1, 10})
+
+	requests.Inc("Exec", "OK")
+	requests.Add(2, "Status", "OK")
+	requests.Inc("Exec", `quote"d`)
+	duration.Observe(0.5)
+	duration.Observe(5)
+	duration.Observe(50)
+
+	text := &strings.Builder{}
+	if err := r.WriteText(text); err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP requests_total Requests.
+# TYPE requests_total counter
+requests_total{method="Exec",code="OK"} 1
+requests_total{method="Exec",code="quote\"d"} 1
+requests_total{method="Status",code="OK"} 2
+# HELP sessions Sessions.
+# TYPE sessions gauge
+sessions 2
+# HELP duration_seconds Duration.
+# TYPE duration_seconds histogram
+duration_seconds_bucket{le="1"} 1
+duration_seconds_bucket{le="10"} 2
+duration_seconds_bucket{le="+Inf"} 3
+duration_seconds_sum 55.5
+duration_seconds_count 3
+`
+	if text.String() != want {
+		t.Errorf("WriteText =\n%s\nwant\n%s", text, want)
+	}
+	if got := requests.Value("Status", "OK"); got != 2 {
+		t.Errorf("Value = %v, want 2", got)
+	}
+	if got := duration.Count(); got != 3 {
+		t.Errorf("Count = %d, want 3", got)
+	}
+}
+
+func TestRegistry_ServeHTTP(t *testing.T) {
+	r := NewRegistry()
+	r.Counter("scrapes_total", "Scrapes.").Inc()
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); ct != ContentType {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if !strings.Contains(rec.Body.String(), "scrapes_total 1\n") {
+		t.Errorf("body = %q", rec.Body.String())
+	}
+}
+
+func TestCounter_WrongLabelCountPanics(t *testing.T) {
+	c := NewRegistry().Counter("c", "C.", "method")
+	defer func() {
+		if recover() == nil {
+			t.Error("Inc without label values did not panic")
+		}
+	}()
+	c.Inc()
+}
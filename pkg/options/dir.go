@@ -0,0 +1,37 @@
+package options
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/loft-sh/devpod/pkg/provider"
+)
+
+const providerName = "wsl"
+
+// DataDir returns the directory the provider keeps its caches and logs in.
+// It lives inside the DevPod provider directory when DevPod tells us the
+// context, otherwise it falls back to the user cache directory.
+func DataDir() (string, error) {
+	name := os.Getenv(provider.WORKSPACE_PROVIDER)
+	if name == "" {
+		name = os.Getenv(provider.MACHINE_PROVIDER)
+	}
+	context := os.Getenv(provider.WORKSPACE_CONTEXT)
+	if context == "" {
+		context = os.Getenv(provider.MACHINE_CONTEXT)
+	}
+
+	if name != "" && context != "" {
+		dir, err := provider.GetProviderDir(context, name)
+		if err == nil {
+			return filepath.Join(dir, "data"), nil
+		}
+	}
+
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(cacheDir, "devpod-provider-"+providerName), nil
+}
@@ -2,38 +2,423 @@ package options
 
 import (
 	"fmt"
+	"net/url"
 	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cosysn/devpod-provider-wsl/pkg/env"
+	"github.com/cosysn/devpod-provider-wsl/pkg/tunnel"
 )
 
 var (
-	WSL_DISTRO = "WSL_DISTRO"
+	WSL_DISTRO     = "WSL_DISTRO"
+	WSL_USER       = "WSL_USER"
+	IDLE_TIMEOUT   = "IDLE_TIMEOUT"
+	AGENT_PATH     = "AGENT_PATH"
+	AGENT_URL      = "AGENT_URL"
+	AGENT_CHECKSUM = "AGENT_CHECKSUM"
+	AGENT_SYSTEMD  = "AGENT_SYSTEMD"
+	SOCKET_PATH    = "SOCKET_PATH"
+	WORKSPACE_ROOT = "WORKSPACE_ROOT"
+	WORKSPACE_ENV  = "WORKSPACE_ENV"
+	// WORKSPACE_SECRETS holds NAME=VALUE pairs that are redacted from logs
+	WORKSPACE_SECRETS = "WORKSPACE_SECRETS"
+	REQUIRED_TOOLS    = "REQUIRED_TOOLS"
+	MIN_DISK_SPACE    = "MIN_DISK_SPACE"
+	LOG_LEVEL         = "LOG_LEVEL"
+
+	GIT_REPOSITORY        = "GIT_REPOSITORY"
+	GIT_BRANCH            = "GIT_BRANCH"
+	GIT_COMMIT            = "GIT_COMMIT"
+	GIT_SHALLOW           = "GIT_SHALLOW"
+	GIT_CREDENTIAL_HELPER = "GIT_CREDENTIAL_HELPER"
+
+	DOTFILES_REPOSITORY = "DOTFILES_REPOSITORY"
+	DOTFILES_SCRIPT     = "DOTFILES_SCRIPT"
+
+	MIN_KERNEL_VERSION = "MIN_KERNEL_VERSION"
+	REQUIRE_SYSTEMD    = "REQUIRE_SYSTEMD"
+	WSL_VERSION        = "WSL_VERSION"
+	MIN_MEMORY         = "MIN_MEMORY"
+
+	MACHINE_ID     = "MACHINE_ID"
+	MACHINE_FOLDER = "MACHINE_FOLDER"
+)
+
+// Defaults, kept in sync with provider.yaml
+const (
+	DefaultIdleTimeout   = 30 * time.Minute
+	DefaultWorkspaceRoot = "/var/tmp/devpod/workspaces"
+	DefaultRequiredTools = "git,curl"
+	DefaultMinDiskSpace  = 5
+	DefaultLogLevel      = "info"
+
+	DefaultMinKernelVersion = "5.10"
+	DefaultWSLVersion       = 2
+	DefaultMinMemory        = 2
+)
+
+// LogLevels lists the accepted LOG_LEVEL values
+var LogLevels = []string{"debug", "info", "warn", "error"}
+
+var (
+	checksumRegexp = regexp.MustCompile(`^[0-9a-fA-F]{64}$`)
+	versionRegexp  = regexp.MustCompile(`^[0-9]+(\.[0-9]+)*$`)
+	userRegexp     = regexp.MustCompile(`^[a-z_][a-z0-9_.-]*\$?$`)
+	branchRegexp   = regexp.MustCompile(`^[A-Za-z0-9_.+/][A-Za-z0-9_.+/-]*$`)
+	commitRegexp   = regexp.MustCompile(`^[0-9a-fA-F]{7,64}$`)
+	toolRegexp     = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.+-]*$`)
 )
 
 type Options struct {
 	WSLDistro string
+	// WSLUser is the Linux account commands run as, empty uses the distro's default user
+	WSLUser string
+
+	// IdleTimeout is how long WSL may stay idle before it is stopped, 0 disables it
+	IdleTimeout time.Duration
+
+	// AgentPath is a local agent binary that overrides the embedded one
+	AgentPath string
+	// AgentURL is where the agent is downloaded from when nothing is embedded
+	AgentURL string
+	// AgentChecksum is the pinned sha256 of the binary behind AgentURL
+	AgentChecksum string
+	// AgentSystemd runs the agent as a socket-activated systemd user service
+	// when systemd is enabled in the distro. It is ignored on a Windows host,
+	// where commands don't go through the agent.
+	AgentSystemd bool
+	// SocketPath is the agent's unix socket inside the distro
+	SocketPath string
+
+	// WorkspaceRoot is the directory inside the distro holding all workspaces
+	WorkspaceRoot string
+	// WorkspaceEnv is set for every command, it includes WORKSPACE_SECRETS
+	// marked as secret
+	WorkspaceEnv *env.Env
+	// RequiredTools must be installed in the distro
+	RequiredTools []string
+	// MinDiskSpaceGB is the free space required on the workspace root
+	MinDiskSpaceGB int
+
+	// LogLevel is one of LogLevels
+	LogLevel string
+
+	// GitRepository is cloned into the workspace directory on create, empty
+	// creates no repository
+	GitRepository string
+	// GitBranch is checked out instead of the remote's default branch
+	GitBranch string
+	// GitCommit is checked out after cloning, detaching HEAD
+	GitCommit string
+	// GitShallow clones only the history needed for the checkout
+	GitShallow bool
+	// GitCredentialHelper is stored as credential.helper in the clone
+	GitCredentialHelper string
+
+	// DotfilesRepository is cloned into the user's home and installed once
+	// after create, empty installs no dotfiles
+	DotfilesRepository string
+	// DotfilesScript is the install script inside the repository, empty
+	// looks for a well-known script name
+	DotfilesScript string
+
+	// MinKernelVersion is the oldest accepted kernel release, empty skips the check
+	MinKernelVersion string
+	// RequireSystemd fails preflight when systemd is not enabled in the distro
+	RequireSystemd bool
+	// WSLVersion is the required WSL version
+	WSLVersion int
+	// MinMemoryGB is the memory that should be available in the distro, 0 skips the check
+	MinMemoryGB int
+
+	MachineID     string
+	MachineFolder string
+}
+
+// InvalidOption describes a single option that failed to parse or validate
+type InvalidOption struct {
+	Name   string
+	Value  string
+	Reason string
 }
 
+// ValidationError lists every invalid option at once
+type ValidationError struct {
+	Invalid []InvalidOption
+}
+
+func (e *ValidationError) Error() string {
+	lines := make([]string, 0, len(e.Invalid)+1)
+	lines = append(lines, "invalid provider options:")
+	for _, opt := range e.Invalid {
+		if opt.Value == "" {
+			lines = append(lines, fmt.Sprintf("  - %s: %s", opt.Name, opt.Reason))
+		} else {
+			lines = append(lines, fmt.Sprintf("  - %s=%q: %s", opt.Name, opt.Value, opt.Reason))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// WorkspaceDir is the machine's directory below WorkspaceRoot, it is empty
+// when no machine is known
+func (o *Options) WorkspaceDir() string {
+	if o.MachineID == "" {
+		return ""
+	}
+	return path.Join(o.WorkspaceRoot, o.MachineID)
+}
+
+// EnvFile is the per-workspace .env file inside the distro
+func (o *Options) EnvFile() string {
+	if dir := o.WorkspaceDir(); dir != "" {
+		return path.Join(dir, ".env")
+	}
+	return ""
+}
+
+// RedactURL hides the password of a URL with credentials, such as a token
+// in GIT_REPOSITORY. Other values are returned unchanged.
+func RedactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.User == nil {
+		return raw
+	}
+	if _, ok := u.User.Password(); !ok {
+		return raw
+	}
+	return u.Redacted()
+}
+
+// FromEnv reads the provider options from the environment. Machine scoped
+// options are skipped during init, and withFolder additionally requires
+// MACHINE_FOLDER to be set.
 func FromEnv(init, withFolder bool) (*Options, error) {
-	retOptions := &Options{}
+	p := &parser{}
+	retOptions := &Options{
+		WSLDistro:      p.required(WSL_DISTRO),
+		WSLUser:        p.user(WSL_USER),
+		IdleTimeout:    time.Duration(p.int(IDLE_TIMEOUT, int(DefaultIdleTimeout/time.Minute), 0, 24*60)) * time.Minute,
+		AgentPath:      p.string(AGENT_PATH, ""),
+		AgentURL:       p.string(AGENT_URL, ""),
+		AgentChecksum:  p.checksum(AGENT_CHECKSUM),
+		AgentSystemd:   p.bool(AGENT_SYSTEMD, false),
+		SocketPath:     p.absPath(SOCKET_PATH, tunnel.DefaultSocketPath),
+		WorkspaceRoot:  p.absPath(WORKSPACE_ROOT, DefaultWorkspaceRoot),
+		WorkspaceEnv:   env.Merge(p.env(WORKSPACE_ENV, false), p.env(WORKSPACE_SECRETS, true)),
+		RequiredTools:  p.tools(REQUIRED_TOOLS, DefaultRequiredTools),
+		MinDiskSpaceGB: p.int(MIN_DISK_SPACE, DefaultMinDiskSpace, 0, 10000),
+		LogLevel:       p.enum(LOG_LEVEL, DefaultLogLevel, LogLevels...),
 
-	var err error
-	retOptions.WSLDistro, err = fromEnvOrError(WSL_DISTRO)
-	if err != nil {
-		return nil, fmt.Errorf("WSL_DISTRO environment variable is required")
+		GitRepository:       p.gitArg(GIT_REPOSITORY),
+		GitBranch:           p.match(GIT_BRANCH, branchRegexp, "must be a branch or tag name"),
+		GitCommit:           strings.ToLower(p.match(GIT_COMMIT, commitRegexp, "must be a commit hash")),
+		GitShallow:          p.bool(GIT_SHALLOW, false),
+		GitCredentialHelper: p.string(GIT_CREDENTIAL_HELPER, ""),
+
+		DotfilesRepository: p.gitArg(DOTFILES_REPOSITORY),
+		DotfilesScript:     p.relPath(DOTFILES_SCRIPT),
+
+		MinKernelVersion: p.version(MIN_KERNEL_VERSION, DefaultMinKernelVersion),
+		RequireSystemd:   p.bool(REQUIRE_SYSTEMD, false),
+		WSLVersion:       p.int(WSL_VERSION, DefaultWSLVersion, 1, 2),
+		MinMemoryGB:      p.int(MIN_MEMORY, DefaultMinMemory, 0, 1024),
 	}
 
+	if !init {
+		retOptions.MachineID = p.string(MACHINE_ID, "")
+		if withFolder {
+			retOptions.MachineFolder = p.required(MACHINE_FOLDER)
+		}
+	}
+
+	if len(p.invalid) > 0 {
+		return nil, &ValidationError{Invalid: p.invalid}
+	}
 	return retOptions, nil
 }
 
-func fromEnvOrError(name string) (string, error) {
-	val := os.Getenv(name)
+// parser collects every invalid option instead of stopping at the first one
+type parser struct {
+	invalid []InvalidOption
+}
+
+func (p *parser) fail(name, value, reason string) {
+	p.invalid = append(p.invalid, InvalidOption{Name: name, Value: value, Reason: reason})
+}
+
+func (p *parser) string(name, def string) string {
+	val := strings.TrimSpace(os.Getenv(name))
+	if val == "" {
+		return def
+	}
+	return val
+}
+
+func (p *parser) required(name string) string {
+	val := p.string(name, "")
 	if val == "" {
-		return "", fmt.Errorf(
-			"couldn't find option %s in environment, please make sure %s is defined",
-			name,
-			name,
-		)
+		p.fail(name, "", "is required, please make sure "+name+" is defined")
 	}
+	return val
+}
 
-	return val, nil
+func (p *parser) int(name string, def, min, max int) int {
+	raw := p.string(name, "")
+	if raw == "" {
+		return def
+	}
+	val, err := strconv.Atoi(raw)
+	if err != nil {
+		p.fail(name, raw, "must be an integer")
+		return def
+	}
+	if val < min || val > max {
+		p.fail(name, raw, fmt.Sprintf("must be between %d and %d", min, max))
+		return def
+	}
+	return val
+}
+
+func (p *parser) bool(name string, def bool) bool {
+	raw := p.string(name, "")
+	if raw == "" {
+		return def
+	}
+	val, err := strconv.ParseBool(raw)
+	if err != nil {
+		p.fail(name, raw, "must be true or false")
+		return def
+	}
+	return val
+}
+
+func (p *parser) enum(name, def string, allowed ...string) string {
+	val := strings.ToLower(p.string(name, def))
+	for _, a := range allowed {
+		if val == a {
+			return val
+		}
+	}
+	p.fail(name, val, "must be one of "+strings.Join(allowed, ", "))
+	return def
+}
+
+// env parses NAME=VALUE pairs, secret values never show up in errors
+func (p *parser) env(name string, secret bool) *env.Env {
+	vars, err := env.ParseList(p.string(name, ""), secret)
+	if err != nil {
+		value := p.string(name, "")
+		if secret {
+			value = ""
+		}
+		p.fail(name, value, err.Error())
+		return nil
+	}
+	return vars
+}
+
+func (p *parser) list(name, def string) []string {
+	var values []string
+	for _, v := range strings.Split(p.string(name, def), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// tools is a list of command names, which are also installed as package
+// names by root
+func (p *parser) tools(name, def string) []string {
+	values := p.list(name, def)
+	for _, v := range values {
+		if !toolRegexp.MatchString(v) {
+			p.fail(name, v, "must be a comma separated list of command names")
+			return nil
+		}
+	}
+	return values
+}
+
+// absPath validates a path inside the distro, so it always uses forward slashes
+func (p *parser) absPath(name, def string) string {
+	val := p.string(name, def)
+	if !path.IsAbs(val) {
+		p.fail(name, val, "must be an absolute path")
+		return def
+	}
+	return path.Clean(val)
+}
+
+// relPath accepts an empty value or a path that stays inside the directory
+// it is relative to
+func (p *parser) relPath(name string) string {
+	val := p.string(name, "")
+	if val == "" {
+		return ""
+	}
+	clean := path.Clean(val)
+	if path.IsAbs(clean) || clean == "." || clean == ".." || strings.HasPrefix(clean, "../") {
+		p.fail(name, val, "must be a relative path inside the repository")
+		return ""
+	}
+	return clean
+}
+
+// version accepts dotted numeric versions, "none" disables the check
+func (p *parser) version(name, def string) string {
+	val := p.string(name, def)
+	if strings.EqualFold(val, "none") {
+		return ""
+	}
+	if !versionRegexp.MatchString(val) {
+		p.fail(name, val, "must be a version such as 5.15")
+		return def
+	}
+	return val
+}
+
+// match accepts an empty value or one matching re
+func (p *parser) match(name string, re *regexp.Regexp, reason string) string {
+	val := p.string(name, "")
+	if val != "" && !re.MatchString(val) {
+		p.fail(name, val, reason)
+		return ""
+	}
+	return val
+}
+
+// gitArg rejects values git would parse as an option
+func (p *parser) gitArg(name string) string {
+	val := p.string(name, "")
+	if strings.HasPrefix(val, "-") {
+		p.fail(name, RedactURL(val), "must not start with -")
+		return ""
+	}
+	return val
+}
+
+func (p *parser) checksum(name string) string {
+	val := p.string(name, "")
+	if val != "" && !checksumRegexp.MatchString(val) {
+		p.fail(name, val, "must be a sha256 hex digest")
+		return ""
+	}
+	return strings.ToLower(val)
+}
+
+// user accepts Linux user names, empty keeps the distro's default user
+func (p *parser) user(name string) string {
+	val := p.string(name, "")
+	if val != "" && (len(val) > 32 || !userRegexp.MatchString(val)) {
+		p.fail(name, val, "must be a Linux user name")
+		return ""
+	}
+	return val
 }
@@ -0,0 +1,6 @@
+package pipe
+
+// GeneratePipeName generates a unique pipe path for a distro
+func GeneratePipeName(distro string) string {
+	return `\\.\pipe\devpod-wsl-` + distro
+}
@@ -1,3 +1,6 @@
+//go:build windows
+// +build windows
+
 package pipe
 
 import (
@@ -7,9 +10,8 @@ import (
 	"golang.org/x/sys/windows"
 )
 
-// CreateNamedPipe creates a Windows named pipe server
-func CreateNamedPipe(name string) (net.Listener, error) {
-	path := `\\.\pipe\` + name
+// CreateNamedPipe creates a Windows named pipe server at path (see GeneratePipeName)
+func CreateNamedPipe(path string) (net.Listener, error) {
 	pathPtr, err := windows.UTF16PtrFromString(path)
 	if err != nil {
 		return nil, err
@@ -33,11 +35,6 @@ func CreateNamedPipe(name string) (net.Listener, error) {
 		return nil, err
 	}
 
-	f := os.NewFile(uintptr(handle), name)
+	f := os.NewFile(uintptr(handle), path)
 	return net.FileListener(f)
 }
-
-// GeneratePipeName generates a unique pipe name for a distro
-func GeneratePipeName(distro string) string {
-	return `devpod-wsl-` + distro
-}
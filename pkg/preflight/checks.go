@@ -0,0 +1,151 @@
+package preflight
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/cosysn/devpod-provider-wsl/pkg/options"
+	"github.com/cosysn/devpod-provider-wsl/pkg/wsl"
+)
+
+// Distro is the part of wsl.WSL the checks need
+type Distro interface {
+	Version() (int, error)
+	KernelVersion() (string, error)
+	SystemdEnabled() bool
+	EnableSystemd() error
+	AvailableMemory() (uint64, error)
+	CheckDiskSpace(path string, minGB int) (*wsl.DiskInfo, error)
+	CheckTools(tools []string) error
+	InstallTools(tools []string) error
+}
+
+var _ Distro = &wsl.WSL{}
+
+const gb = 1 << 30
+
+// ChecksFromOptions builds the preflight checks declared by the provider options
+func ChecksFromOptions(d Distro, opts *options.Options) []Check {
+	checks := []Check{wslVersionCheck(d, opts.WSLVersion)}
+	if opts.MinKernelVersion != "" {
+		checks = append(checks, kernelCheck(d, opts.MinKernelVersion))
+	}
+	checks = append(checks, systemdCheck(d, opts.RequireSystemd))
+	if opts.MinDiskSpaceGB > 0 {
+		checks = append(checks, diskCheck(d, opts.WorkspaceRoot, opts.MinDiskSpaceGB))
+	}
+	if opts.MinMemoryGB > 0 {
+		checks = append(checks, memoryCheck(d, opts.MinMemoryGB))
+	}
+	if len(opts.RequiredTools) > 0 {
+		checks = append(checks, toolsCheck(d, opts.RequiredTools))
+	}
+	return checks
+}
+
+func wslVersionCheck(d Distro, required int) Check {
+	return Check{
+		Name: "wsl-version",
+		Run: func(ctx context.Context) (Status, string) {
+			version, err := d.Version()
+			if err != nil {
+				return StatusFail, fmt.Sprintf("wsl not available: %v", err)
+			}
+			if version < required {
+				return StatusFail, fmt.Sprintf("WSL %d is required, got WSL %d", required, version)
+			}
+			return StatusPass, fmt.Sprintf("WSL %d", version)
+		},
+	}
+}
+
+func kernelCheck(d Distro, minVersion string) Check {
+	return Check{
+		Name: "kernel-version",
+		Run: func(ctx context.Context) (Status, string) {
+			release, err := d.KernelVersion()
+			if err != nil {
+				return StatusFail, fmt.Sprintf("read kernel version: %v", err)
+			}
+			if wsl.CompareVersions(release, minVersion) < 0 {
+				return StatusFail, fmt.Sprintf("kernel %s is older than %s", release, minVersion)
+			}
+			return StatusPass, "kernel " + release
+		},
+	}
+}
+
+// systemdCheck only fails when systemd is required, otherwise a missing
+// systemd is reported as a warning
+func systemdCheck(d Distro, required bool) Check {
+	return Check{
+		Name: "systemd",
+		Run: func(ctx context.Context) (Status, string) {
+			if d.SystemdEnabled() {
+				return StatusPass, "systemd is enabled"
+			}
+			if required {
+				return StatusFail, "systemd is not enabled"
+			}
+			return StatusWarn, "systemd is not enabled"
+		},
+		Fix: func(ctx context.Context) error {
+			return d.EnableSystemd()
+		},
+	}
+}
+
+func diskCheck(d Distro, path string, minGB int) Check {
+	return Check{
+		Name: "disk-space",
+		Run: func(ctx context.Context) (Status, string) {
+			info, err := d.CheckDiskSpace(path, minGB)
+			if info == nil {
+				return StatusFail, fmt.Sprintf("check disk space of %s: %v", path, err)
+			}
+
+			message := fmt.Sprintf("%.1fGB available on %s (%s)", float64(info.AvailableBytes)/gb, info.Path, info.Filesystem)
+			if info.AvailableInodes >= 0 {
+				message += fmt.Sprintf(", %d inodes free", info.AvailableInodes)
+			}
+			if err != nil {
+				return StatusFail, fmt.Sprintf("%v: %s", err, message)
+			}
+			return StatusPass, message
+		},
+	}
+}
+
+// memoryCheck warns instead of failing because available memory changes all the time
+func memoryCheck(d Distro, minGB int) Check {
+	return Check{
+		Name: "memory",
+		Run: func(ctx context.Context) (Status, string) {
+			available, err := d.AvailableMemory()
+			if err != nil {
+				return StatusWarn, fmt.Sprintf("read available memory: %v", err)
+			}
+			message := fmt.Sprintf("%.1fGB available", float64(available)/gb)
+			if available < uint64(minGB)*gb {
+				return StatusWarn, fmt.Sprintf("%s, %dGB recommended", message, minGB)
+			}
+			return StatusPass, message
+		},
+	}
+}
+
+func toolsCheck(d Distro, tools []string) Check {
+	return Check{
+		Name: "tools",
+		Run: func(ctx context.Context) (Status, string) {
+			if err := d.CheckTools(tools); err != nil {
+				return StatusFail, err.Error()
+			}
+			return StatusPass, strings.Join(tools, ", ")
+		},
+		Fix: func(ctx context.Context) error {
+			return d.InstallTools(tools)
+		},
+	}
+}
@@ -0,0 +1,106 @@
+package preflight
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// Status is the outcome of a single check
+type Status string
+
+const (
+	StatusPass Status = "pass"
+	StatusWarn Status = "warn"
+	StatusFail Status = "fail"
+)
+
+// Result is what a check reports
+type Result struct {
+	Name    string `json:"name"`
+	Status  Status `json:"status"`
+	Message string `json:"message"`
+	Fixed   bool   `json:"fixed,omitempty"`
+}
+
+// Check is a single preflight check. Fix is optional and is only called
+// for failed or warning checks when remediation was requested.
+type Check struct {
+	Name string
+	Run  func(ctx context.Context) (Status, string)
+	Fix  func(ctx context.Context) error
+}
+
+// Report collects the results of a preflight run
+type Report struct {
+	Distro  string   `json:"distro"`
+	Passed  bool     `json:"passed"`
+	Results []Result `json:"results"`
+}
+
+// Run executes all checks in order. With fix set, failing checks that have
+// a Fix are remediated and checked again. Warnings are never remediated,
+// fixes such as enabling systemd restart the distribution.
+func Run(ctx context.Context, distro string, checks []Check, fix bool) *Report {
+	report := &Report{Distro: distro, Passed: true}
+	for _, check := range checks {
+		status, message := check.Run(ctx)
+		result := Result{Name: check.Name, Status: status, Message: message}
+
+		if fix && status == StatusFail && check.Fix != nil {
+			if err := check.Fix(ctx); err != nil {
+				result.Message = fmt.Sprintf("%s (fix failed: %v)", message, err)
+			} else {
+				result.Status, result.Message = check.Run(ctx)
+				result.Fixed = result.Status == StatusPass
+			}
+		}
+
+		if result.Status == StatusFail {
+			report.Passed = false
+		}
+		report.Results = append(report.Results, result)
+	}
+	return report
+}
+
+// Count returns how many results have the given status
+func (r *Report) Count(status Status) int {
+	n := 0
+	for _, result := range r.Results {
+		if result.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+// WriteTable writes a human readable summary table
+func (r *Report) WriteTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "CHECK\tSTATUS\tMESSAGE")
+	for _, result := range r.Results {
+		status := strings.ToUpper(string(result.Status))
+		if result.Fixed {
+			status += " (fixed)"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", result.Name, status, result.Message)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	_, err := fmt.Fprintf(w, "\n%d passed, %d warnings, %d failed\n",
+		r.Count(StatusPass), r.Count(StatusWarn), r.Count(StatusFail))
+	return err
+}
+
+// WriteJSON writes the report as indented JSON
+func (r *Report) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
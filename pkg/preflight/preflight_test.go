@@ -0,0 +1,231 @@
+package preflight
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/cosysn/devpod-provider-wsl/pkg/options"
+	"github.com/cosysn/devpod-provider-wsl/pkg/wsl"
+)
+
+type fakeDistro struct {
+	version   int
+	kernel    string
+	systemd   bool
+	memory    uint64
+	diskErr   error
+	missing   []string
+	installed []string
+}
+
+func (f *fakeDistro) Version() (int, error)            { return f.version, nil }
+func (f *fakeDistro) KernelVersion() (string, error)   { return f.kernel, nil }
+func (f *fakeDistro) SystemdEnabled() bool             { return f.systemd }
+func (f *fakeDistro) EnableSystemd() error             { f.systemd = true; return nil }
+func (f *fakeDistro) AvailableMemory() (uint64, error) { return f.memory, nil }
+func (f *fakeDistro) CheckDiskSpace(path string, minGB int) (*wsl.DiskInfo, error) {
+	return &wsl.DiskInfo{Path: path, Filesystem: "ext4", AvailableBytes: 50 * gb, AvailableInodes: 1000}, f.diskErr
+}
+
+func (f *fakeDistro) CheckTools(tools []string) error {
+	if len(f.missing) > 0 {
+		return &wsl.MissingToolsError{Tools: f.missing}
+	}
+	return nil
+}
+
+func (f *fakeDistro) InstallTools(tools []string) error {
+	f.installed = append(f.installed, f.missing...)
+	f.missing = nil
+	return nil
+}
+
+func testOptions() *options.Options {
+	return &options.Options{
+		WSLDistro:        "Ubuntu",
+		WSLVersion:       2,
+		MinKernelVersion: "5.10",
+		MinDiskSpaceGB:   5,
+		MinMemoryGB:      2,
+		RequiredTools:    []string{"git", "curl"},
+	}
+}
+
+func resultByName(r *Report, name string) Result {
+	for _, result := range r.Results {
+		if result.Name == name {
+			return result
+		}
+	}
+	return Result{}
+}
+
+func TestRun_AllPass(t *testing.T) {
+	d := &fakeDistro{version: 2, kernel: "5.15.133.1-microsoft-standard-WSL2", systemd: true, memory: 8 * gb}
+
+	report := Run(context.Background(), "Ubuntu", ChecksFromOptions(d, testOptions()), false)
+	if !report.Passed {
+		t.Fatalf("report should pass: %+v", report.Results)
+	}
+	if report.Count(StatusPass) != len(report.Results) {
+		t.Errorf("expected all checks to pass: %+v", report.Results)
+	}
+}
+
+func TestRun_Statuses(t *testing.T) {
+	tests := []struct {
+		name     string
+		distro   *fakeDistro
+		opts     func(o *options.Options)
+		check    string
+		want     Status
+		wantPass bool
+	}{
+		{
+			name:     "old kernel fails",
+			distro:   &fakeDistro{version: 2, kernel: "4.19.128-microsoft-standard", systemd: true, memory: 8 * gb},
+			check:    "kernel-version",
+			want:     StatusFail,
+			wantPass: false,
+		},
+		{
+			name:     "missing systemd warns",
+			distro:   &fakeDistro{version: 2, kernel: "5.15", memory: 8 * gb},
+			check:    "systemd",
+			want:     StatusWarn,
+			wantPass: true,
+		},
+		{
+			name:     "required systemd fails",
+			distro:   &fakeDistro{version: 2, kernel: "5.15", memory: 8 * gb},
+			opts:     func(o *options.Options) { o.RequireSystemd = true },
+			check:    "systemd",
+			want:     StatusFail,
+			wantPass: false,
+		},
+		{
+			name:     "low memory warns",
+			distro:   &fakeDistro{version: 2, kernel: "5.15", systemd: true, memory: gb},
+			check:    "memory",
+			want:     StatusWarn,
+			wantPass: true,
+		},
+		{
+			name:     "disk space fails",
+			distro:   &fakeDistro{version: 2, kernel: "5.15", systemd: true, memory: 8 * gb, diskErr: &wsl.DiskSpaceError{Available: 1, Required: 5}},
+			check:    "disk-space",
+			want:     StatusFail,
+			wantPass: false,
+		},
+		{
+			name:     "wsl 1 fails",
+			distro:   &fakeDistro{version: 1, kernel: "5.15", systemd: true, memory: 8 * gb},
+			check:    "wsl-version",
+			want:     StatusFail,
+			wantPass: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := testOptions()
+			if tt.opts != nil {
+				tt.opts(opts)
+			}
+			report := Run(context.Background(), "Ubuntu", ChecksFromOptions(tt.distro, opts), false)
+			if got := resultByName(report, tt.check).Status; got != tt.want {
+				t.Errorf("%s status = %s, want %s", tt.check, got, tt.want)
+			}
+			if report.Passed != tt.wantPass {
+				t.Errorf("Passed = %v, want %v", report.Passed, tt.wantPass)
+			}
+		})
+	}
+}
+
+func TestRun_Fix(t *testing.T) {
+	d := &fakeDistro{version: 2, kernel: "5.15", systemd: true, memory: 8 * gb, missing: []string{"git", "curl"}}
+
+	report := Run(context.Background(), "Ubuntu", ChecksFromOptions(d, testOptions()), false)
+	if report.Passed {
+		t.Fatal("report should fail without --fix")
+	}
+	if len(d.installed) != 0 {
+		t.Fatalf("nothing should be installed without --fix, got %v", d.installed)
+	}
+	if result := resultByName(report, "tools"); result.Message != "missing tools: git, curl" {
+		t.Errorf("tools message = %q, want all missing tools", result.Message)
+	}
+
+	report = Run(context.Background(), "Ubuntu", ChecksFromOptions(d, testOptions()), true)
+	if !report.Passed {
+		t.Fatalf("report should pass after fix: %+v", report.Results)
+	}
+	if result := resultByName(report, "tools"); !result.Fixed {
+		t.Errorf("tools result should be marked fixed: %+v", result)
+	}
+}
+
+func TestRun_FixSkipsWarnings(t *testing.T) {
+	d := &fakeDistro{version: 2, kernel: "5.15", memory: 8 * gb}
+
+	// systemd is only a warning when it isn't required
+	report := Run(context.Background(), "Ubuntu", ChecksFromOptions(d, testOptions()), true)
+	if result := resultByName(report, "systemd"); result.Status != StatusWarn || d.systemd {
+		t.Errorf("systemd was enabled for a warning: %+v", result)
+	}
+
+	opts := testOptions()
+	opts.RequireSystemd = true
+	report = Run(context.Background(), "Ubuntu", ChecksFromOptions(d, opts), true)
+	if result := resultByName(report, "systemd"); !result.Fixed || !d.systemd {
+		t.Errorf("required systemd was not enabled: %+v", result)
+	}
+}
+
+func TestRun_FixFailure(t *testing.T) {
+	checks := []Check{{
+		Name: "broken",
+		Run:  func(ctx context.Context) (Status, string) { return StatusFail, "broken" },
+		Fix:  func(ctx context.Context) error { return errors.New("no package manager") },
+	}}
+
+	report := Run(context.Background(), "Ubuntu", checks, true)
+	result := resultByName(report, "broken")
+	if result.Status != StatusFail || !strings.Contains(result.Message, "no package manager") {
+		t.Errorf("unexpected result: %+v", result)
+	}
+}
+
+func TestReport_Output(t *testing.T) {
+	report := &Report{Distro: "Ubuntu", Passed: false, Results: []Result{
+		{Name: "tools", Status: StatusFail, Message: "missing tool: curl"},
+		{Name: "systemd", Status: StatusWarn, Message: "systemd is not enabled"},
+	}}
+
+	table := new(bytes.Buffer)
+	if err := report.WriteTable(table); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"CHECK", "FAIL", "WARN", "missing tool: curl", "0 passed, 1 warnings, 1 failed"} {
+		if !strings.Contains(table.String(), want) {
+			t.Errorf("table should contain %q, got:\n%s", want, table.String())
+		}
+	}
+
+	out := new(bytes.Buffer)
+	if err := report.WriteJSON(out); err != nil {
+		t.Fatal(err)
+	}
+	decoded := &Report{}
+	if err := json.Unmarshal(out.Bytes(), decoded); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if len(decoded.Results) != 2 || decoded.Results[0].Status != StatusFail {
+		t.Errorf("unexpected decoded report: %+v", decoded)
+	}
+}
@@ -1,6 +1,7 @@
 package tunnel
 
 import (
+	"fmt"
 	"net"
 	"os"
 	"path/filepath"
@@ -38,6 +39,28 @@ func (s *UnixServer) Listen() error {
 	return nil
 }
 
+// Inherit 使用从上一个 agent 进程或 systemd 继承的监听 socket，socket 文件保持不变
+func (s *UnixServer) Inherit(f *os.File) error {
+	defer f.Close()
+	listener, err := net.FileListener(f)
+	if err != nil {
+		return err
+	}
+	s.listener = listener
+	return nil
+}
+
+// Handover 返回监听 socket 的文件，用于交给 exec 之后的新进程。
+// 之后关闭 listener 不再删除 socket 文件
+func (s *UnixServer) Handover() (*os.File, error) {
+	listener, ok := s.listener.(*net.UnixListener)
+	if !ok {
+		return nil, fmt.Errorf("cannot hand over %T", s.listener)
+	}
+	listener.SetUnlinkOnClose(false)
+	return listener.File()
+}
+
 func (s *UnixServer) Accept() (net.Conn, error) {
 	return s.listener.Accept()
 }
@@ -3,6 +3,7 @@ package tunnel
 import (
 	"net"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 )
@@ -67,3 +68,45 @@ func TestUnixClient_Dial(t *testing.T) {
 
 	t.Log("Unix client dial test passed")
 }
+
+func TestUnixServer_HandoverAndInherit(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "agent.sock")
+	old := NewUnixServer(socketPath)
+	if err := old.Listen(); err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	f, err := old.Handover()
+	if err != nil {
+		t.Fatalf("Handover failed: %v", err)
+	}
+	// Closing the old listener keeps the socket file for the new process
+	old.Close()
+	if _, err := os.Stat(socketPath); err != nil {
+		t.Fatalf("socket removed on close: %v", err)
+	}
+
+	inherited := NewUnixServer(socketPath)
+	if err := inherited.Inherit(f); err != nil {
+		t.Fatalf("Inherit failed: %v", err)
+	}
+	defer inherited.Close()
+
+	accepted := make(chan error, 1)
+	go func() {
+		conn, err := inherited.Accept()
+		if err == nil {
+			conn.Close()
+		}
+		accepted <- err
+	}()
+
+	client, err := net.Dial("unix", socketPath)
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer client.Close()
+	if err := <-accepted; err != nil {
+		t.Fatalf("Accept on inherited listener failed: %v", err)
+	}
+}
@@ -0,0 +1,116 @@
+package wsl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/cosysn/devpod-provider-wsl/pkg/devcontainer"
+	"github.com/cosysn/devpod-provider-wsl/pkg/env"
+)
+
+// findFile prints the name and content of the first existing file
+const findFile = `for f in "$@"; do [ -f "$f" ] && { echo "$f"; exec cat -- "$f"; }; done; exit 0`
+
+// hookScript runs a lifecycle command in the workspace directory $1 after
+// evaluating the exports in $2. A shell command follows -c, any other
+// arguments are run without a shell.
+const hookScript = `cd -- "$1" || exit 1
+eval "$2" || exit 1
+shift 2
+[ "$1" = -c ] && exec /bin/sh -c "$2"
+exec "$@"`
+
+// ReadDevcontainer reads devcontainer.json from the workspace directory dir.
+// It returns nil when the workspace has none.
+func (w *WSL) ReadDevcontainer(dir string) (*devcontainer.Config, error) {
+	files := make([]string, len(devcontainer.Paths))
+	for i, p := range devcontainer.Paths {
+		files[i] = path.Join(dir, p)
+	}
+	output, err := exec.Command(wslExe, w.userArgs(append([]string{"sh", "-c", findFile, "sh"}, files...)...)...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("read devcontainer.json: %w", err)
+	}
+	name, content, found := strings.Cut(string(output), "\n")
+	if !found {
+		return nil, nil
+	}
+	config, err := devcontainer.Parse([]byte(content))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	config.Expand(dir)
+	return config, nil
+}
+
+// RunHook runs a lifecycle command of config in the workspace directory dir
+// as w.User, in a login shell like other commands. vars are passed like for
+// other commands, containerEnv and remoteEnv are set on top of them. Output
+// is passed to output line by line; the steps of the object form run in
+// parallel and their lines are prefixed with the step name, output is
+// still called with one line at a time. Errors name the hook and the failed
+// steps.
+func (w *WSL) RunHook(ctx context.Context, dir string, config *devcontainer.Config, hook devcontainer.Hook, vars *env.Env, output func(line string)) error {
+	exports := config.ExportScript()
+	if !hook.Command.Parallel() {
+		if err := w.runStep(ctx, dir, exports, hook.Command[0], vars, output); err != nil {
+			return fmt.Errorf("%s failed: %w", hook.Name, err)
+		}
+		return nil
+	}
+
+	var (
+		wg sync.WaitGroup
+		mu sync.Mutex
+	)
+	errs := make([]error, len(hook.Command))
+	for i, step := range hook.Command {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			emit := func(line string) {
+				if output != nil {
+					mu.Lock()
+					defer mu.Unlock()
+					output("[" + step.Name + "] " + line)
+				}
+			}
+			if err := w.runStep(ctx, dir, exports, step, vars, emit); err != nil {
+				errs[i] = fmt.Errorf("%s: %w", step.Name, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("%s failed: %w", hook.Name, err)
+	}
+	return nil
+}
+
+func (w *WSL) runStep(ctx context.Context, dir, exports string, step devcontainer.Step, vars *env.Env, output func(line string)) error {
+	args := []string{"bash", "--login", "-c", hookScript, "devpod-hook", dir, exports}
+	if step.Shell != "" {
+		args = append(args, "-c", step.Shell)
+	} else {
+		args = append(args, step.Args...)
+	}
+	cmd := exec.CommandContext(ctx, wslExe, w.userArgs(args...)...)
+	SetEnv(cmd, vars)
+	out := &progressWriter{emit: output}
+	cmd.Stdout = out
+	cmd.Stderr = out
+	err := cmd.Run()
+	out.Flush()
+	if err != nil && out.last != "" {
+		return fmt.Errorf("%w: %s", err, out.last)
+	}
+	return err
+}
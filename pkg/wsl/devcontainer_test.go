@@ -0,0 +1,109 @@
+package wsl
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/cosysn/devpod-provider-wsl/pkg/devcontainer"
+	"github.com/cosysn/devpod-provider-wsl/pkg/env"
+)
+
+func TestReadDevcontainer(t *testing.T) {
+	useFakeWSL(t)
+	w := &WSL{Distro: "Ubuntu"}
+	dir := t.TempDir()
+
+	config, err := w.ReadDevcontainer(dir)
+	if err != nil || config != nil {
+		t.Fatalf("ReadDevcontainer without a file = %v, %v", config, err)
+	}
+
+	// .devcontainer.json is used when .devcontainer/devcontainer.json is missing
+	os.WriteFile(filepath.Join(dir, ".devcontainer.json"), []byte(`{"postStartCommand": "echo root"}`), 0o644)
+	config, err = w.ReadDevcontainer(dir)
+	if err != nil || config == nil || config.PostStartCommand[0].Shell != "echo root" {
+		t.Fatalf("ReadDevcontainer = %+v, %v", config, err)
+	}
+
+	os.Mkdir(filepath.Join(dir, ".devcontainer"), 0o755)
+	os.WriteFile(filepath.Join(dir, ".devcontainer", "devcontainer.json"), []byte(`{
+		// comments are allowed
+		"postStartCommand": "cd ${containerWorkspaceFolder}",
+	}`), 0o644)
+	config, err = w.ReadDevcontainer(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := config.PostStartCommand[0].Shell; got != "cd "+dir {
+		t.Errorf("postStartCommand = %q", got)
+	}
+
+	os.WriteFile(filepath.Join(dir, ".devcontainer", "devcontainer.json"), []byte(`{"postStartCommand": 1}`), 0o644)
+	if _, err := w.ReadDevcontainer(dir); err == nil || !strings.Contains(err.Error(), "devcontainer.json") {
+		t.Errorf("ReadDevcontainer with an invalid file = %v", err)
+	}
+}
+
+func TestRunHook(t *testing.T) {
+	useFakeWSL(t)
+	// Keep the user's profile out of the login shell's output
+	t.Setenv("HOME", t.TempDir())
+	w := &WSL{Distro: "Ubuntu"}
+	dir := t.TempDir()
+	config, err := devcontainer.Parse([]byte(`{
+		"onCreateCommand": "echo \"$PWD $GREETING $TOKEN\"; echo to stderr >&2",
+		"updateContentCommand": ["printf", "%s\n", "no $SHELL expansion"],
+		"postCreateCommand": {"a": "echo first", "b": ["echo", "second"]},
+		"postStartCommand": {"ok": "true", "broken": "echo giving up; exit 3"},
+		"containerEnv": {"GREETING": "hello"}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	vars := env.New()
+	vars.Set("TOKEN", "secret", true)
+
+	run := func(hook devcontainer.Hook) ([]string, error) {
+		var lines []string
+		err := w.RunHook(context.Background(), dir, config, hook, vars, func(line string) { lines = append(lines, line) })
+		return lines, err
+	}
+
+	hooks := config.CreateHooks()
+	lines, err := run(hooks[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{dir + " hello secret", "to stderr"}; strings.Join(lines, "|") != strings.Join(want, "|") {
+		t.Errorf("onCreateCommand output = %q, want %q", lines, want)
+	}
+
+	lines, err = run(hooks[1])
+	if err != nil || len(lines) != 1 || lines[0] != "no $SHELL expansion" {
+		t.Errorf("updateContentCommand = %q, %v", lines, err)
+	}
+
+	// Parallel steps finish in any order
+	lines, err = run(hooks[2])
+	sort.Strings(lines)
+	if err != nil || strings.Join(lines, "|") != "[a] first|[b] second" {
+		t.Errorf("postCreateCommand = %q, %v", lines, err)
+	}
+
+	_, err = run(config.StartHooks()[0])
+	if err == nil {
+		t.Fatal("a failing step succeeded")
+	}
+	for _, want := range []string{"postStartCommand failed", "broken", "exit status 3", "giving up"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not contain %q", err, want)
+		}
+	}
+	if strings.Contains(err.Error(), "ok:") {
+		t.Errorf("error %q names a step that succeeded", err)
+	}
+}
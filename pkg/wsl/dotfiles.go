@@ -0,0 +1,76 @@
+package wsl
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+
+	"github.com/cosysn/devpod-provider-wsl/pkg/options"
+)
+
+// dotfilesScript clones the dotfiles repository $1 into ~/dotfiles and runs
+// the install script $2, or the first well-known script, as the user. Without
+// a script the repository's dotfiles are linked into the home directory. A
+// marker in the user's state directory records a hash of the repository and
+// script, so they are installed only once without keeping credentials from
+// the URL on disk.
+const dotfilesScript = `url=$1 script=$2
+dir="$HOME/dotfiles"
+marker="${XDG_STATE_HOME:-$HOME/.local/state}/devpod-provider-wsl/dotfiles"
+want=$(printf '%s\n%s' "$url" "$script" | sha256sum | cut -d' ' -f1)
+if [ -f "$marker" ] && [ "$(cat "$marker")" = "$want" ]; then
+  echo "Dotfiles are already installed" >&2
+  exit 0
+fi
+if [ -d "$dir/.git" ]; then
+  if [ "$(git -C "$dir" remote get-url origin 2>/dev/null)" != "$url" ]; then
+    echo "$dir is a clone of another repository" >&2
+    exit 1
+  fi
+  git -C "$dir" pull --ff-only --progress || exit 1
+elif [ -e "$dir" ]; then
+  echo "$dir exists and is not a git repository" >&2
+  exit 1
+else
+  git clone --progress -- "$url" "$dir" || exit 1
+fi
+cd "$dir" || exit 1
+if [ -n "$script" ]; then
+  [ -f "$script" ] || { echo "install script $script not found in the repository" >&2; exit 1; }
+  set -- "$script"
+else
+  set --
+  for f in install.sh install bootstrap.sh bootstrap script/bootstrap setup.sh setup script/setup; do
+    [ -f "$f" ] && { set -- "$f"; break; }
+  done
+fi
+if [ $# -gt 0 ]; then
+  echo "Running $1" >&2
+  if [ -x "$1" ]; then "./$1"; else /bin/sh "./$1"; fi || exit 1
+else
+  echo "No install script found, linking dotfiles into $HOME" >&2
+  for f in .[!.]* ..?*; do
+    case "$f" in .git|.gitignore|.gitmodules|.github) continue ;; esac
+    [ -e "$f" ] && ln -sfn "$dir/$f" "$HOME/$f"
+  done
+fi
+mkdir -p "$(dirname "$marker")" && printf '%s\n' "$want" > "$marker"`
+
+// InstallDotfiles clones a dotfiles repository and runs its install script
+// as w.User in a login shell, passing the output to progress line by line.
+// Installing the same repository and script again does nothing.
+func (w *WSL) InstallDotfiles(ctx context.Context, url, script string, progress func(line string)) error {
+	cmd := exec.CommandContext(ctx, wslExe, w.userArgs("bash", "--login", "-c", dotfilesScript, "devpod-dotfiles", url, script)...)
+	out := &progressWriter{emit: progress}
+	cmd.Stdout = out
+	cmd.Stderr = out
+	err := cmd.Run()
+	out.Flush()
+	if err != nil {
+		if out.last != "" {
+			return fmt.Errorf("install dotfiles from %s: %w: %s", options.RedactURL(url), err, out.last)
+		}
+		return fmt.Errorf("install dotfiles from %s: %w", options.RedactURL(url), err)
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package wsl
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// dotfilesRepo creates a dotfiles repository from files and returns its URL
+func dotfilesRepo(t *testing.T, files map[string]string) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	repo := t.TempDir()
+	git(t, repo, "init", "-q")
+	for name, content := range files {
+		os.MkdirAll(filepath.Dir(filepath.Join(repo, name)), 0o755)
+		os.WriteFile(filepath.Join(repo, name), []byte(content), 0o755)
+	}
+	git(t, repo, "add", ".")
+	git(t, repo, "commit", "-q", "-m", "dotfiles")
+	return "file://" + repo
+}
+
+func TestInstallDotfiles(t *testing.T) {
+	useFakeWSL(t)
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_STATE_HOME", "")
+	w := &WSL{Distro: "Ubuntu"}
+
+	url := dotfilesRepo(t, map[string]string{
+		"install.sh":   "#!/bin/sh\necho installed >> \"$HOME/install.log\"\n",
+		"script/other": "#!/bin/sh\necho other >> \"$HOME/install.log\"\n",
+	})
+	install := func(script string) []string {
+		t.Helper()
+		var lines []string
+		if err := w.InstallDotfiles(context.Background(), url, script, func(line string) { lines = append(lines, line) }); err != nil {
+			t.Fatalf("InstallDotfiles(%q) failed: %v\n%s", script, err, strings.Join(lines, "\n"))
+		}
+		return lines
+	}
+
+	install("")
+	if lines := install(""); len(lines) != 1 || !strings.Contains(lines[0], "already installed") {
+		t.Errorf("second install output = %q", lines)
+	}
+	// Another script installs again
+	install("script/other")
+	if got := fileContent(t, filepath.Join(home, "install.log")); got != "installed\nother\n" {
+		t.Errorf("install.log = %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(home, "dotfiles", ".git")); err != nil {
+		t.Errorf("dotfiles not cloned into the home directory: %v", err)
+	}
+
+	var lines []string
+	err := w.InstallDotfiles(context.Background(), url, "missing.sh", func(line string) { lines = append(lines, line) })
+	if err == nil || !strings.Contains(err.Error(), "missing.sh not found") {
+		t.Errorf("InstallDotfiles with a missing script = %v", err)
+	}
+}
+
+func TestInstallDotfiles_Link(t *testing.T) {
+	useFakeWSL(t)
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_STATE_HOME", filepath.Join(home, "state"))
+	w := &WSL{Distro: "Ubuntu"}
+
+	url := dotfilesRepo(t, map[string]string{".vimrc": "set nu\n", ".gitignore": "*.swp\n", "README.md": "mine\n"})
+	if err := w.InstallDotfiles(context.Background(), url, "", nil); err != nil {
+		t.Fatal(err)
+	}
+	if target, err := os.Readlink(filepath.Join(home, ".vimrc")); err != nil || target != filepath.Join(home, "dotfiles", ".vimrc") {
+		t.Errorf(".vimrc link = %q, %v", target, err)
+	}
+	for _, name := range []string{".gitignore", "README.md", ".git"} {
+		if _, err := os.Lstat(filepath.Join(home, name)); err == nil {
+			t.Errorf("%s linked into the home directory", name)
+		}
+	}
+	marker, err := os.ReadFile(filepath.Join(home, "state", "devpod-provider-wsl", "dotfiles"))
+	if err != nil {
+		t.Errorf("marker not written to XDG_STATE_HOME: %v", err)
+	} else if strings.Contains(string(marker), url) {
+		t.Errorf("marker = %q, contains the URL", marker)
+	}
+
+	// A different repository in ~/dotfiles is not touched
+	other := dotfilesRepo(t, map[string]string{"install.sh": "exit 0\n"})
+	err = w.InstallDotfiles(context.Background(), other, "", nil)
+	if err == nil || !strings.Contains(err.Error(), "clone of another repository") {
+		t.Errorf("InstallDotfiles with another repository = %v", err)
+	}
+}
@@ -0,0 +1,56 @@
+package wsl
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/cosysn/devpod-provider-wsl/pkg/env"
+)
+
+// readFile prints a file when it exists, so a missing file isn't an error
+const readFile = `[ -e "$1" ] || exit 0; cat -- "$1"`
+
+// ReadEnvFile reads and parses a .env file inside the distribution, a
+// missing file is read as empty. The content only ever lives in memory.
+func (w *WSL) ReadEnvFile(path string) (*env.Env, error) {
+	if path == "" {
+		return nil, nil
+	}
+	output, err := exec.Command(wslExe, w.userArgs("sh", "-c", readFile, "sh", path)...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("read env file %s: %w", path, err)
+	}
+	vars, err := env.ParseDotenv(string(output))
+	if err != nil {
+		return nil, fmt.Errorf("env file %s: %w", path, err)
+	}
+	return vars, nil
+}
+
+// SetEnv passes vars to the Linux side of cmd. WSLENV lists the variables
+// wsl.exe shares with the distribution, so values never touch the disk.
+func SetEnv(cmd *exec.Cmd, vars *env.Env) {
+	if vars == nil || vars.Len() == 0 {
+		return
+	}
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+
+	shared := vars.Names()
+	var environ []string
+	for _, kv := range cmd.Env {
+		name, value, _ := strings.Cut(kv, "=")
+		if name == "WSLENV" {
+			if value != "" {
+				shared = append(strings.Split(value, ":"), shared...)
+			}
+			continue
+		}
+		environ = append(environ, kv)
+	}
+	environ = append(environ, vars.Environ()...)
+	cmd.Env = append(environ, "WSLENV="+strings.Join(shared, ":"))
+}
@@ -0,0 +1,49 @@
+package wsl
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cosysn/devpod-provider-wsl/pkg/env"
+)
+
+func TestReadEnvFile(t *testing.T) {
+	useFakeWSL(t)
+	w := &WSL{Distro: "Ubuntu"}
+
+	path := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(path, []byte("export GREETING=\"hello world\"\nDEBUG=1 # verbose\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	vars, err := w.ReadEnvFile(path)
+	if err != nil {
+		t.Fatalf("ReadEnvFile failed: %v", err)
+	}
+	if got := strings.Join(vars.Environ(), ","); got != "DEBUG=1,GREETING=hello world" {
+		t.Errorf("ReadEnvFile() = %q", got)
+	}
+
+	vars, err = w.ReadEnvFile(filepath.Join(t.TempDir(), "missing"))
+	if err != nil || vars.Len() != 0 {
+		t.Errorf("ReadEnvFile(missing) = %v, %v, want empty", vars, err)
+	}
+}
+
+func TestSetEnv(t *testing.T) {
+	vars := env.New()
+	vars.Set("TOKEN", "s3cret", true)
+	vars.Set("EDITOR", "vim", false)
+
+	cmd := exec.Command("true")
+	cmd.Env = []string{"PATH=/bin", "WSLENV=USERPROFILE/p"}
+	SetEnv(cmd, vars)
+
+	want := []string{"PATH=/bin", "EDITOR=vim", "TOKEN=s3cret", "WSLENV=USERPROFILE/p:EDITOR:TOKEN"}
+	if strings.Join(cmd.Env, "\n") != strings.Join(want, "\n") {
+		t.Errorf("SetEnv() env = %q, want %q", cmd.Env, want)
+	}
+}
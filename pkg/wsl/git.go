@@ -0,0 +1,127 @@
+package wsl
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/cosysn/devpod-provider-wsl/pkg/options"
+)
+
+// CloneOptions describes the repository cloned into a new workspace
+type CloneOptions struct {
+	URL    string
+	Dir    string
+	Branch string
+	Commit string
+	// Shallow fetches only the commit that is checked out, submodules included
+	Shallow bool
+	// CredentialHelper is used for the clone and stored in the repository
+	CredentialHelper string
+}
+
+// cloneScript clones $1 into $2 and checks out branch $3 or commit $4, then
+// fetches submodules and Git LFS objects. A directory that already holds a
+// repository is left alone, so create can be retried. Every value is a
+// positional argument, nothing is quoted into the script.
+const cloneScript = `url=$1 dir=$2 branch=$3 commit=$4 shallow=$5 helper=$6
+if [ -e "$dir/.git" ]; then
+  echo "$dir already contains a git repository, skipping clone" >&2
+  exit 0
+fi
+if [ -n "$(ls -A "$dir" 2>/dev/null)" ]; then
+  echo "$dir is not empty" >&2
+  exit 1
+fi
+mkdir -p "$dir" || exit 1
+set -- git
+[ -n "$helper" ] && set -- "$@" -c credential.helper= -c "credential.helper=$helper"
+set -- "$@" clone --progress
+[ -n "$branch" ] && set -- "$@" --branch "$branch"
+[ "$shallow" = true ] && set -- "$@" --depth 1
+[ -n "$commit" ] && set -- "$@" --no-checkout
+"$@" -- "$url" "$dir" || exit 1
+cd "$dir" || exit 1
+if [ -n "$helper" ]; then
+  git config credential.helper "$helper" || exit 1
+fi
+if [ -n "$commit" ]; then
+  if [ "$shallow" = true ]; then
+    # Not every server allows fetching a commit by hash
+    git fetch --progress --depth 1 origin "$commit" || git fetch --progress --unshallow origin || exit 1
+  fi
+  git -c advice.detachedHead=false checkout --progress "$commit" || exit 1
+fi
+if [ -f .gitmodules ]; then
+  echo "Updating submodules" >&2
+  depth=
+  [ "$shallow" = true ] && depth="--depth 1"
+  git submodule update --init --recursive --progress $depth || exit 1
+fi
+if find . -name .gitattributes -not -path './.git/*' -exec grep -l 'filter=lfs' {} + 2>/dev/null | grep -q .; then
+  if git lfs version >/dev/null 2>&1; then
+    echo "Fetching Git LFS objects" >&2
+    git lfs install --local && git lfs pull || exit 1
+  else
+    echo "warning: the repository uses Git LFS but git-lfs is not installed, LFS files are left as pointers" >&2
+  fi
+fi`
+
+// Clone clones a repository inside the distribution as w.User. git's
+// progress is passed to progress line by line; the in-place updates of a
+// progress line are dropped, only the final state of each line is passed.
+func (w *WSL) Clone(ctx context.Context, opts CloneOptions, progress func(line string)) error {
+	cmd := exec.CommandContext(ctx, wslExe, w.userArgs("sh", "-c", cloneScript, "sh",
+		opts.URL, opts.Dir, opts.Branch, opts.Commit, strconv.FormatBool(opts.Shallow), opts.CredentialHelper)...)
+	out := &progressWriter{emit: progress}
+	cmd.Stdout = out
+	cmd.Stderr = out
+	err := cmd.Run()
+	out.Flush()
+	if err != nil {
+		if out.last != "" {
+			return fmt.Errorf("clone %s: %w: %s", options.RedactURL(opts.URL), err, out.last)
+		}
+		return fmt.Errorf("clone %s: %w", options.RedactURL(opts.URL), err)
+	}
+	return nil
+}
+
+// progressWriter splits output into lines. A carriage return starts the
+// line over, the way a terminal shows git's progress counters.
+type progressWriter struct {
+	emit func(line string)
+	line bytes.Buffer
+	// last is the last non-empty line, used in errors
+	last string
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	for _, c := range b {
+		switch c {
+		case '\r':
+			p.line.Reset()
+		case '\n':
+			p.Flush()
+		default:
+			p.line.WriteByte(c)
+		}
+	}
+	return len(b), nil
+}
+
+// Flush passes on a pending line
+func (p *progressWriter) Flush() {
+	line := strings.TrimSpace(p.line.String())
+	p.line.Reset()
+	if line == "" {
+		return
+	}
+	p.last = line
+	if p.emit != nil {
+		p.emit(line)
+	}
+}
@@ -0,0 +1,163 @@
+package wsl
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// git runs git in dir with a fixed identity
+func git(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com", "-c", "init.defaultBranch=main"}, args...)...)
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, output)
+	}
+	return strings.TrimSpace(string(output))
+}
+
+// sourceRepo creates a repository with two commits on main, a feature
+// branch and a submodule, and returns its file:// URL and first commit
+func sourceRepo(t *testing.T) (string, string) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	// Submodules are cloned over file://, which git refuses by default
+	t.Setenv("GIT_CONFIG_COUNT", "1")
+	t.Setenv("GIT_CONFIG_KEY_0", "protocol.file.allow")
+	t.Setenv("GIT_CONFIG_VALUE_0", "always")
+
+	base := t.TempDir()
+	lib := filepath.Join(base, "lib")
+	os.Mkdir(lib, 0o755)
+	git(t, lib, "init", "-q")
+	os.WriteFile(filepath.Join(lib, "lib.txt"), []byte("lib\n"), 0o644)
+	git(t, lib, "add", ".")
+	git(t, lib, "commit", "-q", "-m", "lib")
+
+	repo := filepath.Join(base, "repo")
+	os.Mkdir(repo, 0o755)
+	git(t, repo, "init", "-q")
+	os.WriteFile(filepath.Join(repo, "README.md"), []byte("v1\n"), 0o644)
+	git(t, repo, "add", ".")
+	git(t, repo, "commit", "-q", "-m", "v1")
+	first := git(t, repo, "rev-parse", "HEAD")
+	git(t, repo, "submodule", "--quiet", "add", "file://"+lib, "lib")
+	os.WriteFile(filepath.Join(repo, "README.md"), []byte("v2\n"), 0o644)
+	git(t, repo, "commit", "-q", "-am", "v2")
+	git(t, repo, "checkout", "-q", "-b", "feature")
+	os.WriteFile(filepath.Join(repo, "feature.txt"), []byte("feature\n"), 0o644)
+	git(t, repo, "add", ".")
+	git(t, repo, "commit", "-q", "-m", "feature")
+	git(t, repo, "checkout", "-q", "main")
+	// Allow shallow fetches of any commit, like most hosting services
+	git(t, repo, "config", "uploadpack.allowAnySHA1InWant", "true")
+	return "file://" + repo, first
+}
+
+func fileContent(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+func TestClone(t *testing.T) {
+	useFakeWSL(t)
+	url, first := sourceRepo(t)
+	w := &WSL{Distro: "Ubuntu"}
+
+	tests := []struct {
+		name    string
+		opts    CloneOptions
+		readme  string
+		feature bool
+		depth   string
+	}{
+		{name: "default branch", opts: CloneOptions{}, readme: "v2\n", depth: "2"},
+		{name: "branch", opts: CloneOptions{Branch: "feature"}, readme: "v2\n", feature: true, depth: "3"},
+		{name: "shallow", opts: CloneOptions{Shallow: true}, readme: "v2\n", depth: "1"},
+		{name: "shallow commit", opts: CloneOptions{Commit: first, Shallow: true}, readme: "v1\n", depth: "1"},
+		{name: "commit", opts: CloneOptions{Commit: first}, readme: "v1\n", depth: "1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), "workspaces", "ws")
+			tt.opts.URL, tt.opts.Dir = url, dir
+			var lines []string
+			if err := w.Clone(context.Background(), tt.opts, func(line string) { lines = append(lines, line) }); err != nil {
+				t.Fatalf("Clone failed: %v\n%s", err, strings.Join(lines, "\n"))
+			}
+			if got := fileContent(t, filepath.Join(dir, "README.md")); got != tt.readme {
+				t.Errorf("README.md = %q, want %q", got, tt.readme)
+			}
+			if _, err := os.Stat(filepath.Join(dir, "feature.txt")); (err == nil) != tt.feature {
+				t.Errorf("feature.txt exists = %v, want %v", err == nil, tt.feature)
+			}
+			if depth := git(t, dir, "rev-list", "--count", "HEAD"); depth != tt.depth {
+				t.Errorf("history has %s commits, want %s", depth, tt.depth)
+			}
+			// The first commit has no submodule yet
+			if tt.readme == "v2\n" && fileContent(t, filepath.Join(dir, "lib", "lib.txt")) != "lib\n" {
+				t.Errorf("submodule not checked out, output:\n%s", strings.Join(lines, "\n"))
+			}
+		})
+	}
+}
+
+func TestClone_Idempotent(t *testing.T) {
+	useFakeWSL(t)
+	url, _ := sourceRepo(t)
+	w := &WSL{Distro: "Ubuntu"}
+	dir := filepath.Join(t.TempDir(), "ws")
+
+	opts := CloneOptions{URL: url, Dir: dir, CredentialHelper: "store"}
+	if err := w.Clone(context.Background(), opts, nil); err != nil {
+		t.Fatal(err)
+	}
+	if helper := git(t, dir, "config", "credential.helper"); helper != "store" {
+		t.Errorf("credential.helper = %q, want store", helper)
+	}
+
+	// A second create keeps the existing clone
+	var lines []string
+	if err := w.Clone(context.Background(), opts, func(line string) { lines = append(lines, line) }); err != nil {
+		t.Fatalf("second Clone failed: %v", err)
+	}
+	if len(lines) != 1 || !strings.Contains(lines[0], "skipping clone") {
+		t.Errorf("second Clone output = %q", lines)
+	}
+
+	// A directory with other content is not overwritten
+	other := t.TempDir()
+	os.WriteFile(filepath.Join(other, "notes.txt"), []byte("mine"), 0o644)
+	err := w.Clone(context.Background(), CloneOptions{URL: url, Dir: other}, nil)
+	if err == nil || !strings.Contains(err.Error(), "is not empty") {
+		t.Errorf("Clone into a non-empty directory = %v", err)
+	}
+}
+
+func TestProgressWriter(t *testing.T) {
+	var lines []string
+	p := &progressWriter{emit: func(line string) { lines = append(lines, line) }}
+	p.Write([]byte("Cloning into 'ws'...\nReceiving objects:  50% (1/2)\rReceiving objects: 100% (2/2), done.\nRes"))
+	p.Write([]byte("olving deltas: 100% (1/1), done.\n"))
+	p.Write([]byte("fatal: not found"))
+	p.Flush()
+
+	want := []string{"Cloning into 'ws'...", "Receiving objects: 100% (2/2), done.", "Resolving deltas: 100% (1/1), done.", "fatal: not found"}
+	if strings.Join(lines, "|") != strings.Join(want, "|") {
+		t.Errorf("lines = %q, want %q", lines, want)
+	}
+	if p.last != "fatal: not found" {
+		t.Errorf("last = %q", p.last)
+	}
+}
@@ -0,0 +1,155 @@
+package wsl
+
+import (
+	"fmt"
+	"strings"
+)
+
+// PackageManager describes how to install packages non-interactively
+type PackageManager struct {
+	Name string
+	// Update refreshes the package index, it may be empty
+	Update string
+	// Install is followed by the package names
+	Install string
+}
+
+var packageManagers = map[string]*PackageManager{
+	"apt": {
+		Name:    "apt",
+		Update:  "DEBIAN_FRONTEND=noninteractive apt-get update -q",
+		Install: "DEBIAN_FRONTEND=noninteractive apt-get install -y -q --no-install-recommends",
+	},
+	"dnf": {
+		Name:    "dnf",
+		Install: "dnf install -y -q",
+	},
+	"zypper": {
+		Name:    "zypper",
+		Update:  "zypper --non-interactive refresh",
+		Install: "zypper --non-interactive install --no-recommends",
+	},
+	"apk": {
+		Name:    "apk",
+		Install: "apk add --no-cache",
+	},
+	"pacman": {
+		Name:    "pacman",
+		Install: "pacman -Sy --noconfirm --needed",
+	},
+}
+
+// distroFamilies maps os-release ID / ID_LIKE values to a package manager
+var distroFamilies = map[string]string{
+	"debian":    "apt",
+	"ubuntu":    "apt",
+	"fedora":    "dnf",
+	"rhel":      "dnf",
+	"centos":    "dnf",
+	"rocky":     "dnf",
+	"almalinux": "dnf",
+	"ol":        "dnf",
+	"amzn":      "dnf",
+	"suse":      "zypper",
+	"opensuse":  "zypper",
+	"sles":      "zypper",
+	"alpine":    "apk",
+	"arch":      "pacman",
+	"manjaro":   "pacman",
+}
+
+// packageNames maps a tool to its package per package manager, tools not
+// listed here are installed from a package with the same name
+var packageNames = map[string]map[string]string{
+	"ssh": {
+		"apt": "openssh-client", "dnf": "openssh-clients", "zypper": "openssh-clients",
+		"apk": "openssh-client", "pacman": "openssh",
+	},
+	"g++": {
+		"apt": "g++", "dnf": "gcc-c++", "zypper": "gcc-c++", "apk": "g++", "pacman": "gcc",
+	},
+	"xz": {
+		"apt": "xz-utils", "dnf": "xz", "zypper": "xz", "apk": "xz", "pacman": "xz",
+	},
+	"ps": {
+		"apt": "procps", "dnf": "procps-ng", "zypper": "procps", "apk": "procps", "pacman": "procps-ng",
+	},
+	"ip": {
+		"apt": "iproute2", "dnf": "iproute", "zypper": "iproute2", "apk": "iproute2", "pacman": "iproute2",
+	},
+	"ping": {
+		"apt": "iputils-ping", "dnf": "iputils", "zypper": "iputils", "apk": "iputils", "pacman": "iputils",
+	},
+	"python3": {
+		"apt": "python3", "dnf": "python3", "zypper": "python3", "apk": "python3", "pacman": "python",
+	},
+	"pip3": {
+		"apt": "python3-pip", "dnf": "python3-pip", "zypper": "python3-pip", "apk": "py3-pip", "pacman": "python-pip",
+	},
+	"which": {
+		"apt": "debianutils", "dnf": "which", "zypper": "which", "apk": "which", "pacman": "which",
+	},
+	"sudo": {
+		"apt": "sudo", "dnf": "sudo", "zypper": "sudo", "apk": "sudo", "pacman": "sudo",
+	},
+}
+
+// ParseOSRelease parses the KEY=value format of /etc/os-release
+func ParseOSRelease(content string) map[string]string {
+	values := map[string]string{}
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		values[key] = strings.Trim(value, `"'`)
+	}
+	return values
+}
+
+// DetectPackageManager picks the package manager from ID, then ID_LIKE
+func DetectPackageManager(osRelease map[string]string) (*PackageManager, error) {
+	candidates := append([]string{osRelease["ID"]}, strings.Fields(osRelease["ID_LIKE"])...)
+	for _, id := range candidates {
+		id = strings.ToLower(id)
+		if name, ok := distroFamilies[id]; ok {
+			return packageManagers[name], nil
+		}
+		// openSUSE uses IDs like opensuse-tumbleweed and opensuse-leap
+		if strings.HasPrefix(id, "opensuse") {
+			return packageManagers["zypper"], nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported distribution %q (ID_LIKE %q)", osRelease["ID"], osRelease["ID_LIKE"])
+}
+
+// Packages returns the packages providing tools, without duplicates
+func (m *PackageManager) Packages(tools []string) []string {
+	var packages []string
+	seen := map[string]bool{}
+	for _, tool := range tools {
+		pkg := tool
+		if names, ok := packageNames[tool]; ok && names[m.Name] != "" {
+			pkg = names[m.Name]
+		}
+		if !seen[pkg] {
+			seen[pkg] = true
+			packages = append(packages, pkg)
+		}
+	}
+	return packages
+}
+
+// InstallScript returns a shell script that installs the packages given as
+// its positional parameters, so package names are never parsed by the shell
+func (m *PackageManager) InstallScript() string {
+	install := m.Install + ` "$@"`
+	if m.Update == "" {
+		return install
+	}
+	return m.Update + " && " + install
+}
@@ -0,0 +1,151 @@
+package wsl
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func loadOSRelease(t *testing.T, name string) map[string]string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", "os-release", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ParseOSRelease(string(data))
+}
+
+func TestParseOSRelease(t *testing.T) {
+	osRelease := loadOSRelease(t, "opensuse-tumbleweed")
+
+	if osRelease["ID"] != "opensuse-tumbleweed" {
+		t.Errorf("ID = %q, want %q", osRelease["ID"], "opensuse-tumbleweed")
+	}
+	if osRelease["ID_LIKE"] != "opensuse suse" {
+		t.Errorf("ID_LIKE = %q, want %q", osRelease["ID_LIKE"], "opensuse suse")
+	}
+	if _, ok := osRelease["# VERSION"]; ok {
+		t.Error("comments should be skipped")
+	}
+}
+
+func TestDetectPackageManager(t *testing.T) {
+	tests := []struct {
+		fixture string
+		want    string
+	}{
+		{fixture: "ubuntu-22.04", want: "apt"},
+		{fixture: "debian-12", want: "apt"},
+		{fixture: "kali-rolling", want: "apt"},
+		{fixture: "fedora-39", want: "dnf"},
+		{fixture: "almalinux-9", want: "dnf"},
+		{fixture: "opensuse-tumbleweed", want: "zypper"},
+		{fixture: "alpine-3.19", want: "apk"},
+		{fixture: "arch", want: "pacman"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			manager, err := DetectPackageManager(loadOSRelease(t, tt.fixture))
+			if err != nil {
+				t.Fatalf("DetectPackageManager() error: %v", err)
+			}
+			if manager.Name != tt.want {
+				t.Errorf("DetectPackageManager() = %s, want %s", manager.Name, tt.want)
+			}
+		})
+	}
+}
+
+func TestDetectPackageManager_Unsupported(t *testing.T) {
+	_, err := DetectPackageManager(loadOSRelease(t, "nixos"))
+	if err == nil || !strings.Contains(err.Error(), "nixos") {
+		t.Errorf("DetectPackageManager() error = %v, want unsupported nixos", err)
+	}
+}
+
+func TestPackageManager_Packages(t *testing.T) {
+	tools := []string{"git", "ssh", "xz", "ps", "python3", "g++", "gcc"}
+	tests := []struct {
+		fixture string
+		want    []string
+	}{
+		{
+			fixture: "ubuntu-22.04",
+			want:    []string{"git", "openssh-client", "xz-utils", "procps", "python3", "g++", "gcc"},
+		},
+		{
+			fixture: "fedora-39",
+			want:    []string{"git", "openssh-clients", "xz", "procps-ng", "python3", "gcc-c++", "gcc"},
+		},
+		{
+			fixture: "opensuse-tumbleweed",
+			want:    []string{"git", "openssh-clients", "xz", "procps", "python3", "gcc-c++", "gcc"},
+		},
+		{
+			fixture: "alpine-3.19",
+			want:    []string{"git", "openssh-client", "xz", "procps", "python3", "g++", "gcc"},
+		},
+		{
+			// g++ and gcc are the same package on Arch
+			fixture: "arch",
+			want:    []string{"git", "openssh", "xz", "procps-ng", "python", "gcc"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			manager, err := DetectPackageManager(loadOSRelease(t, tt.fixture))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := manager.Packages(tools)
+			if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+				t.Errorf("Packages() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPackageManager_InstallScript(t *testing.T) {
+	tests := []struct {
+		manager string
+		want    string
+	}{
+		{
+			manager: "apt",
+			want:    "DEBIAN_FRONTEND=noninteractive apt-get update -q && DEBIAN_FRONTEND=noninteractive apt-get install -y -q --no-install-recommends \"$@\"",
+		},
+		{
+			manager: "apk",
+			want:    `apk add --no-cache "$@"`,
+		},
+		{
+			manager: "pacman",
+			want:    `pacman -Sy --noconfirm --needed "$@"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.manager, func(t *testing.T) {
+			got := packageManagers[tt.manager].InstallScript()
+			if got != tt.want {
+				t.Errorf("InstallScript() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMissingToolsError(t *testing.T) {
+	err := &MissingToolsError{Tools: []string{"git", "curl"}}
+	if err.Error() != "missing tools: git, curl" {
+		t.Errorf("Error() = %q", err.Error())
+	}
+
+	var missing *MissingToolError
+	if !errors.As(err, &missing) || missing.Tool != "git" {
+		t.Errorf("errors.As() should find the first MissingToolError, got %v", missing)
+	}
+}
@@ -0,0 +1,96 @@
+package wsl
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// scriptDir is the prefix of the per-user directory holding command
+// scripts inside the distribution, the user's uid is appended to it
+var scriptDir = "/tmp/devpod-provider-wsl"
+
+// StaleScriptAge is how old a leftover script must be before init removes it
+const StaleScriptAge = time.Hour
+
+// writeScript creates the private 0700 script directory (refusing one owned
+// by somebody else), then a unique 0700 script in it filled from stdin
+const writeScript = `d="$1-$(id -u)"
+mkdir -p -m 0700 "$d" && [ -O "$d" ] && chmod 0700 "$d" || { echo "unsafe script directory $d" >&2; exit 1; }
+f=$(mktemp "$d/cmd.XXXXXXXX") && chmod 0700 "$f" && cat > "$f" && echo "$f"`
+
+// runScript sources the script in a login shell so it behaves exactly like
+// `bash --login -c "$COMMAND"`, and removes it when the shell exits. The
+// path is kept in a variable and the positional parameters are cleared, so
+// the script runs without arguments and can't change what the trap removes.
+const runScript = `f=$1; shift; trap 'rm -f -- "$f"' EXIT; . "$f"`
+
+// cleanScripts removes scripts left behind by killed commands as well as
+// the fixed inject script used by older provider versions
+const cleanScripts = `d="$1-$(id -u)"
+rm -f /tmp/devpod-inject.sh 2>/dev/null
+[ -d "$d" ] || exit 0
+find "$d" -maxdepth 1 -type f -name 'cmd.*' -mmin +"$2" -print -exec rm -f {} +`
+
+// ShellQuote quotes s as a single word for sh, for values interpolated into
+// scripts passed to Run
+func ShellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// userArgs returns the wsl.exe arguments running command as w.User. Scripts
+// live in a per-uid directory, so writing, running and removing a script
+// must all use the same user.
+func (w *WSL) userArgs(command ...string) []string {
+	args := []string{"-d", w.Distro}
+	if w.User != "" {
+		args = append(args, "-u", w.User)
+	}
+	return append(append(args, "-e"), command...)
+}
+
+// WriteScript copies script into a new temp file inside the distribution.
+// The content goes through stdin, so it is never quoted or limited by the
+// command line length, and every call gets its own file.
+func (w *WSL) WriteScript(ctx context.Context, script string) (string, error) {
+	cmd := exec.CommandContext(ctx, wslExe, w.userArgs("sh", "-c", writeScript, "sh", scriptDir)...)
+	cmd.Stdin = strings.NewReader(script)
+	output, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+			return "", fmt.Errorf("write script: %w: %s", err, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return "", fmt.Errorf("write script: %w", err)
+	}
+
+	path := strings.TrimSpace(string(output))
+	if !strings.HasPrefix(path, scriptDir+"-") {
+		return "", fmt.Errorf("write script: unexpected temp file %q", path)
+	}
+	return path, nil
+}
+
+// ScriptCommand returns the command that runs a script written by WriteScript
+func (w *WSL) ScriptCommand(ctx context.Context, path string) *exec.Cmd {
+	return exec.CommandContext(ctx, wslExe, w.userArgs("bash", "--login", "-c", runScript, "devpod-command", path)...)
+}
+
+// RemoveScript removes a script written by WriteScript. The script removes
+// itself on exit, this covers scripts that exec or replace the EXIT trap.
+func (w *WSL) RemoveScript(path string) error {
+	return exec.Command(wslExe, w.userArgs("rm", "-f", "--", path)...).Run()
+}
+
+// CleanStaleScripts removes scripts older than maxAge and returns how many were removed
+func (w *WSL) CleanStaleScripts(maxAge time.Duration) (int, error) {
+	minutes := strconv.Itoa(int(maxAge / time.Minute))
+	cmd := exec.Command(wslExe, w.userArgs("sh", "-c", cleanScripts, "sh", scriptDir, minutes)...)
+	output, err := cmd.Output()
+	if err != nil {
+		return 0, fmt.Errorf("clean stale scripts: %w", err)
+	}
+	return len(strings.Fields(string(output))), nil
+}
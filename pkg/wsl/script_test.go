@@ -0,0 +1,375 @@
+package wsl
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/loft-sh/devpod/pkg/compress"
+	"github.com/loft-sh/devpod/pkg/inject"
+	"github.com/loft-sh/devpod/pkg/log"
+	"github.com/loft-sh/devpod/pkg/provider"
+	"github.com/loft-sh/devpod/pkg/version"
+	"github.com/sirupsen/logrus"
+)
+
+// useFakeWSL runs wsl.exe commands locally for the duration of the test
+func useFakeWSL(t *testing.T) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake wsl.exe needs a POSIX shell")
+	}
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash not available")
+	}
+
+	fake, err := filepath.Abs(filepath.Join("testdata", "fake-wsl.sh"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	origExe, origDir := wslExe, scriptDir
+	wslExe = fake
+	scriptDir = filepath.Join(t.TempDir(), "devpod-provider-wsl")
+	t.Cleanup(func() { wslExe, scriptDir = origExe, origDir })
+}
+
+// DevPod's agent location and download URL, as used by InjectAgentAndExecute
+const (
+	devpodAgentPath   = "/tmp/devpod"
+	devpodDownloadURL = "https://github.com/FabianKramm/foundation/releases/download/test"
+)
+
+// injectScripts returns the scripts DevPod sends as COMMAND when it runs its
+// agent on a machine, rendered by DevPod's own inject package with the
+// arguments InjectAgentAndExecute passes
+func injectScripts(t *testing.T) map[string]string {
+	t.Helper()
+	info, err := json.Marshal(&provider.AgentWorkspaceInfo{
+		Workspace: &provider.Workspace{ID: "test", Provider: provider.WorkspaceProviderConfig{Name: "wsl"}},
+		Machine:   &provider.Machine{ID: "test"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	workspaceInfo, err := compress.Compress(string(info))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	agentPath := devpodAgentPath
+	commands := map[string]string{
+		"ssh-server":    fmt.Sprintf("%s helper ssh-server --token '%s' --stdio", agentPath, "dG9rZW4="),
+		"update-config": fmt.Sprintf("%s agent workspace update-config --workspace-info '%s'", agentPath, workspaceInfo),
+		"workspace-up":  fmt.Sprintf("%s agent workspace up --workspace-info '%s'", agentPath, workspaceInfo),
+	}
+
+	scripts := map[string]string{}
+	for name, command := range commands {
+		var script string
+		inject.InjectAndExecute(
+			context.Background(),
+			func(ctx context.Context, command string, stdin io.Reader, stdout, stderr io.Writer) error {
+				script = command
+				return errors.New("captured")
+			},
+			func(arm bool) (io.ReadCloser, error) { return nil, errors.New("not injecting") },
+			fmt.Sprintf(`[ "$(%s version 2>/dev/null || echo 'false')" != "%s" ]`, agentPath, version.GetVersion()),
+			agentPath,
+			devpodDownloadURL+"/devpod-linux-amd64",
+			devpodDownloadURL+"/devpod-linux-arm64",
+			name == "workspace-up",
+			true,
+			command,
+			nil,
+			io.Discard,
+			io.Discard,
+			time.Second,
+			log.NewStreamLogger(io.Discard, io.Discard, logrus.ErrorLevel),
+		)
+		if script == "" {
+			t.Fatalf("no inject script captured for %s", name)
+		}
+		scripts[name] = script
+	}
+	return scripts
+}
+
+func TestWriteScript_RoundTrip(t *testing.T) {
+	useFakeWSL(t)
+	w := &WSL{Distro: "Ubuntu"}
+
+	for name, script := range injectScripts(t) {
+		t.Run(name, func(t *testing.T) {
+			path, err := w.WriteScript(context.Background(), script)
+			if err != nil {
+				t.Fatalf("WriteScript failed: %v", err)
+			}
+			defer w.RemoveScript(path)
+
+			got, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != script {
+				t.Errorf("script content changed in transport (%d bytes, want %d)", len(got), len(script))
+			}
+
+			// The command line never carries the script itself
+			cmd := w.ScriptCommand(context.Background(), path)
+			want := []string{wslExe, "-d", "Ubuntu", "-e", "bash", "--login", "-c", runScript, "devpod-command", path}
+			if strings.Join(cmd.Args, "\x00") != strings.Join(want, "\x00") {
+				t.Errorf("ScriptCommand() args = %q, want %q", cmd.Args, want)
+			}
+		})
+	}
+}
+
+func TestScriptCommand_InjectPingPong(t *testing.T) {
+	useFakeWSL(t)
+	w := &WSL{Distro: "Ubuntu"}
+
+	for name, script := range injectScripts(t) {
+		if !strings.Contains(script, "DEVPOD_PING") {
+			continue
+		}
+		t.Run(name, func(t *testing.T) {
+			path, err := w.WriteScript(context.Background(), script)
+			if err != nil {
+				t.Fatalf("WriteScript failed: %v", err)
+			}
+
+			// Answer the ping wrongly so the script stops before installing anything
+			cmd := w.ScriptCommand(context.Background(), path)
+			stdin, err := cmd.StdinPipe()
+			if err != nil {
+				t.Fatal(err)
+			}
+			stdout, err := cmd.StdoutPipe()
+			if err != nil {
+				t.Fatal(err)
+			}
+			stderr := new(bytes.Buffer)
+			cmd.Stderr = stderr
+			if err := cmd.Start(); err != nil {
+				t.Fatal(err)
+			}
+
+			line, err := bufio.NewReader(stdout).ReadString('\n')
+			if err != nil || line != "ping\n" {
+				t.Fatalf("first line = %q, %v, want ping", line, err)
+			}
+			stdin.Write([]byte("nope\n"))
+			stdin.Close()
+
+			if err := cmd.Wait(); err == nil {
+				t.Error("script should fail on a wrong pong")
+			}
+			if !strings.Contains(stderr.String(), "Received wrong answer for ping request nope") {
+				t.Errorf("unexpected stderr: %q", stderr.String())
+			}
+			if _, err := os.Stat(path); !os.IsNotExist(err) {
+				t.Errorf("script %s should be removed on exit", path)
+			}
+		})
+	}
+}
+
+func TestScriptCommand_Quoting(t *testing.T) {
+	useFakeWSL(t)
+	w := &WSL{Distro: "Ubuntu"}
+
+	script, err := os.ReadFile(filepath.Join("testdata", "inject", "quoting.sh"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden, err := os.ReadFile(filepath.Join("testdata", "inject", "quoting.golden"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path, err := w.WriteScript(context.Background(), string(script))
+	if err != nil {
+		t.Fatalf("WriteScript failed: %v", err)
+	}
+
+	cmd := w.ScriptCommand(context.Background(), path)
+	cmd.Stdin = strings.NewReader("hello from devpod\n")
+	output, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("script failed: %v", err)
+	}
+	if string(output) != string(golden) {
+		t.Errorf("output = %q, want %q", output, golden)
+	}
+}
+
+func TestScriptCommand_PositionalParameters(t *testing.T) {
+	useFakeWSL(t)
+	w := &WSL{Distro: "Ubuntu"}
+
+	// Like bash -c, the script gets no arguments, and changing them doesn't
+	// change which file is removed
+	path, err := w.WriteScript(context.Background(), `echo "args=$#"; set -- /nonexistent`)
+	if err != nil {
+		t.Fatalf("WriteScript failed: %v", err)
+	}
+	output, err := w.ScriptCommand(context.Background(), path).Output()
+	if err != nil {
+		t.Fatalf("script failed: %v", err)
+	}
+	if got := strings.TrimSpace(string(output)); got != "args=0" {
+		t.Errorf("output = %q, want args=0", got)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("script %s should be removed on exit", path)
+	}
+}
+
+func TestWriteScript_Concurrent(t *testing.T) {
+	useFakeWSL(t)
+	w := &WSL{Distro: "Ubuntu"}
+
+	const n = 8
+	paths := make([]string, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			path, err := w.WriteScript(context.Background(), strings.Repeat("x", i+1))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			paths[i] = path
+		}(i)
+	}
+	wg.Wait()
+
+	seen := map[string]bool{}
+	for i, path := range paths {
+		defer w.RemoveScript(path)
+		if seen[path] {
+			t.Errorf("path %s used twice", path)
+		}
+		seen[path] = true
+
+		got, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != strings.Repeat("x", i+1) {
+			t.Errorf("script %d was overwritten: %q", i, got)
+		}
+	}
+}
+
+func TestWriteScript_Permissions(t *testing.T) {
+	useFakeWSL(t)
+	w := &WSL{Distro: "Ubuntu"}
+
+	path, err := w.WriteScript(context.Background(), "echo hi")
+	if err != nil {
+		t.Fatalf("WriteScript failed: %v", err)
+	}
+	defer w.RemoveScript(path)
+
+	for _, p := range []string{path, filepath.Dir(path)} {
+		info, err := os.Stat(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if perm := info.Mode().Perm(); perm != 0700 {
+			t.Errorf("%s permissions = %o, want 700", p, perm)
+		}
+	}
+}
+
+func TestWriteScript_RejectsForeignDirectory(t *testing.T) {
+	useFakeWSL(t)
+	if os.Geteuid() != 0 {
+		t.Skip("needs root to create a directory owned by another user")
+	}
+	w := &WSL{Distro: "Ubuntu"}
+
+	dir := scriptDir + "-0"
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chown(dir, 65534, 65534); err != nil {
+		t.Skip(err)
+	}
+
+	if _, err := w.WriteScript(context.Background(), "echo hi"); err == nil || !strings.Contains(err.Error(), "unsafe script directory") {
+		t.Errorf("WriteScript() error = %v, want unsafe script directory", err)
+	}
+}
+
+func TestCleanStaleScripts(t *testing.T) {
+	useFakeWSL(t)
+	w := &WSL{Distro: "Ubuntu"}
+
+	stale, err := w.WriteScript(context.Background(), "echo stale")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fresh, err := w.WriteScript(context.Background(), "echo fresh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.RemoveScript(fresh)
+
+	old := time.Now().Add(-2 * StaleScriptAge)
+	if err := os.Chtimes(stale, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	removed, err := w.CleanStaleScripts(StaleScriptAge)
+	if err != nil {
+		t.Fatalf("CleanStaleScripts failed: %v", err)
+	}
+	if removed != 1 {
+		t.Errorf("CleanStaleScripts() = %d, want 1", removed)
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("stale script %s should be removed", stale)
+	}
+	if _, err := os.Stat(fresh); err != nil {
+		t.Errorf("fresh script %s should be kept: %v", fresh, err)
+	}
+}
+
+func TestScriptCommand_User(t *testing.T) {
+	w := &WSL{Distro: "Ubuntu", User: "dev"}
+
+	cmd := w.ScriptCommand(context.Background(), "/tmp/script")
+	want := []string{wslExe, "-d", "Ubuntu", "-u", "dev", "-e", "bash", "--login", "-c", runScript, "devpod-command", "/tmp/script"}
+	if strings.Join(cmd.Args, "\x00") != strings.Join(want, "\x00") {
+		t.Errorf("ScriptCommand() args = %q, want %q", cmd.Args, want)
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	values := []string{"", "plain", "a b", "it's", `"$HOME" $(id) ; rm -rf / | x`, "'"}
+	for _, value := range values {
+		output, err := exec.Command("sh", "-c", "printf %s "+ShellQuote(value)).Output()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(output) != value {
+			t.Errorf("ShellQuote(%q) printed %q", value, output)
+		}
+	}
+}
@@ -0,0 +1,11 @@
+#!/bin/sh
+# Fake wsl.exe for tests: drops the distribution and user flags and runs
+# the command locally.
+while [ $# -gt 0 ]; do
+  case "$1" in
+    -d|-u) shift 2 ;;
+    -e|--) shift; break ;;
+    *) break ;;
+  esac
+done
+exec "$@"
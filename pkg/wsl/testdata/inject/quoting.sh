@@ -0,0 +1,10 @@
+greet() {
+  printf '%s|%s\n' "$1" "$2"
+}
+greet 'single quoted $HOME' "double \"quoted\""
+echo `echo backticks` $((6 * 7)) 'it'"'"'s'
+cat <<'HEREDOC'
+literal $PATH and `date`
+HEREDOC
+read -r line
+echo "stdin: $line"
@@ -3,6 +3,7 @@ package wsl
 import (
 	"bytes"
 	"context"
+	"fmt"
 	"io"
 	"os/exec"
 	"strconv"
@@ -14,6 +15,9 @@ import (
 	"golang.org/x/text/transform"
 )
 
+// wslExe is the WSL launcher, tests point it to a fake that runs commands locally
+var wslExe = "wsl.exe"
+
 type WslProvider struct {
 	Config           *options.Options
 	Log              log.Logger
@@ -37,11 +41,13 @@ func NewProvider(ctx context.Context, logs log.Logger) (*WslProvider, error) {
 
 type WSL struct {
 	Distro string
+	// User runs scripts as this Linux account, empty uses the distro's default user
+	User string
 }
 
 // Version returns WSL version (1 or 2)
 func (w *WSL) Version() (int, error) {
-	cmd := exec.Command("wsl.exe", "--version")
+	cmd := exec.Command(wslExe, "--version")
 	output, err := cmd.Output()
 	if err != nil {
 		return 0, err
@@ -62,9 +68,47 @@ func getVersionFromOutput(output string) (int, error) {
 	return 2, nil
 }
 
+// VersionInfo returns the full output of wsl.exe --version
+func (w *WSL) VersionInfo() (string, error) {
+	output, err := exec.Command(wslExe, "--version").Output()
+	return decodeOutput(output), err
+}
+
+// ListVerbose returns the output of wsl.exe -l -v, listing every
+// distribution with its state and WSL version
+func (w *WSL) ListVerbose() (string, error) {
+	output, err := exec.Command(wslExe, "-l", "-v").Output()
+	return decodeOutput(output), err
+}
+
+// Run runs a shell script inside the distribution and returns its combined output
+func (w *WSL) Run(script string) ([]byte, error) {
+	return exec.Command(wslExe, w.userArgs("sh", "-c", script)...).CombinedOutput()
+}
+
+// Output runs a shell script inside the distribution and returns its standard
+// output, with standard error kept apart for error messages
+func (w *WSL) Output(script string) (stdout, stderr []byte, err error) {
+	cmd := exec.Command(wslExe, w.userArgs("sh", "-c", script)...)
+	var errBuf bytes.Buffer
+	cmd.Stderr = &errBuf
+	stdout, err = cmd.Output()
+	return stdout, errBuf.Bytes(), err
+}
+
+// decodeOutput decodes wsl.exe's own output, which is UTF-16 unless WSL_UTF8 is set
+func decodeOutput(output []byte) string {
+	if bytes.IndexByte(output, 0) >= 0 {
+		if decoded, err := decodeUTF16(output); err == nil {
+			return decoded
+		}
+	}
+	return string(output)
+}
+
 // Exists checks if the distribution exists
 func (w *WSL) Exists() bool {
-	cmd := exec.Command("wsl.exe", "-l", "-q")
+	cmd := exec.Command(wslExe, "-l", "-q")
 	output, _ := cmd.Output()
 
 	// Try UTF-16 to UTF-8 decoding (Windows console often uses UTF-16)
@@ -105,19 +149,19 @@ func checkDistroExists(output, distro string) bool {
 
 // Start starts the WSL distribution
 func (w *WSL) Start() error {
-	cmd := exec.Command("wsl.exe", "-d", w.Distro)
+	cmd := exec.Command(wslExe, "-d", w.Distro)
 	return cmd.Start()
 }
 
 // Stop terminates the WSL distribution
 func (w *WSL) Stop() error {
-	cmd := exec.Command("wsl.exe", "--terminate", w.Distro)
+	cmd := exec.Command(wslExe, "--terminate", w.Distro)
 	return cmd.Run()
 }
 
 // Status returns the status of the distribution
 func (w *WSL) Status() string {
-	cmd := exec.Command("wsl.exe", "-d", w.Distro, "-e", "echo", "running")
+	cmd := exec.Command(wslExe, "-d", w.Distro, "-e", "echo", "running")
 	err := cmd.Run()
 	return getStatusFromError(err)
 }
@@ -129,38 +173,92 @@ func getStatusFromError(runError error) string {
 	return "Stopped"
 }
 
-// CheckDiskSpace checks if there's at least minGB free space
-func (w *WSL) CheckDiskSpace(minGB int) error {
-	cmd := exec.Command("wsl.exe", "-d", w.Distro, "-e", "df", "-BG", "/")
+// DiskInfo describes the filesystem holding a path inside the distribution
+type DiskInfo struct {
+	// Path is the checked path, or its closest existing parent
+	Path       string `json:"path"`
+	Filesystem string `json:"filesystem"`
+	// AvailableBytes is the space available to unprivileged users
+	AvailableBytes uint64 `json:"availableBytes"`
+	// AvailableInodes is -1 when the filesystem does not report inodes (e.g. btrfs)
+	AvailableInodes int64 `json:"availableInodes"`
+}
+
+// DiskUsage reports free space and inodes of the filesystem holding path.
+// The path does not have to exist yet, its closest existing parent is used.
+func (w *WSL) DiskUsage(path string) (*DiskInfo, error) {
+	script := `p="$1"; while [ ! -e "$p" ]; do p=$(dirname "$p"); done; echo "$p"; df --output=avail,fstype,iavail -B1 "$p"`
+	cmd := exec.Command(wslExe, "-d", w.Distro, "-e", "sh", "-c", script, "sh", path)
 	output, err := cmd.Output()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return parseDiskSpace(string(output), minGB)
+	lines := strings.SplitN(string(output), "\n", 2)
+	if len(lines) != 2 {
+		return nil, fmt.Errorf("unexpected df output: %q", output)
+	}
+	info, err := parseDiskSpace(lines[1])
+	if err != nil {
+		return nil, err
+	}
+	info.Path = strings.TrimSpace(lines[0])
+	return info, nil
 }
 
-func parseDiskSpace(dfOutput string, minGB int) error {
-	lines := strings.Split(dfOutput, "\n")
-	for _, line := range lines {
-		if strings.HasPrefix(line, "/dev/sd") || strings.HasPrefix(line, "/dev/vd") {
-			parts := strings.Fields(line)
-			if len(parts) >= 4 {
-				available := strings.TrimSuffix(parts[3], "G")
-				size, err := strconv.Atoi(available)
-				if err != nil {
-					continue
-				}
-				if size < minGB {
-					return &DiskSpaceError{Available: size, Required: minGB}
-				}
-				return nil
-			}
-		}
+// CheckDiskSpace checks if the filesystem holding path has at least minGB
+// free space and free inodes left
+func (w *WSL) CheckDiskSpace(path string, minGB int) (*DiskInfo, error) {
+	info, err := w.DiskUsage(path)
+	if err != nil {
+		return nil, err
+	}
+	return info, checkDiskInfo(info, minGB)
+}
+
+func checkDiskInfo(info *DiskInfo, minGB int) error {
+	available := int(info.AvailableBytes >> 30)
+	if available < minGB {
+		return &DiskSpaceError{Available: available, Required: minGB}
+	}
+	if info.AvailableInodes == 0 {
+		return &InodeError{Path: info.Path}
 	}
 	return nil
 }
 
+// parseDiskSpace parses the output of `df --output=avail,fstype,iavail -B1`
+func parseDiskSpace(dfOutput string) (*DiskInfo, error) {
+	lines := strings.Split(strings.TrimSpace(dfOutput), "\n")
+	if len(lines) < 2 {
+		return nil, fmt.Errorf("unexpected df output: %q", dfOutput)
+	}
+
+	fields := strings.Fields(lines[len(lines)-1])
+	if len(fields) != 3 {
+		return nil, fmt.Errorf("unexpected df output: %q", dfOutput)
+	}
+
+	available, err := strconv.ParseUint(fields[0], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("parse available space %q: %w", fields[0], err)
+	}
+
+	info := &DiskInfo{
+		Filesystem:      fields[1],
+		AvailableBytes:  available,
+		AvailableInodes: -1,
+	}
+	if fields[2] != "-" {
+		inodes, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("parse available inodes %q: %w", fields[2], err)
+		}
+		info.AvailableInodes = inodes
+	}
+	return info, nil
+}
+
 type DiskSpaceError struct {
 	Available int
 	Required  int
@@ -170,17 +268,41 @@ func (e *DiskSpaceError) Error() string {
 	return "insufficient disk space: " + strconv.Itoa(e.Available) + "G < " + strconv.Itoa(e.Required) + "G required"
 }
 
-// CheckTools checks if required tools are installed
+type InodeError struct {
+	Path string
+}
+
+func (e *InodeError) Error() string {
+	return "no free inodes on " + e.Path
+}
+
+// CheckTools checks if required tools are installed and reports all missing tools at once
 func (w *WSL) CheckTools(tools []string) error {
-	for _, tool := range tools {
-		cmd := exec.Command("wsl.exe", "-d", w.Distro, "-e", "which", tool)
-		if err := cmd.Run(); err != nil {
-			return &MissingToolError{Tool: tool}
-		}
+	missing, err := w.MissingTools(tools)
+	if err != nil {
+		return err
+	}
+	if len(missing) > 0 {
+		return &MissingToolsError{Tools: missing}
 	}
 	return nil
 }
 
+// MissingTools returns the tools that are not found in the distribution's PATH
+func (w *WSL) MissingTools(tools []string) ([]string, error) {
+	if len(tools) == 0 {
+		return nil, nil
+	}
+	script := `for t in "$@"; do command -v "$t" >/dev/null 2>&1 || echo "$t"; done`
+	args := append([]string{"-d", w.Distro, "-e", "sh", "-c", script, "sh"}, tools...)
+	cmd := exec.Command(wslExe, args...)
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(string(output)), nil
+}
+
 type MissingToolError struct {
 	Tool string
 }
@@ -188,3 +310,153 @@ type MissingToolError struct {
 func (e *MissingToolError) Error() string {
 	return "missing tool: " + e.Tool
 }
+
+// MissingToolsError lists every missing tool, it unwraps to one MissingToolError per tool
+type MissingToolsError struct {
+	Tools []string
+}
+
+func (e *MissingToolsError) Error() string {
+	if len(e.Tools) == 1 {
+		return "missing tool: " + e.Tools[0]
+	}
+	return "missing tools: " + strings.Join(e.Tools, ", ")
+}
+
+func (e *MissingToolsError) Unwrap() []error {
+	errs := make([]error, len(e.Tools))
+	for i, tool := range e.Tools {
+		errs[i] = &MissingToolError{Tool: tool}
+	}
+	return errs
+}
+
+// KernelVersion returns the kernel release of the distribution (uname -r)
+func (w *WSL) KernelVersion() (string, error) {
+	cmd := exec.Command(wslExe, "-d", w.Distro, "-e", "uname", "-r")
+	output, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// CompareVersions compares dotted numeric versions such as "5.15.133.1-microsoft-standard-WSL2"
+// and "5.10". Only the leading numeric components are compared, missing ones count as 0.
+func CompareVersions(a, b string) int {
+	pa, pb := versionParts(a), versionParts(b)
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		var va, vb int
+		if i < len(pa) {
+			va = pa[i]
+		}
+		if i < len(pb) {
+			vb = pb[i]
+		}
+		if va != vb {
+			if va < vb {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+func versionParts(version string) []int {
+	var parts []int
+	for _, field := range strings.Split(version, ".") {
+		end := 0
+		for end < len(field) && field[end] >= '0' && field[end] <= '9' {
+			end++
+		}
+		if end == 0 {
+			break
+		}
+		n, _ := strconv.Atoi(field[:end])
+		parts = append(parts, n)
+		if end < len(field) {
+			break
+		}
+	}
+	return parts
+}
+
+// SystemdEnabled reports whether systemd is running as PID 1 in the distribution
+func (w *WSL) SystemdEnabled() bool {
+	cmd := exec.Command(wslExe, "-d", w.Distro, "-e", "test", "-d", "/run/systemd/system")
+	return cmd.Run() == nil
+}
+
+// EnableSystemd turns on systemd in /etc/wsl.conf and terminates the
+// distribution so the setting is applied on the next start
+func (w *WSL) EnableSystemd() error {
+	script := `grep -q '^systemd=true' /etc/wsl.conf 2>/dev/null || printf '\n[boot]\nsystemd=true\n' >> /etc/wsl.conf`
+	cmd := exec.Command(wslExe, "-d", w.Distro, "-u", "root", "-e", "sh", "-c", script)
+	if err := cmd.Run(); err != nil {
+		return err
+	}
+	return w.Stop()
+}
+
+// AvailableMemory returns MemAvailable of the distribution in bytes
+func (w *WSL) AvailableMemory() (uint64, error) {
+	cmd := exec.Command(wslExe, "-d", w.Distro, "-e", "cat", "/proc/meminfo")
+	output, err := cmd.Output()
+	if err != nil {
+		return 0, err
+	}
+	return parseMemAvailable(string(output))
+}
+
+func parseMemAvailable(meminfo string) (uint64, error) {
+	for _, line := range strings.Split(meminfo, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && fields[0] == "MemAvailable:" {
+			kb, err := strconv.ParseUint(fields[1], 10, 64)
+			if err != nil {
+				return 0, err
+			}
+			return kb * 1024, nil
+		}
+	}
+	return 0, fmt.Errorf("MemAvailable not found in /proc/meminfo")
+}
+
+// OSRelease returns the parsed /etc/os-release of the distribution
+func (w *WSL) OSRelease() (map[string]string, error) {
+	cmd := exec.Command(wslExe, "-d", w.Distro, "-e", "sh", "-c",
+		"cat /etc/os-release 2>/dev/null || cat /usr/lib/os-release")
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("read os-release: %w", err)
+	}
+	return ParseOSRelease(string(output)), nil
+}
+
+// InstallTools installs the missing tools as root with the package manager
+// of the distribution's family
+func (w *WSL) InstallTools(tools []string) error {
+	missing, err := w.MissingTools(tools)
+	if err != nil || len(missing) == 0 {
+		return err
+	}
+
+	osRelease, err := w.OSRelease()
+	if err != nil {
+		return err
+	}
+	manager, err := DetectPackageManager(osRelease)
+	if err != nil {
+		return err
+	}
+
+	packages := manager.Packages(missing)
+	args := append([]string{"-d", w.Distro, "-u", "root", "-e", "sh", "-c", manager.InstallScript(), "sh"}, packages...)
+	cmd := exec.Command(wslExe, args...)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s install %s: %w: %s", manager.Name, strings.Join(packages, " "), err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
@@ -120,64 +120,124 @@ func TestWSL_Status(t *testing.T) {
 
 func TestWSL_DiskSpace(t *testing.T) {
 	tests := []struct {
-		name     string
-		dfOutput string
-		minGB    int
-		wantErr  bool
-		errMsg   string
+		name       string
+		dfOutput   string
+		minGB      int
+		wantFS     string
+		wantInodes int64
+		wantErr    bool
+		errMsg     string
 	}{
 		{
-			name:     "sufficient space",
-			dfOutput: "Filesystem      Size  Used Avail Use% Mounted on\n/dev/sda1       100G   20G   80G  20% /",
-			minGB:    5,
-			wantErr:  false,
+			name:       "sufficient space",
+			dfOutput:   "   Avail Type  IFree\n85899345920 ext4 6000000\n",
+			minGB:      5,
+			wantFS:     "ext4",
+			wantInodes: 6000000,
 		},
 		{
 			name:     "insufficient space",
-			dfOutput: "Filesystem      Size  Used Avail Use% Mounted on\n/dev/sda1       10G    5G    5G  50% /",
+			dfOutput: "   Avail Type  IFree\n5368709120 ext4 6000000\n",
 			minGB:    10,
+			wantFS:   "ext4",
 			wantErr:  true,
-			errMsg:   "insufficient disk space",
+			errMsg:   "insufficient disk space: 5G < 10G required",
 		},
 		{
-			name:     "exactly at limit",
-			dfOutput: "Filesystem      Size  Used Avail Use% Mounted on\n/dev/sda1       20G   10G   10G  50% /",
-			minGB:    10,
-			wantErr:  false,
+			name:       "exactly at limit",
+			dfOutput:   "   Avail Type  IFree\n10737418240 ext4 100\n",
+			minGB:      10,
+			wantFS:     "ext4",
+			wantInodes: 100,
 		},
 		{
-			name:     "vd disk",
-			dfOutput: "Filesystem      Size  Used Avail Use% Mounted on\n/dev/vda1       50G   10G   40G  20% /",
-			minGB:    5,
-			wantErr:  false,
+			name:       "overlay root",
+			dfOutput:   "   Avail Type    IFree\n42949672960 overlay 1000\n",
+			minGB:      5,
+			wantFS:     "overlay",
+			wantInodes: 1000,
 		},
 		{
-			name:     "empty output",
-			dfOutput: "",
+			name:       "btrfs without inode count",
+			dfOutput:   "   Avail Type  IFree\n42949672960 btrfs -\n",
+			minGB:      5,
+			wantFS:     "btrfs",
+			wantInodes: -1,
+		},
+		{
+			name:     "insufficient overlay root",
+			dfOutput: "   Avail Type    IFree\n1073741824 overlay 1000\n",
 			minGB:    5,
-			wantErr:  false,
+			wantFS:   "overlay",
+			wantErr:  true,
+			errMsg:   "insufficient disk space",
 		},
 		{
-			name:     "non-numeric size",
-			dfOutput: "Filesystem      Size  Used Avail Use% Mounted on\n/dev/sda1       unknown  10G   40G  20% /",
+			name:     "no free inodes",
+			dfOutput: "   Avail Type  IFree\n42949672960 ext4 0\n",
 			minGB:    5,
-			wantErr:  false,
+			wantFS:   "ext4",
+			wantErr:  true,
+			errMsg:   "no free inodes",
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := parseDiskSpace(tt.dfOutput, tt.minGB)
+			info, err := parseDiskSpace(tt.dfOutput)
+			if err != nil {
+				t.Fatalf("parseDiskSpace() unexpected error: %v", err)
+			}
+			if info.Filesystem != tt.wantFS {
+				t.Errorf("Filesystem = %q, want %q", info.Filesystem, tt.wantFS)
+			}
+
+			err = checkDiskInfo(info, tt.minGB)
 			if tt.wantErr {
 				if err == nil {
-					t.Errorf("parseDiskSpace() expected error, got nil")
+					t.Errorf("checkDiskInfo() expected error, got nil")
 				} else if tt.errMsg != "" && !strings.Contains(err.Error(), tt.errMsg) {
-					t.Errorf("parseDiskSpace() error = %v, want contains %v", err, tt.errMsg)
-				}
-			} else {
-				if err != nil {
-					t.Errorf("parseDiskSpace() unexpected error: %v", err)
+					t.Errorf("checkDiskInfo() error = %v, want contains %v", err, tt.errMsg)
 				}
+				return
+			}
+			if err != nil {
+				t.Errorf("checkDiskInfo() unexpected error: %v", err)
+			}
+			if info.AvailableInodes != tt.wantInodes {
+				t.Errorf("AvailableInodes = %d, want %d", info.AvailableInodes, tt.wantInodes)
+			}
+		})
+	}
+}
+
+func TestWSL_DiskSpaceInvalidOutput(t *testing.T) {
+	tests := []struct {
+		name     string
+		dfOutput string
+	}{
+		{
+			name:     "empty output",
+			dfOutput: "",
+		},
+		{
+			name:     "header only",
+			dfOutput: "   Avail Type  IFree\n",
+		},
+		{
+			name:     "non-numeric size",
+			dfOutput: "   Avail Type  IFree\nunknown ext4 100\n",
+		},
+		{
+			name:     "legacy df output",
+			dfOutput: "Filesystem      Size  Used Avail Use% Mounted on\n/dev/sda1       100G   20G   80G  20% /",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseDiskSpace(tt.dfOutput); err == nil {
+				t.Errorf("parseDiskSpace() expected error for %q", tt.dfOutput)
 			}
 		})
 	}
@@ -303,3 +363,56 @@ func checkToolExists(output, tool string) error {
 	}
 	return nil
 }
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"5.15.133.1-microsoft-standard-WSL2", "5.10", 1},
+		{"5.10.16.3-microsoft-standard-WSL2", "5.10", 1},
+		{"5.10", "5.10.0", 0},
+		{"4.19.128-microsoft-standard", "5.10", -1},
+		{"6.1.21.2-microsoft-standard-WSL2+", "6.1.21.2", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.a+"_"+tt.b, func(t *testing.T) {
+			if got := CompareVersions(tt.a, tt.b); got != tt.want {
+				t.Errorf("CompareVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseMemAvailable(t *testing.T) {
+	meminfo := "MemTotal:        8029356 kB\nMemFree:         6000000 kB\nMemAvailable:    7000000 kB\n"
+
+	got, err := parseMemAvailable(meminfo)
+	if err != nil {
+		t.Fatalf("parseMemAvailable() error: %v", err)
+	}
+	if got != 7000000*1024 {
+		t.Errorf("parseMemAvailable() = %d, want %d", got, 7000000*1024)
+	}
+
+	if _, err := parseMemAvailable("MemTotal: 1 kB"); err == nil {
+		t.Error("parseMemAvailable() expected error without MemAvailable")
+	}
+}
+
+func TestWSL_Output(t *testing.T) {
+	useFakeWSL(t)
+	w := &WSL{Distro: "Ubuntu"}
+
+	stdout, stderr, err := w.Output(`echo '{"status":"ok"}'; echo "level=INFO msg=log" >&2`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(stdout) != "{\"status\":\"ok\"}\n" {
+		t.Errorf("stdout = %q", stdout)
+	}
+	if string(stderr) != "level=INFO msg=log\n" {
+		t.Errorf("stderr = %q", stderr)
+	}
+}